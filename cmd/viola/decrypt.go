@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+func decryptCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "decrypt",
+		Usage:     "Write a fully decrypted copy of a file as plaintext TOML",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "output",
+				Aliases:  []string{"o"},
+				Usage:    "Path of the plaintext TOML file to write ('-' for stdout)",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:    "force",
+				Aliases: []string{"f"},
+				Usage:   "Write even if the output file is readable by everyone",
+			},
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age identity file",
+				Value:   cli.NewStringSlice(),
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Inline age identity key (insecure, for testing)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Prompt for passphrase interactively",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-file",
+				Usage: "Read passphrase from file (first line)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase-raw",
+				Usage: "Use the whole --passphrase-file verbatim instead of its trimmed first line",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "Read passphrase from environment variable",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output (the cleartext warning is always printed)",
+			},
+		},
+		Action: decryptAction,
+	}
+}
+
+func decryptAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), exitUserError)
+	}
+	output := c.String("output")
+
+	// Check the destination before asking for any passphrase
+	if output != "-" {
+		if err := checkPlaintextOutput(filename, output, c.Bool("force")); err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+		}
+	}
+
+	keySources, err := buildKeySources(c)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), exitUserError)
+	}
+
+	data, err := readInput(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
+	}
+
+	result, err := viola.Load(data, viola.Options{Keys: keySources})
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading configuration: %v", err)), exitUserError)
+	}
+
+	// A partly decrypted file would still hold armor, which defeats the point
+	if failed := undecryptablePaths(result.Fields); len(failed) > 0 {
+		msg := fmt.Sprintf("Error: %d encrypted field(s) could not be decrypted:\n  %s", len(failed), strings.Join(failed, "\n  "))
+		return cli.NewExitError(errorStyle.Render(msg), exitUserError)
+	}
+
+	plain, err := viola.FormatWithInlineTables(result.Tree, result.InlineTables)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), exitInternalError)
+	}
+
+	fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("WARNING: the output contains %d secret(s) in cleartext. Do not commit it, and delete it when done.", countEncryptedFields(result.Fields))))
+
+	if output == "-" {
+		os.Stdout.Write(plain)
+		return nil
+	}
+
+	// Owner-only, including an existing file that was group-readable
+	if err := writePrivateFile(output, plain); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing output: %v", err)), exitUserError)
+	}
+
+	if !c.Bool("quiet") {
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ Wrote plaintext to %s", output)))
+	}
+	return nil
+}
+
+// checkPlaintextOutput refuses an output path that is the input itself, or an
+// existing file that everyone can read unless force is set
+func checkPlaintextOutput(input, output string, force bool) error {
+	info, err := os.Stat(output)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if inputInfo, err := os.Stat(input); err == nil && os.SameFile(info, inputInfo) {
+		return fmt.Errorf("output %s is the input file", output)
+	}
+	if info.Mode().Perm()&0004 != 0 && !force {
+		return fmt.Errorf("%s is world-readable (mode %04o); chmod it or use --force", output, info.Mode().Perm())
+	}
+	return nil
+}
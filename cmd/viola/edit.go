@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/pkg/enc"
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+func editCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "edit",
+		Usage:     "Decrypt a TOML configuration into $EDITOR and re-encrypt only the changed fields",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age identity file",
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Inline age identity key (insecure, for testing)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Prompt for passphrase interactively",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-file",
+				Usage: "Read passphrase from file (first line)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase-raw",
+				Usage: "Use the whole --passphrase-file verbatim instead of its trimmed first line",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "Read passphrase from environment variable",
+			},
+			&cli.StringSliceFlag{
+				Name:    "recipients",
+				Aliases: []string{"r"},
+				Usage:   "Path or HTTPS URL of a recipients file containing age public keys",
+			},
+			&cli.StringFlag{
+				Name:  "recipients-inline",
+				Usage: "Comma-separated age public keys for encryption",
+			},
+			&cli.StringFlag{
+				Name:  "recipients-age-file",
+				Usage: "Path to a recipient alias file (lines of \"group = age1..., age1...\")",
+			},
+			&cli.StringSliceFlag{
+				Name:  "recipients-group",
+				Usage: "Encrypt to the recipients of a group in --recipients-age-file (repeatable)",
+			},
+			&cli.BoolFlag{
+				Name:  "recipients-self",
+				Usage: "Also encrypt to the recipients derived from --identity",
+			},
+			&cli.StringFlag{
+				Name:  "private-prefix",
+				Usage: "Prefix for new fields to encrypt (default: 'private_')",
+				Value: "private_",
+			},
+			&cli.StringFlag{
+				Name:  "violarc",
+				Usage: "Policy file of encryption rules for new fields (default: " + viola.RCFileName + " in the working directory, if any)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-violarc",
+				Usage: "Ignore the " + viola.RCFileName + " file in the working directory",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Open the editor, then list the fields that would be re-encrypted and to which recipients, without writing the file",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output",
+			},
+		},
+		Action: editAction,
+	}
+}
+
+func editAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+	}
+
+	data, err := readFile(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+	}
+
+	keySources, err := buildKeySources(c)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), 1)
+	}
+
+	recipients, err := buildRecipients(c)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up recipients: %v", err)), 1)
+	}
+	keySources.Recipients = recipients
+
+	// New fields are encrypted by the prefix and the repository's .violarc policy
+	newFieldRule := viola.EncryptByPrefix(c.String("private-prefix"))
+	rcRules, err := readRCRules(c)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading %s: %v", viola.RCFileName, err)), 1)
+	}
+	if rcRules != nil {
+		newFieldRule = viola.EncryptAny(newFieldRule, rcRules)
+	}
+
+	// Decrypt once up front; the identities are needed again when comparing
+	if keySources.PassphraseProvider != nil {
+		keySources.PassphraseProvider = cachePassphrase(keySources.PassphraseProvider)
+	}
+
+	plaintext, err := decryptForEdit(data, keySources)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), 1)
+	}
+
+	edited, err := runEditor(plaintext)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error editing file: %v", err)), 1)
+	}
+
+	if bytes.Equal(edited, plaintext) {
+		if !c.Bool("quiet") {
+			fmt.Println(infoStyle.Render("No changes"))
+		}
+		return nil
+	}
+
+	output, fields, err := reencryptEdited(data, edited, keySources, newFieldRule)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error re-encrypting configuration: %v", err)), 1)
+	}
+
+	if c.Bool("dry-run") {
+		preview, err := previewEdit(data, output, fields, keySources)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), 1)
+		}
+		labels, _ := recipientLabels(c.StringSlice("recipients"))
+		if !printEditPreview(filename, preview, labels, c.Bool("quiet")) {
+			return cli.NewExitError("", exitUserError)
+		}
+		return nil
+	}
+
+	if err := os.WriteFile(filename, output, info.Mode().Perm()); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing file: %v", err)), 1)
+	}
+
+	if !c.Bool("quiet") {
+		fmt.Printf("✓ Updated %s (%d encrypted fields)\n", filename, countEncryptedFields(fields))
+	}
+
+	return nil
+}
+
+// decryptForEdit decrypts an encrypted configuration to plaintext TOML for editing.
+// Every encrypted field must decrypt, since a field left armored can't be edited.
+func decryptForEdit(data []byte, keys enc.KeySources) ([]byte, error) {
+	result, err := viola.Load(data, viola.Options{Keys: keys})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if failed := undecryptablePaths(result.Fields); len(failed) > 0 {
+		return nil, fmt.Errorf("cannot edit: %d field(s) could not be decrypted: %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	return viola.FormatWithInlineTables(result.Tree, result.InlineTables)
+}
+
+// reencryptEdited encrypts an edited plaintext configuration, reusing the
+// original armor for every field whose value did not change. Fields that were
+// encrypted in the original stay encrypted; others are encrypted if they
+// match newFieldRule.
+func reencryptEdited(original, edited []byte, keys enc.KeySources, newFieldRule func(path []string, key string, value any) bool) ([]byte, []viola.FieldMeta, error) {
+	previous, err := viola.Load(original, viola.Options{}) // No keys: keep the armor
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse original: %w", err)
+	}
+
+	var encryptedPaths []string
+	for _, field := range findEncryptedFields(previous.Tree, nil) {
+		encryptedPaths = append(encryptedPaths, strings.Join(field.Path, "."))
+	}
+
+	tree, err := parseInput(edited, "toml")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse edited TOML: %w", err)
+	}
+
+	opts := viola.Options{
+		Keys:          keys,
+		PreviousTree:  previous.Tree,
+		ShouldEncrypt: viola.EncryptAny(viola.EncryptByPath(encryptedPaths...), newFieldRule),
+		InlineTables:  viola.FindInlineTables(edited),
+		HeaderComment: previous.HeaderComment,
+	}
+
+	return viola.Save(tree, opts)
+}
+
+// Statuses of a field in the edit --dry-run preview
+const (
+	editKept        = "kept"         // Unchanged, original ciphertext reused
+	editReencrypted = "re-encrypted" // New ciphertext
+	editRemoved     = "removed"      // Encrypted in the original, gone or plaintext after the edit
+)
+
+// editPreviewEntry is one line of the edit --dry-run preview
+type editPreviewEntry struct {
+	Path       string
+	Status     string
+	Recipients []string
+	Readable   bool // The identities decrypt the new ciphertext
+}
+
+// previewEdit compares the encrypted fields of the original file with those
+// reencryptEdited produced, sorted by path. output is decrypted with keys so
+// the preview says whether the identities can still read each new ciphertext,
+// rather than assuming it.
+func previewEdit(original, output []byte, fields []viola.FieldMeta, keys enc.KeySources) ([]editPreviewEntry, error) {
+	previous, err := viola.Load(original, viola.Options{}) // No keys: keep the armor
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original: %w", err)
+	}
+	before := make(map[string]string)
+	for _, field := range findEncryptedFields(previous.Tree, nil) {
+		before[strings.Join(field.Path, ".")] = field.Armored
+	}
+
+	result, err := viola.Load(output, viola.Options{Keys: keys})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the edited configuration: %w", err)
+	}
+	unreadable := make(map[string]bool)
+	for _, path := range undecryptablePaths(result.Fields) {
+		unreadable[path] = true
+	}
+
+	var entries []editPreviewEntry
+	for _, field := range fields {
+		if !field.WasEncrypted {
+			continue
+		}
+		path := strings.Join(field.Path, ".")
+		entry := editPreviewEntry{Path: path, Status: editReencrypted, Recipients: field.UsedRecipients, Readable: !unreadable[path]}
+		if armored, ok := before[path]; ok && armored == field.Armored {
+			entry.Status = editKept
+		}
+		delete(before, path)
+		entries = append(entries, entry)
+	}
+	for path := range before {
+		entries = append(entries, editPreviewEntry{Path: path, Status: editRemoved})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// printEditPreview prints the edit --dry-run preview (only its warnings when
+// quiet), with recipients labeled by labels, warning on stderr about
+// re-encrypted fields the identities used for the edit could no longer read.
+// It reports false if there are any.
+func printEditPreview(filename string, entries []editPreviewEntry, labels map[string]string, quiet bool) bool {
+	if !quiet {
+		reencrypted := 0
+		for _, entry := range entries {
+			if entry.Status == editReencrypted {
+				reencrypted++
+			}
+		}
+
+		fmt.Println(headerStyle.Render(fmt.Sprintf("Would re-encrypt %d fields in %s:", reencrypted, filename)))
+		for _, entry := range entries {
+			switch entry.Status {
+			case editKept:
+				fmt.Printf("  = %s (unchanged, ciphertext kept)\n", entry.Path)
+			case editRemoved:
+				fmt.Printf("  - %s (encrypted before, removed or plaintext after the edit)\n", entry.Path)
+			default:
+				keys := make([]string, len(entry.Recipients))
+				for i, recipient := range entry.Recipients {
+					keys[i] = labeledKey(recipient, labels, false)
+				}
+				fmt.Printf("  + %s (re-encrypted to %s)\n", entry.Path, strings.Join(keys, ", "))
+			}
+		}
+	}
+
+	readable := true
+	for _, entry := range entries {
+		if entry.Status == editReencrypted && !entry.Readable {
+			fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: %s would not be decryptable with the identities used for this edit", entry.Path)))
+			readable = false
+		}
+	}
+	if !quiet {
+		fmt.Println(infoStyle.Render("Dry run: " + filename + " was not modified"))
+	}
+	return readable
+}
+
+// runEditor writes content to a private temporary file, opens it in $VISUAL or
+// $EDITOR (falling back to vi), and returns the edited content
+func runEditor(content []byte) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "viola-edit-*.toml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to restrict temporary file: %w", err)
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], tmp.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+
+	return os.ReadFile(tmp.Name())
+}
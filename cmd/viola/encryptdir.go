@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+// Outcome of encrypting one file with encrypt --recursive
+const (
+	dirFileEncrypted = "encrypted"
+	dirFileSkipped   = "skipped"
+	dirFileFailed    = "failed"
+)
+
+// dirFileResult is what encrypt --recursive did with one file
+type dirFileResult struct {
+	File   string
+	Output string
+	Status string
+	Detail string
+}
+
+// encryptDirectory implements encrypt --recursive: every .toml file under dir
+// is encrypted in place, or into --output-dir with the same relative path.
+// A failing file doesn't stop the others, but makes the command fail.
+func encryptDirectory(c *cli.Context, dir string) error {
+	for _, flag := range []string{"output", "in-place", "changed-only", "dry-run", "no-encrypt", "recipients-out", "backup"} {
+		if c.IsSet(flag) {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: --recursive cannot be combined with --%s", flag)), exitUserError)
+		}
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: --recursive needs a directory: %s", dir)), exitUserError)
+	}
+
+	outputDir := c.String("output-dir")
+	files, err := findTOMLFiles(dir, outputDir)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+	}
+	if len(files) == 0 {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: no .toml files found in %s", dir)), exitUserError)
+	}
+
+	quiet := c.Bool("quiet")
+	if !quiet {
+		fmt.Print(headerStyle.Render(" ENCRYPT COMMAND "))
+		fmt.Println()
+		fmt.Println()
+	}
+
+	// Recipients are resolved, and a passphrase asked for, once for all files
+	recipients, passphraseProvider, err := encryptRecipients(c)
+	if err != nil {
+		return err
+	}
+	opts, err := encryptOptions(c, recipients, passphraseProvider)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, file := range files {
+		result := encryptDirFile(c, dir, file, outputDir, opts)
+		counts[result.Status]++
+
+		switch result.Status {
+		case dirFileEncrypted:
+			if !quiet {
+				fmt.Println(successStyle.Render(fmt.Sprintf("✓ %s → %s (%s)", result.File, result.Output, result.Detail)))
+			}
+		case dirFileSkipped:
+			if !quiet {
+				fmt.Println(infoStyle.Render(fmt.Sprintf("- %s: skipped (%s)", result.File, result.Detail)))
+			}
+		default:
+			fmt.Println(errorStyle.Render(fmt.Sprintf("✗ %s: %s", result.File, result.Detail)))
+		}
+	}
+
+	summary := fmt.Sprintf("%d encrypted, %d skipped, %d failed of %d file(s)",
+		counts[dirFileEncrypted], counts[dirFileSkipped], counts[dirFileFailed], len(files))
+	if counts[dirFileFailed] > 0 {
+		return cli.NewExitError(errorStyle.Render("\n"+summary), exitUserError)
+	}
+	if !quiet {
+		fmt.Println()
+		fmt.Println(successStyle.Render("✓ " + summary))
+	}
+	return nil
+}
+
+// encryptDirFile encrypts one file of encrypt --recursive with opts and the
+// field selection flags. Unless --force, files with nothing left to encrypt
+// and existing --output-dir files are skipped.
+func encryptDirFile(c *cli.Context, root, file, outputDir string, opts viola.Options) dirFileResult {
+	result := dirFileResult{File: file, Output: file, Status: dirFileFailed}
+	if outputDir != "" {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			result.Detail = err.Error()
+			return result
+		}
+		result.Output = filepath.Join(outputDir, rel)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		result.Detail = fmt.Sprintf("error reading file: %v", err)
+		return result
+	}
+	tree, err := parseInput(data, "toml")
+	if err != nil {
+		result.Detail = fmt.Sprintf("error parsing TOML: %v", err)
+		return result
+	}
+
+	opts.InlineTables = inlineTables(data, "toml")
+	opts.ShouldEncrypt, err = encryptRule(c, tree)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+
+	if !c.Bool("force") {
+		pending := 0
+		for _, entry := range previewEncryption(tree, opts.ShouldEncrypt, nil) {
+			if entry.Status == previewEncrypt {
+				pending++
+			}
+		}
+		if pending == 0 {
+			result.Status = dirFileSkipped
+			result.Detail = "nothing left to encrypt"
+			return result
+		}
+		if outputDir != "" {
+			if _, err := os.Stat(result.Output); err == nil {
+				result.Status = dirFileSkipped
+				result.Detail = "output exists, use --force to overwrite"
+				return result
+			}
+		}
+	}
+
+	encrypted, fields, err := viola.Save(tree, opts)
+	if err != nil {
+		result.Detail = fmt.Sprintf("error encrypting: %v", err)
+		return result
+	}
+
+	if outputDir != "" {
+		if err := os.MkdirAll(filepath.Dir(result.Output), 0755); err == nil {
+			err = os.WriteFile(result.Output, encrypted, 0644)
+		}
+	} else {
+		err = writeFileAtomic(file, encrypted)
+	}
+	if err != nil {
+		result.Detail = fmt.Sprintf("error writing output: %v", err)
+		return result
+	}
+
+	result.Status = dirFileEncrypted
+	result.Detail = fmt.Sprintf("%d field(s)", countEncryptedFields(fields))
+	return result
+}
+
+// findTOMLFiles returns the .toml files under dir in lexical order, skipping
+// hidden directories and outputDir, so a mirror inside dir isn't re-encrypted
+func findTOMLFiles(dir, outputDir string) ([]string, error) {
+	var skip string
+	if outputDir != "" {
+		abs, err := filepath.Abs(outputDir)
+		if err != nil {
+			return nil, err
+		}
+		skip = abs
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(path); err == nil && abs == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(path), ".toml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
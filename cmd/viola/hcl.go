@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// formatAsHCL formats data as HCL. Tables become blocks, arrays become tuple
+// expressions, and scalars become attributes with the closest HCL literal.
+func formatAsHCL(data any) ([]byte, error) {
+	tree, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("HCL output requires a table at the top level")
+	}
+
+	file := hclwrite.NewEmptyFile()
+	if err := writeHCLBody(file.Body(), tree); err != nil {
+		return nil, err
+	}
+
+	return file.Bytes(), nil
+}
+
+// writeHCLBody writes a table's attributes first, then its nested tables as blocks
+func writeHCLBody(body *hclwrite.Body, tree map[string]any) error {
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var blockKeys []string
+	for _, key := range keys {
+		if _, ok := tree[key].(map[string]any); ok {
+			blockKeys = append(blockKeys, key)
+			continue
+		}
+
+		value, err := toCtyValue(tree[key])
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		body.SetAttributeValue(key, value)
+	}
+
+	for _, key := range blockKeys {
+		block := body.AppendNewBlock(key, nil)
+		if err := writeHCLBody(block.Body(), tree[key].(map[string]any)); err != nil {
+			return fmt.Errorf("%s.%w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// toCtyValue converts a decoded TOML value to the closest cty value
+func toCtyValue(value any) (cty.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case string:
+		return cty.StringVal(v), nil
+	case bool:
+		return cty.BoolVal(v), nil
+	case int:
+		return cty.NumberIntVal(int64(v)), nil
+	case int64:
+		return cty.NumberIntVal(v), nil
+	case float64:
+		return cty.NumberFloatVal(v), nil
+	case time.Time:
+		return cty.StringVal(v.Format(time.RFC3339Nano)), nil
+	case []map[string]any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return toCtyValue(items)
+	case []any:
+		if len(v) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		items := make([]cty.Value, len(v))
+		for i, item := range v {
+			converted, err := toCtyValue(item)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			items[i] = converted
+		}
+		return cty.TupleVal(items), nil
+	case map[string]any:
+		if len(v) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		attrs := make(map[string]cty.Value, len(v))
+		for key, item := range v {
+			converted, err := toCtyValue(item)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			attrs[key] = converted
+		}
+		return cty.ObjectVal(attrs), nil
+	default:
+		return cty.StringVal(fmt.Sprintf("%v", v)), nil
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+// inputFormats lists the formats accepted by --input-format, in sniffing order
+var inputFormats = []string{"toml", "json", "yaml"}
+
+// readInput reads the named file, or standard input when filename is "-"
+func readInput(filename string) ([]byte, error) {
+	if filename != "-" {
+		return readFile(filename)
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read standard input: %w", err)
+	}
+
+	return data, nil
+}
+
+// resolveInputFormat picks the input format: an explicit --input-format wins,
+// then a recognised file extension, and otherwise the content is sniffed
+func resolveInputFormat(filename, override string, data []byte) (string, error) {
+	if override != "" {
+		override = strings.ToLower(override)
+		for _, format := range inputFormats {
+			if override == format {
+				return format, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported input format: %s (use toml, json, or yaml)", override)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".toml":
+		return "toml", nil
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	}
+
+	return sniffInputFormat(data)
+}
+
+// sniffInputFormat detects the format of extensionless input by trying TOML,
+// then JSON, then YAML. YAML only counts when it decodes to a mapping, since
+// almost any text is a valid YAML scalar.
+func sniffInputFormat(data []byte) (string, error) {
+	for _, format := range inputFormats {
+		if _, err := parseInput(data, format); err == nil {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not detect input format (expected TOML, JSON, or YAML; use --input-format)")
+}
+
+// parseInput decodes plaintext configuration in the given format into a tree
+func parseInput(data []byte, format string) (map[string]any, error) {
+	switch format {
+	case "toml":
+		result, err := viola.Load(data, viola.Options{}) // No keys for loading
+		if err != nil {
+			return nil, err
+		}
+		return result.Tree, nil
+
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var tree map[string]any
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if tree == nil {
+			return nil, fmt.Errorf("failed to parse JSON: top level must be an object")
+		}
+		if decoder.More() {
+			return nil, fmt.Errorf("failed to parse JSON: unexpected data after top-level object")
+		}
+		return normalizeJSONNumbers(tree).(map[string]any), nil
+
+	case "yaml":
+		var tree map[string]any
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		if tree == nil {
+			return nil, fmt.Errorf("failed to parse YAML: top level must be a mapping")
+		}
+		return tree, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", format)
+	}
+}
+
+// inlineTables returns the inline tables of TOML input, to keep them inline
+// in the output. JSON and YAML have no such distinction.
+func inlineTables(data []byte, format string) [][]string {
+	if format != "toml" {
+		return nil
+	}
+	return viola.FindInlineTables(data)
+}
+
+// normalizeJSONNumbers converts json.Number values to int64 where they are
+// whole numbers and float64 otherwise, so integers stay integers in TOML
+func normalizeJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
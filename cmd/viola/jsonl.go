@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// jsonLine is one line of the jsonl output format
+type jsonLine struct {
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// writeJSONLines writes data as JSON Lines: one {"path": ..., "value": ...}
+// object per scalar leaf, in path order. Lines are encoded one at a time
+// rather than marshaling the output as one document, but data is already the
+// whole decrypted tree, so memory still grows with the file. Paths are dotted
+// with array indices in brackets, as in the flat format; empty tables and
+// arrays produce no lines.
+func writeJSONLines(w io.Writer, data any) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	encoder.SetEscapeHTML(false)
+	if err := encodeJSONLines(encoder, data, ""); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// streamJSONLines writes tree as JSON Lines to file (mode 0600, also when it
+// already exists), or to stdout when file is ""
+func streamJSONLines(tree any, file string) error {
+	if file == "" {
+		return writeJSONLines(os.Stdout, tree)
+	}
+	f, err := createPrivateFile(file)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONLines(f, tree); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// encodeJSONLines encodes the leaves of data below prefix, one line each
+func encodeJSONLines(encoder *json.Encoder, data any, prefix string) error {
+	switch v := data.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if err := encodeJSONLines(encoder, v[key], path); err != nil {
+				return err
+			}
+		}
+	case []map[string]any:
+		for i, value := range v {
+			if err := encodeJSONLines(encoder, value, fmt.Sprintf("%s[%d]", prefix, i)); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, value := range v {
+			if err := encodeJSONLines(encoder, value, fmt.Sprintf("%s[%d]", prefix, i)); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.Encode(jsonLine{Path: prefix, Value: v}); err != nil {
+			return fmt.Errorf("%s: %w", prefix, err)
+		}
+	}
+	return nil
+}
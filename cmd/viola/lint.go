@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// secretPatterns are well-known credential formats, checked in order
+var secretPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"PEM private key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"age secret key", regexp.MustCompile(`AGE-SECRET-KEY-1[0-9A-Z]{58}`)},
+	{"AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+}
+
+var (
+	// base64Token and hexToken match whole values drawn from those alphabets
+	base64Token = regexp.MustCompile(`^[A-Za-z0-9+/_-]{20,}={0,2}$`)
+	hexToken    = regexp.MustCompile(`^[0-9a-fA-F]{32,}$`)
+)
+
+// Minimum Shannon entropy, in bits per character, for a token to look random
+const (
+	base64EntropyThreshold = 4.0
+	hexEntropyThreshold    = 3.0
+)
+
+// lintFinding is a plaintext value that looks like a secret
+type lintFinding struct {
+	Path   string
+	Reason string
+}
+
+func lintCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "lint",
+		Usage:     "Warn about plaintext values that look like secrets",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "input-format",
+				Usage: "Input format: toml, json, yaml (default: from extension, sniffed for stdin)",
+			},
+			&cli.StringFlag{
+				Name:  "private-prefix",
+				Usage: "Fields with this prefix will be encrypted and are not reported (default: 'private_')",
+				Value: "private_",
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "Exit with an error if any secret-looking plaintext is found",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output",
+			},
+		},
+		Action: lintAction,
+	}
+}
+
+func lintAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+	}
+
+	data, err := readInput(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+	}
+
+	format, err := resolveInputFormat(filename, c.String("input-format"), data)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), 1)
+	}
+
+	// Encrypted fields stay armored without keys, and armor is never reported
+	tree, err := parseInput(data, format)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing %s: %v", strings.ToUpper(format), err)), 1)
+	}
+
+	findings := lintSecrets(tree, c.String("private-prefix"))
+
+	for _, finding := range findings {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("⚠ %s: possible %s in plaintext", finding.Path, finding.Reason)))
+	}
+
+	if len(findings) == 0 {
+		if !c.Bool("quiet") {
+			fmt.Println(successStyle.Render("✓ No plaintext secrets found"))
+		}
+		return nil
+	}
+
+	if c.Bool("strict") {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %d plaintext value(s) look like secrets", len(findings))), 1)
+	}
+	return nil
+}
+
+// lintSecrets reports plaintext string values in tree that look like secrets.
+// Fields under a key with the private prefix are skipped, since encrypt will
+// encrypt them. Findings are sorted by path.
+func lintSecrets(tree any, prefix string) []lintFinding {
+	fields := walk.FindFields(tree, func(path []string, key string, value any) bool {
+		if hasPrivateAncestor(append(path[:len(path):len(path)], key), prefix) {
+			return false
+		}
+		strValue, ok := value.(string)
+		return ok && secretReason(strValue) != ""
+	})
+
+	findings := make([]lintFinding, 0, len(fields))
+	for _, field := range fields {
+		findings = append(findings, lintFinding{
+			Path:   strings.Join(field.Path, "."),
+			Reason: secretReason(field.Value.(string)),
+		})
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Path < findings[j].Path
+	})
+	return findings
+}
+
+// hasPrivateAncestor reports whether any key along path starts with prefix
+func hasPrivateAncestor(path []string, prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+	for _, key := range path {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretReason describes why value looks like a secret, or returns "" if it doesn't
+func secretReason(value string) string {
+	if isArmoredData(value) {
+		return ""
+	}
+
+	for _, pattern := range secretPatterns {
+		if pattern.re.MatchString(value) {
+			return pattern.name
+		}
+	}
+
+	switch {
+	case hexToken.MatchString(value) && shannonEntropy(value) >= hexEntropyThreshold:
+		return "high-entropy hex string"
+	case base64Token.MatchString(value) && hasLetterAndDigit(value) && shannonEntropy(value) >= base64EntropyThreshold:
+		return "high-entropy string"
+	}
+	return ""
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// hasLetterAndDigit reports whether s contains at least one letter and one digit
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.IndexFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }) >= 0
+}
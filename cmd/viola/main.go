@@ -2,20 +2,35 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
+	"filippo.io/age"
 	"github.com/BurntSushi/toml"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 
+	"github.com/andreweick/viola/internal/walk"
 	"github.com/andreweick/viola/pkg/enc"
+	"github.com/andreweick/viola/pkg/serve"
 	"github.com/andreweick/viola/pkg/viola"
 )
 
@@ -48,6 +63,21 @@ var (
 			Padding(1, 2)
 )
 
+// version is reported by --version and recorded by encrypt --comment
+const version = "0.1.0"
+
+// Exit codes shared by the commands. Error messages always go to stderr
+// (urfave/cli prints the message of an exit error there).
+const (
+	// exitUserError covers bad arguments, unreadable or invalid input, missing
+	// keys, and failed checks
+	exitUserError = 1
+
+	// exitInternalError means viola itself failed, e.g. it could not format
+	// output it produced
+	exitInternalError = 2
+)
+
 func main() {
 	app := &cli.App{
 		Name:  "viola",
@@ -57,12 +87,21 @@ func main() {
 Like Shakespeare's Viola, who conceals her identity to safely move between worlds,
 this tool helps your configs take on a safe, portable form while keeping their
 secrets hidden from prying eyes.`),
-		Version: "0.1.0",
+		Version: version,
 		Commands: []*cli.Command{
 			readCommand(),
 			encryptCommand(),
+			decryptCommand(),
+			renderCommand(),
+			editCommand(),
 			inspectCommand(),
 			verifyCommand(),
+			planRotateCommand(),
+			lintCommand(),
+			signCommand(),
+			verifySignatureCommand(),
+			serveCommand(),
+			pubkeyCommand(),
 		},
 	}
 
@@ -74,7 +113,7 @@ secrets hidden from prying eyes.`),
 func readCommand() *cli.Command {
 	return &cli.Command{
 		Name:    "read",
-		Aliases: []string{"decrypt", "show", "view"},
+		Aliases: []string{"show", "view"},
 		Usage:   "Read and decrypt a TOML configuration file",
 		Flags: []cli.Flag{
 			&cli.StringSliceFlag{
@@ -83,11 +122,19 @@ func readCommand() *cli.Command {
 				Usage:   "Path to age identity file",
 				Value:   cli.NewStringSlice(),
 			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
 			&cli.StringFlag{
 				Name:    "key",
 				Aliases: []string{"k"},
 				Usage:   "Inline age identity key (insecure, for testing)",
 			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
 			&cli.BoolFlag{
 				Name:  "passphrase",
 				Usage: "Prompt for passphrase interactively",
@@ -96,23 +143,59 @@ func readCommand() *cli.Command {
 				Name:  "passphrase-file",
 				Usage: "Read passphrase from file (first line)",
 			},
+			&cli.BoolFlag{
+				Name:  "passphrase-raw",
+				Usage: "Use the whole --passphrase-file verbatim instead of its trimmed first line",
+			},
 			&cli.StringFlag{
 				Name:  "passphrase-env",
 				Usage: "Read passphrase from environment variable",
 			},
+			&cli.IntFlag{
+				Name:  "passphrase-fd",
+				Usage: "Read passphrase from this open file descriptor (first line)",
+			},
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
-				Usage:   "Output format: toml, json, yaml, env, flat",
+				Usage:   "Output format: toml, json, jsonl, yaml, env, flat, hcl, ini, properties",
 				Value:   "toml",
 			},
+			&cli.StringFlag{
+				Name:  "output-file",
+				Usage: "Write to this file (mode 0600) instead of stdout, in the format its extension names unless --output is given",
+			},
 			&cli.BoolFlag{
 				Name:  "raw",
 				Usage: "Show raw encrypted values without decrypting",
 			},
+			&cli.StringFlag{
+				Name:  "strip-prefix",
+				Usage: "Remove this prefix from keys in the output (e.g. 'private_')",
+			},
+			&cli.StringFlag{
+				Name:  "out-dir",
+				Usage: "Write each value to its own file under this directory instead of printing",
+			},
 			&cli.StringFlag{
 				Name:  "path",
-				Usage: "Extract specific path (dot notation: server.private_key)",
+				Usage: "Extract specific path (dot notation: server.private_key, servers[name=prod].private_key)",
+			},
+			&cli.BoolFlag{
+				Name:  "redact",
+				Usage: "Replace every encrypted field's value with *** in the output",
+			},
+			&cli.BoolFlag{
+				Name:  "redact-length",
+				Usage: "Like --redact, but with one * per character of the value",
+			},
+			&cli.StringSliceFlag{
+				Name:  "only",
+				Usage: "Show only paths matching this glob ('*' matches one level, '**' any depth; repeatable)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Hide paths matching this glob (same syntax as --only; repeatable)",
 			},
 			&cli.BoolFlag{
 				Name:  "private-only",
@@ -130,6 +213,10 @@ func readCommand() *cli.Command {
 				Name:  "no-color",
 				Usage: "Disable colored output",
 			},
+			&cli.BoolFlag{
+				Name:  "null",
+				Usage: "With -o env or flat, end each record with a NUL byte instead of a newline, for values that contain newlines",
+			},
 			&cli.BoolFlag{
 				Name:    "quiet",
 				Aliases: []string{"q"},
@@ -140,6 +227,18 @@ func readCommand() *cli.Command {
 				Aliases: []string{"v"},
 				Usage:   "Show detailed decryption info",
 			},
+			&cli.BoolFlag{
+				Name:  "fail-on-undecryptable",
+				Usage: "Exit with an error if any encrypted field could not be decrypted",
+			},
+			&cli.BoolFlag{
+				Name:  "explain-decrypt",
+				Usage: "Trace each identity tried on each encrypted field to stderr (implies --verbose)",
+			},
+			&cli.BoolFlag{
+				Name:  "watch",
+				Usage: "Re-read and reprint whenever the file changes (Ctrl+C to stop)",
+			},
 		},
 		Action: readAction,
 	}
@@ -149,17 +248,71 @@ func encryptCommand() *cli.Command {
 	return &cli.Command{
 		Name:    "encrypt",
 		Aliases: []string{"enc", "generate"},
-		Usage:   "Encrypt a TOML configuration file",
+		Usage:   "Encrypt a TOML, JSON, or YAML configuration into encrypted TOML",
 		Flags: []cli.Flag{
 			&cli.StringSliceFlag{
 				Name:    "recipients",
 				Aliases: []string{"r"},
-				Usage:   "Path to recipients file containing age public keys",
+				Usage:   "Path or HTTPS URL of a recipients file containing age public keys",
 			},
 			&cli.StringFlag{
 				Name:  "recipients-inline",
 				Usage: "Comma-separated age public keys for encryption",
 			},
+			&cli.StringFlag{
+				Name:  "recipients-age-file",
+				Usage: "Path to a recipient alias file (lines of \"group = age1..., age1...\")",
+			},
+			&cli.StringSliceFlag{
+				Name:  "recipients-group",
+				Usage: "Encrypt to the recipients of a group in --recipients-age-file (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:  "keyring",
+				Usage: "HTTPS URL of a JSON keyring ([{\"name\":...,\"key\":\"age1...\"}])",
+			},
+			&cli.StringFlag{
+				Name:  "keyring-pin",
+				Usage: "Hex SHA-256 of the TLS certificate of the --keyring or --recipients URL server",
+			},
+			&cli.DurationFlag{
+				Name:  "keyring-timeout",
+				Usage: "Timeout for fetching the keyring or a --recipients URL",
+				Value: 10 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "keyring-cache-dir",
+				Usage: "Directory caching fetched --keyring and --recipients URLs, used when the server is unreachable",
+			},
+			&cli.DurationFlag{
+				Name:  "keyring-cache-ttl",
+				Usage: "How long a cached --keyring or --recipients URL is used without fetching (0 always fetches)",
+			},
+			&cli.BoolFlag{
+				Name:  "insecure-http",
+				Usage: "Allow plain http:// for --keyring and --recipients URLs (trusted networks only)",
+			},
+			&cli.BoolFlag{
+				Name:  "recipients-self",
+				Usage: "Also encrypt to the recipients derived from --identity and --identity-dir",
+			},
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age identity file (used with --recipients-self, --changed-only, and --verify)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory of identity files, all loaded as with --identity (used with --recipients-self, --changed-only, and --verify)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Encrypt with a passphrase instead of recipients (prompts twice to confirm)",
+			},
+			&cli.StringFlag{
+				Name:  "input-format",
+				Usage: "Input format: toml, json, yaml (default: from extension, sniffed for stdin)",
+			},
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
@@ -170,19 +323,121 @@ func encryptCommand() *cli.Command {
 				Aliases: []string{"f"},
 				Usage:   "Overwrite output file if it exists",
 			},
+			&cli.BoolFlag{
+				Name:  "recursive",
+				Usage: "Encrypt every .toml file under the directory argument, in place or into --output-dir",
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "With --recursive, write encrypted files to this directory, mirroring the input tree",
+			},
+			&cli.BoolFlag{
+				Name:    "in-place",
+				Aliases: []string{"I"},
+				Usage:   "Replace the input file with the encrypted output (atomically; TOML input only)",
+			},
+			&cli.BoolFlag{
+				Name:  "backup",
+				Usage: "Copy an existing output file to <output>.bak before overwriting it (not with --in-place, whose input is plaintext)",
+			},
 			&cli.StringFlag{
 				Name:  "private-prefix",
 				Usage: "Prefix for fields to encrypt (default: 'private_')",
 				Value: "private_",
 			},
+			&cli.StringFlag{
+				Name:  "private-suffix",
+				Usage: "Also encrypt fields whose key ends with this suffix (e.g. '_secret')",
+			},
+			&cli.StringFlag{
+				Name:  "recipient-meta",
+				Usage: "TOML file of recipient labels and expiry dates to write as comments above encrypted fields",
+			},
+			&cli.StringFlag{
+				Name:  "recipients-out",
+				Usage: "Write the recipients the file was encrypted to into this file, one per line",
+			},
+			&cli.BoolFlag{
+				Name:  "compress",
+				Usage: "Gzip each value before encrypting when that makes it smaller",
+			},
+			&cli.StringFlag{
+				Name:  "field-encoding",
+				Usage: "Serialization of non-string values before encrypting: json, or gob to keep integer types",
+				Value: "json",
+			},
+			&cli.IntFlag{
+				Name:  "armor-columns",
+				Usage: "Line width of armored blocks (0: age default of 64, -1: no wrapping)",
+			},
+			&cli.BoolFlag{
+				Name:  "single-line",
+				Usage: "Write each encrypted field on one line (viola:<base64>) instead of an armored block",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-empty",
+				Usage: "Leave empty-string fields plaintext instead of encrypting them",
+			},
 			&cli.BoolFlag{
 				Name:  "dry-run",
 				Usage: "Show what would be encrypted without doing it",
 			},
+			&cli.StringFlag{
+				Name:  "encrypt-regex",
+				Usage: "Also encrypt fields whose key matches this regular expression",
+			},
+			&cli.StringSliceFlag{
+				Name:  "encrypt-path",
+				Usage: "Also encrypt the field at this dotted path (can be repeated)",
+			},
+			&cli.StringFlag{
+				Name:  "fields-from",
+				Usage: "Manifest of dotted field paths to encrypt, one per line (ignores --private-prefix, --private-suffix, and a discovered " + viola.RCFileName + ")",
+			},
+			&cli.StringFlag{
+				Name:  "rules",
+				Usage: "Rules file of \"<path-prefix> <match>\" lines choosing what to encrypt per subtree",
+			},
+			&cli.StringFlag{
+				Name:  "violarc",
+				Usage: "Policy file of encryption rules to add (default: " + viola.RCFileName + " in the working directory, if any, unless --fields-from is given)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-violarc",
+				Usage: "Ignore the " + viola.RCFileName + " file in the working directory",
+			},
+			&cli.IntFlag{
+				Name:  "min-recipients",
+				Usage: "Fail unless at least this many distinct X25519 recipients are resolved (a passphrase doesn't count)",
+			},
+			&cli.StringFlag{
+				Name:  "comment",
+				Usage: "Start the output with a comment block: this text (may be empty), then the time, viola version, and recipient count",
+			},
+			&cli.BoolFlag{
+				Name:  "no-encrypt",
+				Usage: "Only parse and re-serialize the input as TOML, leaving every field as-is (no recipients needed)",
+			},
+			&cli.BoolFlag{
+				Name:  "verify",
+				Usage: "Check that --identity (or the passphrase) can decrypt the output before writing it",
+			},
+			&cli.BoolFlag{
+				Name:  "changed-only",
+				Usage: "Reuse existing ciphertext in --output for unchanged fields (needs --identity or --identity-dir)",
+			},
+			&cli.BoolFlag{
+				Name:  "sort-recipients",
+				Usage: "Encrypt to recipients in sorted order, so reordering a recipients file doesn't change the output",
+			},
 			&cli.BoolFlag{
 				Name:  "stats",
 				Usage: "Show encryption statistics",
 			},
+			&cli.BoolFlag{
+				Name:  "full-keys",
+				Usage: "Show complete recipient keys instead of short IDs",
+			},
 			&cli.BoolFlag{
 				Name:    "quiet",
 				Aliases: []string{"q"},
@@ -223,6 +478,74 @@ func inspectCommand() *cli.Command {
 				Name:  "check-recipient",
 				Usage: "Check if recipient can decrypt",
 			},
+			&cli.StringSliceFlag{
+				Name:  "recipient-labels",
+				Usage: "Recipients file whose comment lines label the keys below them in --recipients and --audiences output (can be repeated)",
+			},
+			&cli.BoolFlag{
+				Name:  "tree",
+				Usage: "Show the full structure as a tree with encrypted markers",
+			},
+			&cli.BoolFlag{
+				Name:  "versions",
+				Usage: "Show the age format version and stanza types of each field",
+			},
+			&cli.BoolFlag{
+				Name:  "audiences",
+				Usage: "Group fields by their exact recipient set and flag outliers",
+			},
+			&cli.BoolFlag{
+				Name:  "full-keys",
+				Usage: "Show complete recipient keys instead of short IDs",
+			},
+			&cli.BoolFlag{
+				Name:  "types",
+				Usage: "Decrypt each field and show the type of its value, without printing it (needs identities)",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output field counts and each encrypted field's armor size and stanzas as JSON (ignores other display flags)",
+			},
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age identity file (for --types)",
+				Value:   cli.NewStringSlice(),
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Inline age identity key (insecure, for testing)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Prompt for passphrase interactively",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-file",
+				Usage: "Read passphrase from file (first line)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase-raw",
+				Usage: "Use the whole --passphrase-file verbatim instead of its trimmed first line",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "Read passphrase from environment variable",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress the banner",
+			},
 		},
 		Action: inspectAction,
 	}
@@ -238,6 +561,14 @@ func verifyCommand() *cli.Command {
 				Aliases: []string{"i"},
 				Usage:   "Identity to verify against",
 			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
 			&cli.BoolFlag{
 				Name:  "check-all",
 				Usage: "Verify all encrypted fields are decryptable",
@@ -250,89 +581,304 @@ func verifyCommand() *cli.Command {
 				Name:  "check-armor",
 				Usage: "Verify armor blocks are valid",
 			},
+			&cli.BoolFlag{
+				Name:  "check-roundtrip",
+				Usage: "Decrypt, re-save, and reload the file, failing on any field whose value or type changes",
+			},
+			&cli.StringFlag{
+				Name:  "check-recipients",
+				Usage: "Check that every line of a recipients file parses, instead of verifying a TOML file",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Emit a machine-readable JSON report",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Only print failures and warnings; the exit code reports the result",
+			},
 		},
 		Action: verifyAction,
 	}
 }
 
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Decrypt once and serve values by path over a Unix domain socket",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "socket",
+				Usage:    "Path of the Unix domain socket to create (mode 0600)",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age identity file",
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Inline age identity key (insecure, for testing)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Prompt for passphrase interactively",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-file",
+				Usage: "Read passphrase from file (first line)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase-raw",
+				Usage: "Use the whole --passphrase-file verbatim instead of its trimmed first line",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "Read passphrase from environment variable",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output",
+			},
+		},
+		Action: serveAction,
+	}
+}
+
+func pubkeyCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "pubkey",
+		Aliases:   []string{"recipients-from-identity"},
+		Usage:     "Print the public recipient for each identity",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age or SSH identity file",
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory of identity files, all loaded as with --identity",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Inline age identity key (insecure, for testing)",
+			},
+		},
+		Action: pubkeyAction,
+	}
+}
+
 func readAction(c *cli.Context) error {
 	filename := c.Args().First()
 	if filename == "" {
-		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), exitUserError)
+	}
+
+	// Build key sources from CLI flags
+	keySources, err := buildKeySources(c)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), exitUserError)
 	}
 
+	// The trace and each watch refresh load identities again, so only ask for a passphrase once
+	explain := c.Bool("explain-decrypt") && !c.Bool("quiet")
+	if (explain || c.Bool("watch")) && keySources.PassphraseProvider != nil {
+		keySources.PassphraseProvider = cachePassphrase(keySources.PassphraseProvider)
+	}
+
+	if c.Bool("watch") {
+		if filename == "-" {
+			return cli.NewExitError(errorStyle.Render("Error: --watch needs a file, not stdin"), exitUserError)
+		}
+		return watchRead(c, filename, keySources)
+	}
+
+	return readOnce(c, filename, keySources, nil)
+}
+
+// readOnce runs the read pipeline once: load, decrypt, filter, and print. A
+// non-nil cache keeps plaintext between runs, so unchanged fields aren't
+// decrypted again.
+func readOnce(c *cli.Context, filename string, keySources enc.KeySources, cache viola.DecryptCache) error {
 	if !c.Bool("quiet") {
 		fmt.Print(headerStyle.Render(" READ COMMAND "))
 		fmt.Println()
 		fmt.Println()
 	}
 
-	// Read the TOML file
-	data, err := readFile(filename)
-	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
-	}
-
-	// Build key sources from CLI flags
-	keySources, err := buildKeySources(c)
+	// Read the TOML file, from stdin when the filename is "-"
+	data, err := readInput(filename)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
 	}
 
+	explain := c.Bool("explain-decrypt") && !c.Bool("quiet")
 
 	// Configure viola options
 	opts := viola.Options{
-		Keys: keySources,
+		Keys:         keySources,
+		Logger:       verboseLogger(c),
+		DecryptCache: cache,
 	}
 
 	// Load and decrypt the configuration
 	result, err := viola.Load(data, opts)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading configuration: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading configuration: %v", err)), exitUserError)
 	}
 
-	// Handle raw output (show encrypted values without decrypting)
-	if c.Bool("raw") {
-		// Parse TOML without decryption - just read the raw file
-		rawResult, err := viola.Load(data, viola.Options{}) // No keys
-		if err != nil {
-			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing file: %v", err)), 1)
+	// Damaged blocks stay in the output as-is, so point them out
+	if !c.Bool("quiet") {
+		for _, field := range result.Fields {
+			if errors.Is(field.DecryptErr, viola.ErrMalformedArmor) {
+				fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: %s has a malformed armor block (marker missing or body not base64)", strings.Join(field.Path, "."))))
+			}
 		}
-		rawData, err := formatOutput(rawResult.Tree, "toml", c.Bool("no-color"))
+	}
+
+	if explain {
+		identities, err := keySources.LoadIdentities()
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading identities: %v", err)), exitUserError)
+		}
+		for _, line := range explainDecryptTrace(result.Fields, identities) {
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}
+
+	// Refuse to emit a tree that still contains armored fields
+	if c.Bool("fail-on-undecryptable") && !c.Bool("raw") {
+		if failed := undecryptablePaths(result.Fields); len(failed) > 0 {
+			msg := fmt.Sprintf("Error: %d encrypted field(s) could not be decrypted:\n  %s", len(failed), strings.Join(failed, "\n  "))
+			return cli.NewExitError(errorStyle.Render(msg), exitUserError)
+		}
+	}
+
+	// Handle raw output (show encrypted values without decrypting)
+	if c.Bool("raw") {
+		// Parse TOML without decryption - just read the raw file
+		rawResult, err := viola.Load(data, viola.Options{}) // No keys
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing file: %v", err)), exitUserError)
+		}
+		rawData, err := formatOutput(rawResult.Tree, "toml", c.Bool("no-color"))
 		if err != nil {
-			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), 1)
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), exitInternalError)
+		}
+		// Re-serializing drops comments; keep the header, e.g. from encrypt --comment
+		if rawResult.HeaderComment != "" {
+			for _, line := range strings.Split(rawResult.HeaderComment, "\n") {
+				fmt.Println(strings.TrimRight("# "+line, " "))
+			}
+			fmt.Println()
 		}
 		fmt.Print(string(rawData))
 		return nil
 	}
 
-	// Filter fields if requested
+	// Mask secrets first: the field paths are those of the loaded tree, and
+	// the filters below compact arrays, so afterwards they'd mask the wrong
+	// elements. Doing it before --path also keeps an extracted secret masked.
 	tree := result.Tree
+	if c.Bool("redact") || c.Bool("redact-length") {
+		redactFields(tree, result.Fields, c.Bool("redact-length"))
+	}
+
+	// Filter fields if requested
 	if c.Bool("private-only") || c.Bool("public-only") {
 		tree = filterFields(tree, result.Fields, c.Bool("private-only"))
 	}
 
+	// Narrow to (or drop) subtrees by path glob
+	if only, exclude := c.StringSlice("only"), c.StringSlice("exclude"); len(only) > 0 || len(exclude) > 0 {
+		tree = filterByGlobs(tree, only, exclude)
+	}
+
 	// Extract specific path if requested
 	if pathStr := c.String("path"); pathStr != "" {
-		path := strings.Split(pathStr, ".")
-		value, found := extractPath(tree, path)
+		value, found := walk.GetValueBySelector(tree, pathStr)
 		if !found {
-			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Path not found: %s", pathStr)), 1)
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Path not found: %s", pathStr)), exitUserError)
 		}
 		tree = map[string]any{pathStr: value}
 	}
 
+	// Rename keys last, so filtering and --path see the original names
+	if prefix := c.String("strip-prefix"); prefix != "" {
+		tree, err = viola.TransformKeys(tree, viola.StripKeyPrefix(prefix))
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+		}
+	}
+
+	if outDir := c.String("out-dir"); outDir != "" {
+		count, err := writeOutDir(tree, outDir)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing files: %v", err)), exitUserError)
+		}
+		if !c.Bool("quiet") {
+			fmt.Printf("✓ Wrote %d files to %s\n", count, outDir)
+		}
+		return nil
+	}
+
 	// Format output
-	outputFormat := c.String("output")
-	output, err := formatOutput(tree, outputFormat, c.Bool("no-color"))
+	outputFormat, outputFile, err := readOutputTarget(c)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+	}
+	// Write JSON Lines straight to their destination instead of building the output
+	if outputFormat == "jsonl" && !c.Bool("null") {
+		if err := streamJSONLines(tree, outputFile); err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing output: %v", err)), exitUserError)
+		}
+		if outputFile != "" && !c.Bool("quiet") {
+			fmt.Printf("✓ Wrote %s (%s)\n", outputFile, outputFormat)
+		}
+		return nil
+	}
+
+	var output []byte
+	if c.Bool("null") {
+		output, err = formatNullDelimited(tree, outputFormat)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+		}
+	} else {
+		output, err = formatOutput(tree, outputFormat, c.Bool("no-color"))
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), exitInternalError)
+		}
 	}
 
-	fmt.Print(string(output))
+	if outputFile != "" {
+		if err := writePrivateFile(outputFile, output); err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing output: %v", err)), exitUserError)
+		}
+		if !c.Bool("quiet") {
+			fmt.Printf("✓ Wrote %s (%s)\n", outputFile, outputFormat)
+		}
+	} else {
+		fmt.Print(string(output))
+	}
 
 	// Show verbose information if requested
-	if c.Bool("verbose") && !c.Bool("quiet") {
+	if (c.Bool("verbose") || explain) && !c.Bool("quiet") {
 		fmt.Fprintf(os.Stderr, "\n")
 		fmt.Fprintf(os.Stderr, infoStyle.Render(fmt.Sprintf("✓ Processed %d encrypted fields", countEncryptedFields(result.Fields))))
 		fmt.Fprintf(os.Stderr, "\n")
@@ -344,7 +890,24 @@ func readAction(c *cli.Context) error {
 func encryptAction(c *cli.Context) error {
 	filename := c.Args().First()
 	if filename == "" {
-		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), exitUserError)
+	}
+
+	if c.Bool("recursive") {
+		return encryptDirectory(c, filename)
+	}
+
+	if c.Bool("in-place") {
+		if c.String("output") != "" {
+			return cli.NewExitError(errorStyle.Render("Error: --in-place cannot be combined with --output"), exitUserError)
+		}
+		if filename == "-" {
+			return cli.NewExitError(errorStyle.Render("Error: --in-place needs a file, not stdin"), exitUserError)
+		}
+		// The backup of the input would be the very plaintext being encrypted
+		if c.Bool("backup") && !c.Bool("no-encrypt") {
+			return cli.NewExitError(errorStyle.Render("Error: --in-place --backup would leave the unencrypted original in a .bak file; the replacement is atomic, so no backup is needed"), exitUserError)
+		}
 	}
 
 	if !c.Bool("quiet") {
@@ -353,75 +916,148 @@ func encryptAction(c *cli.Context) error {
 		fmt.Println()
 	}
 
-	// Read the plain TOML file
-	data, err := readFile(filename)
+	// Read the plain configuration, from stdin when the filename is "-"
+	data, err := readInput(filename)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
 	}
 
-	// Build recipients from CLI flags
-	recipients, err := buildRecipients(c)
+	inputFormat, err := resolveInputFormat(filename, c.String("input-format"), data)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up recipients: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+	}
+	if c.Bool("in-place") && inputFormat != "toml" {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: --in-place would replace %s input with TOML; use --output instead", strings.ToUpper(inputFormat))), exitUserError)
+	}
+
+	// Formatter mode: parse and re-serialize, leaving every field as it is
+	if c.Bool("no-encrypt") {
+		if c.Bool("passphrase") || c.Bool("dry-run") || c.Bool("verify") || c.Bool("changed-only") {
+			return cli.NewExitError(errorStyle.Render("Error: --no-encrypt cannot be combined with --passphrase, --dry-run, --verify, or --changed-only"), exitUserError)
+		}
+
+		tree, err := parseInput(data, inputFormat)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing %s: %v", strings.ToUpper(inputFormat), err)), exitUserError)
+		}
+
+		formatted, err := viola.FormatWithInlineTables(tree, inlineTables(data, inputFormat))
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting configuration: %v", err)), exitInternalError)
+		}
+
+		_, err = writeEncryptOutput(c, filename, formatted, "Formatted configuration")
+		return err
+	}
+
+	// Build recipients from CLI flags, or prompt for a passphrase
+	recipients, passphraseProvider, err := encryptRecipients(c)
+	if err != nil {
+		return err
 	}
 
 	// Configure viola options
-	opts := viola.Options{
-		Keys: enc.KeySources{
-			Recipients: recipients,
-		},
-		PrivatePrefix: c.String("private-prefix"),
+	opts, err := encryptOptions(c, recipients, passphraseProvider)
+	if err != nil {
+		return err
+	}
+	opts.InlineTables = inlineTables(data, inputFormat)
+
+	// Reuse unchanged ciphertext from the existing output file
+	if c.Bool("changed-only") {
+		previousTree, err := loadPreviousTree(c)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading previous output: %v", err)), exitUserError)
+		}
+		opts.PreviousTree = previousTree
+	}
+
+	// Parse the plain configuration (no decryption needed)
+	tree, err := parseInput(data, inputFormat)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing %s: %v", strings.ToUpper(inputFormat), err)), exitUserError)
 	}
 
-	// Load the plain configuration (no decryption needed)
-	result, err := viola.Load(data, viola.Options{}) // No keys for loading
+	// Select the fields to encrypt
+	opts.ShouldEncrypt, err = encryptRule(c, tree)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing TOML: %v", err)), 1)
+		return err
 	}
 
 	if c.Bool("dry-run") {
-		// Show what would be encrypted
-		encryptedFields := findFieldsToEncrypt(result.Tree, []string{}, c.String("private-prefix"))
+		// Compare against the existing output, if any, to show what changes
+		var previous map[string]any
+		if outputFile := c.String("output"); outputFile != "" {
+			if existing, err := os.ReadFile(outputFile); err == nil {
+				if parsed, err := viola.Load(existing, viola.Options{}); err == nil {
+					previous = parsed.Tree
+				}
+			}
+		}
+
+		// Empty fields --skip-empty leaves plaintext are out of the preview, but
+		// they still count as matched when looking for unmatched secrets
+		previewRule := opts.ShouldEncrypt
+		if opts.SkipEmpty {
+			previewRule = func(path []string, key string, value any) bool {
+				return !viola.IsEmptyValue(value) && opts.ShouldEncrypt(path, key, value)
+			}
+		}
+		preview := previewEncryption(tree, previewRule, previous)
+		secrets := unmatchedSecretFields(tree, opts.ShouldEncrypt)
 
 		if !c.Bool("quiet") {
-			if len(encryptedFields) == 0 {
-				fmt.Println(infoStyle.Render("No fields found with the specified prefix"))
+			toEncrypt := 0
+			for _, entry := range preview {
+				if entry.Status == previewEncrypt || entry.Status == previewNew {
+					toEncrypt++
+				}
+			}
+
+			if len(preview) == 0 {
+				fmt.Println(infoStyle.Render("No fields found matching the encryption rules"))
 			} else {
-				fmt.Println(headerStyle.Render(fmt.Sprintf("Would encrypt %d fields:", len(encryptedFields))))
-				for _, field := range encryptedFields {
-					fmt.Printf("  - %s\n", strings.Join(field, "."))
+				fmt.Println(headerStyle.Render(fmt.Sprintf("Would encrypt %d fields:", toEncrypt)))
+				for _, entry := range preview {
+					fmt.Printf("  %s\n", describePreviewEntry(entry, c.String("output")))
 				}
 			}
 		}
+
+		for _, path := range secrets {
+			fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: %s looks like a secret but does not match the encryption rules", path)))
+		}
 		return nil
 	}
 
+	// Show a running count on the terminal; piped stderr stays clean, and
+	// verbose logging would break up the line
+	if !c.Bool("quiet") && opts.Logger == nil && term.IsTerminal(int(os.Stderr.Fd())) {
+		opts.OnField = progressReporter(os.Stderr)
+	}
+
 	// Encrypt the configuration
-	encryptedTOML, fields, err := viola.Save(result.Tree, opts)
+	encryptedTOML, fields, err := viola.Save(tree, opts)
+	if opts.OnField != nil {
+		clearProgress(os.Stderr)
+	}
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error encrypting configuration: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error encrypting configuration: %v", err)), exitUserError)
 	}
 
-	// Handle output
-	outputFile := c.String("output")
-	if outputFile != "" {
-		// Check if file exists and force flag
-		if _, err := os.Stat(outputFile); err == nil && !c.Bool("force") {
-			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Output file exists: %s (use --force to overwrite)", outputFile)), 1)
-		}
+	outputFile, err := writeEncryptOutput(c, filename, encryptedTOML, "Encrypted configuration")
+	if err != nil {
+		return err
+	}
 
-		// Write to file
-		err = os.WriteFile(outputFile, encryptedTOML, 0644)
-		if err != nil {
-			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing output file: %v", err)), 1)
+	// Record which recipients were used, for auditing
+	if recipientsOut := c.String("recipients-out"); recipientsOut != "" {
+		if err := os.WriteFile(recipientsOut, recipientsReport(fields, recipients), 0644); err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing recipients file: %v", err)), exitUserError)
 		}
-
-		if !c.Bool("quiet") {
-			fmt.Printf("✓ Encrypted configuration written to: %s\n", outputFile)
+		if !c.Bool("quiet") && outputFile != "" {
+			fmt.Printf("✓ Recipients written to: %s\n", recipientsOut)
 		}
-	} else {
-		// Write to stdout
-		fmt.Print(string(encryptedTOML))
 	}
 
 	// Show statistics if requested
@@ -436,8 +1072,18 @@ func encryptAction(c *cli.Context) error {
 		fmt.Fprintf(os.Stderr, "\n")
 		fmt.Fprintf(os.Stderr, successStyle.Render(fmt.Sprintf("✓ Encrypted %d fields", encryptedCount)))
 		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "Recipients: %d\n", countUniqueStrings(recipients))
+		if totalArmor, largest := armorSizes(fields); totalArmor > 0 {
+			fmt.Fprintf(os.Stderr, "Ciphertext size: %d bytes\n", totalArmor)
+			fmt.Fprintf(os.Stderr, "Largest encrypted field: %s (%d bytes, %d before encryption)\n",
+				strings.Join(largest.Path, "."), largest.ArmoredBytes, largest.PlaintextBytes)
+		}
 
 		if c.Bool("verbose") {
+			labels, _ := recipientLabels(c.StringSlice("recipients"))
+			for _, recipient := range uniqueStrings(recipients) {
+				fmt.Fprintf(os.Stderr, "  - %s\n", labeledKey(recipient, labels, c.Bool("full-keys")))
+			}
 			fmt.Fprintf(os.Stderr, "Encrypted fields:\n")
 			for _, field := range fields {
 				if field.WasEncrypted {
@@ -453,41 +1099,282 @@ func encryptAction(c *cli.Context) error {
 		fmt.Fprintf(os.Stderr, "\n")
 		fmt.Fprintf(os.Stderr, successStyle.Render(fmt.Sprintf("✓ Encrypted %d fields", encryptedCount)))
 		fmt.Fprintf(os.Stderr, "\n")
+		labels, _ := recipientLabels(c.StringSlice("recipients"))
+		for _, recipient := range uniqueStrings(recipients) {
+			fmt.Fprintf(os.Stderr, "  → %s\n", labeledKey(recipient, labels, c.Bool("full-keys")))
+		}
 	}
 
 	return nil
 }
 
+// encryptRecipients resolves the recipients of the encrypt flags, or prompts
+// for a passphrase (unless --dry-run), enforcing --min-recipients
+func encryptRecipients(c *cli.Context) ([]string, func() (string, error), error) {
+	var recipients []string
+	var passphraseProvider func() (string, error)
+	if c.Bool("passphrase") {
+		// age only allows a passphrase as the sole recipient
+		if len(c.StringSlice("recipients")) > 0 || c.String("recipients-inline") != "" || len(c.StringSlice("recipients-group")) > 0 || c.String("keyring") != "" || c.Bool("recipients-self") {
+			return nil, nil, cli.NewExitError(errorStyle.Render("Error: --passphrase cannot be combined with recipients"), exitUserError)
+		}
+		if !c.Bool("dry-run") {
+			passphrase, err := confirmPassphrase(readPassword)
+			if err != nil {
+				return nil, nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+			}
+			passphraseProvider = func() (string, error) { return passphrase, nil }
+		}
+	} else {
+		var err error
+		recipients, err = buildRecipients(c)
+		if err != nil {
+			return nil, nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up recipients: %v", err)), exitUserError)
+		}
+	}
+
+	// Guard against encrypting for too few people, e.g. only yourself
+	if minRecipients := c.Int("min-recipients"); minRecipients > 0 {
+		parsed, err := enc.KeySources{Recipients: recipients}.LoadRecipients()
+		if err != nil {
+			return nil, nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up recipients: %v", err)), exitUserError)
+		}
+		if count := enc.CountX25519Recipients(parsed); count < minRecipients {
+			msg := fmt.Sprintf("Error: %d distinct X25519 recipient(s) resolved, but --min-recipients requires %d", count, minRecipients)
+			return nil, nil, cli.NewExitError(errorStyle.Render(msg), exitUserError)
+		}
+	}
+
+	return recipients, passphraseProvider, nil
+}
+
+// encryptOptions builds the options of the encrypt flags that don't depend on
+// the input file: keys, field layout, and annotations
+func encryptOptions(c *cli.Context, recipients []string, passphraseProvider func() (string, error)) (viola.Options, error) {
+	opts := viola.Options{
+		Keys: enc.KeySources{
+			Recipients:         recipients,
+			PassphraseProvider: passphraseProvider,
+		},
+		PrivatePrefix:  c.String("private-prefix"),
+		PrivateSuffix:  c.String("private-suffix"),
+		Logger:         verboseLogger(c),
+		ArmorColumns:   c.Int("armor-columns"),
+		Compress:       c.Bool("compress"),
+		FieldEncoding:  viola.FieldEncoding(c.String("field-encoding")),
+		SortRecipients: c.Bool("sort-recipients"),
+		SingleLine:     c.Bool("single-line"),
+		SkipEmpty:      c.Bool("skip-empty"),
+	}
+	if c.IsSet("comment") {
+		opts.HeaderComment = encryptComment(c.String("comment"), recipients, c.Bool("passphrase"), time.Now())
+	}
+
+	if metaFile := c.String("recipient-meta"); metaFile != "" {
+		metaData, err := readFile(metaFile)
+		if err != nil {
+			return viola.Options{}, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading recipient metadata: %v", err)), exitUserError)
+		}
+		opts.RecipientMeta, err = viola.ParseRecipientMeta(metaData)
+		if err != nil {
+			return viola.Options{}, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+		}
+	}
+
+	// Identities are needed to reuse unchanged ciphertext and to verify the output
+	if c.Bool("changed-only") || c.Bool("verify") {
+		keySources, err := buildKeySources(c)
+		if err != nil {
+			return viola.Options{}, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), exitUserError)
+		}
+		keySources.Recipients = recipients
+		if passphraseProvider != nil {
+			// The confirmed passphrase also opens the previous output
+			keySources.PassphraseProvider = passphraseProvider
+		}
+		opts.Keys = keySources
+	}
+	opts.VerifyDecryptable = c.Bool("verify")
+
+	return opts, nil
+}
+
+// encryptRule returns the field selection rule of the encrypt flags, warning
+// about --fields-from and --encrypt-path entries that tree doesn't have
+func encryptRule(c *cli.Context, tree map[string]any) (func(path []string, key string, value any) bool, error) {
+	// Select fields: a manifest replaces the prefix and suffix rule, and the
+	// regex and path flags add to whichever of the two is in effect
+	var rules []func(path []string, key string, value any) bool
+	if manifestFile := c.String("fields-from"); manifestFile != "" {
+		paths, err := readFieldManifest(manifestFile)
+		if err != nil {
+			return nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading field manifest: %v", err)), exitUserError)
+		}
+		for _, missing := range viola.MissingPaths(tree, paths) {
+			fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: manifest path not found: %s", missing)))
+		}
+		rules = append(rules, viola.EncryptByPath(paths...))
+	} else {
+		rules = append(rules, viola.EncryptByPrefix(c.String("private-prefix")))
+		if suffix := c.String("private-suffix"); suffix != "" {
+			rules[0] = viola.EncryptAny(rules[0], viola.EncryptBySuffix(suffix))
+		}
+	}
+
+	// Per-subtree rules take precedence, falling back to the rule above
+	if rulesFile := c.String("rules"); rulesFile != "" {
+		encryptRules, err := readEncryptRules(rulesFile)
+		if err != nil {
+			return nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading rules: %v", err)), exitUserError)
+		}
+		rules[0] = viola.EncryptByRules(encryptRules, rules[0])
+	}
+
+	if pattern := c.String("encrypt-regex"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: invalid --encrypt-regex: %v", err)), exitUserError)
+		}
+		rules = append(rules, viola.EncryptByKeyRegex(re))
+	}
+
+	if paths := c.StringSlice("encrypt-path"); len(paths) > 0 {
+		for _, missing := range viola.MissingPaths(tree, paths) {
+			fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: --encrypt-path not found: %s", missing)))
+		}
+		rules = append(rules, viola.EncryptByPath(paths...))
+	}
+
+	// The repository's .violarc policy adds to all of the above, except that
+	// a manifest lists exactly the fields to encrypt, so only an explicit
+	// --violarc is combined with it
+	if c.String("fields-from") == "" || c.String("violarc") != "" {
+		rcRules, err := readRCRules(c)
+		if err != nil {
+			return nil, cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading %s: %v", viola.RCFileName, err)), exitUserError)
+		}
+		if rcRules != nil {
+			rules = append(rules, rcRules)
+		}
+	}
+
+	return viola.EncryptAny(rules...), nil
+}
+
+// encryptComment is the header comment for encrypt --comment: the user's text,
+// if any, then how the file was produced. It names how many recipients there
+// were, never who.
+func encryptComment(text string, recipients []string, passphrase bool, now time.Time) string {
+	audience := fmt.Sprintf("%d recipient(s)", countUniqueStrings(recipients))
+	if passphrase {
+		audience = "a passphrase"
+	}
+	produced := fmt.Sprintf("Encrypted with viola %s on %s for %s", version, now.UTC().Format(time.RFC3339), audience)
+	if text = strings.TrimSpace(text); text != "" {
+		return text + "\n" + produced
+	}
+	return produced
+}
+
+// writeEncryptOutput writes the encrypt command's result to --output, back to
+// the input for --in-place, or to stdout, returning the file written (if any).
+// what names the result in the success message.
+func writeEncryptOutput(c *cli.Context, filename string, data []byte, what string) (string, error) {
+	outputFile := c.String("output")
+	if c.Bool("in-place") {
+		outputFile = filename
+	}
+	if outputFile != "" {
+		// Check if file exists and force flag
+		if _, err := os.Stat(outputFile); err == nil && !c.Bool("force") && !c.Bool("in-place") {
+			return "", cli.NewExitError(errorStyle.Render(fmt.Sprintf("Output file exists: %s (use --force to overwrite)", outputFile)), exitUserError)
+		}
+
+		if c.Bool("backup") {
+			backup, err := backupFile(outputFile)
+			if err != nil {
+				return "", cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error backing up output file: %v", err)), exitUserError)
+			}
+			if backup != "" && !c.Bool("quiet") {
+				fmt.Printf("✓ Previous output backed up to: %s\n", backup)
+			}
+		}
+
+		// Write to file; the input is replaced atomically so a crash can't lose it
+		var err error
+		if c.Bool("in-place") {
+			err = writeFileAtomic(outputFile, data)
+		} else {
+			err = os.WriteFile(outputFile, data, 0644)
+		}
+		if err != nil {
+			return "", cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing output file: %v", err)), exitUserError)
+		}
+
+		if !c.Bool("quiet") {
+			fmt.Printf("✓ %s written to: %s\n", what, outputFile)
+		}
+	} else {
+		// Write to stdout
+		fmt.Print(string(data))
+	}
+
+	return outputFile, nil
+}
+
 func inspectAction(c *cli.Context) error {
 	filename := c.Args().First()
 	if filename == "" {
-		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), exitUserError)
 	}
 
-	fmt.Print(headerStyle.Render(" INSPECT COMMAND "))
-	fmt.Println()
-	fmt.Println()
+	jsonOutput := c.Bool("json")
+	if !jsonOutput && !c.Bool("quiet") {
+		fmt.Print(headerStyle.Render(" INSPECT COMMAND "))
+		fmt.Println()
+		fmt.Println()
+	}
 
-	// Read the TOML file
-	data, err := readFile(filename)
+	// Read the TOML file, from stdin when the filename is "-"
+	data, err := readInput(filename)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
 	}
 
 	// Parse TOML without decryption to find encrypted fields
 	result, err := viola.Load(data, viola.Options{}) // No keys - just parse
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing TOML: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing TOML: %v", err)), exitUserError)
+	}
+
+	// Labels for recipient keys, from the comments in recipients files
+	labels, err := recipientLabels(c.StringSlice("recipient-labels"))
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
 	}
 
 	// Find all encrypted fields
 	encryptedFields := findEncryptedFields(result.Tree, []string{})
 
+	if jsonOutput {
+		output, err := json.MarshalIndent(newInspectReport(filename, result.Tree, encryptedFields), "", "  ")
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), exitInternalError)
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+
 	if c.Bool("stats") {
+		total, encrypted, _ := viola.Stats(result.Tree)
 		fmt.Printf("File: %s\n", filename)
-		fmt.Printf("Total fields: %d\n", countAllFields(result.Tree))
-		fmt.Printf("Encrypted fields: %d\n", len(encryptedFields))
+		fmt.Printf("Total fields: %d\n", total)
+		fmt.Printf("Encrypted fields: %d\n", encrypted)
 		fmt.Printf("File size: %d bytes\n", len(data))
+		if totalArmor, largest := armorSizes(result.Fields); totalArmor > 0 {
+			fmt.Printf("Ciphertext size: %d bytes\n", totalArmor)
+			fmt.Printf("Largest encrypted field: %s (%d bytes)\n", strings.Join(largest.Path, "."), largest.ArmoredBytes)
+		}
 		fmt.Println()
 	}
 
@@ -508,12 +1395,21 @@ func inspectAction(c *cli.Context) error {
 			fmt.Println(infoStyle.Render("No encrypted fields found"))
 		} else {
 			fmt.Println(headerStyle.Render("Recipients per Field:"))
+			notes := recipientNotesByArmor(result.Fields)
+			now := time.Now()
 			for _, field := range encryptedFields {
 				fmt.Printf("  %s:\n", strings.Join(field.Path, "."))
 				recipients := extractRecipientsFromArmor(field.Armored)
-				if len(recipients) > 0 {
+				if fieldNotes := notes[field.Armored]; len(fieldNotes) > 0 {
+					for _, note := range fieldNotes {
+						if note.Label == "" {
+							note.Label = labels[note.Recipient]
+						}
+						fmt.Printf("    - %s\n", describeRecipientNote(note, now, c.Bool("full-keys")))
+					}
+				} else if len(recipients) > 0 {
 					for _, recipient := range recipients {
-						fmt.Printf("    - %s\n", recipient)
+						fmt.Printf("    - %s\n", labeledKey(recipient, labels, true))
 					}
 				} else {
 					fmt.Printf("    (could not extract recipients)\n")
@@ -523,37 +1419,104 @@ func inspectAction(c *cli.Context) error {
 		fmt.Println()
 	}
 
-	if qrField := c.String("qr"); qrField != "" {
-		path := strings.Split(qrField, ".")
-		for _, field := range encryptedFields {
-			if len(field.Path) == len(path) {
-				match := true
-				for i, part := range path {
-					if field.Path[i] != part {
-						match = false
-						break
-					}
-				}
-				if match {
-					fmt.Printf(headerStyle.Render("QR Code for %s:"), qrField)
-					fmt.Println()
-					fmt.Println(infoStyle.Render("QR code generation not yet implemented"))
-					fmt.Printf("Armored data (%d chars):\n%s\n", len(field.Armored), field.Armored)
-					return nil
-				}
-			}
+	if c.Bool("tree") {
+		fmt.Println(headerStyle.Render("Structure:"))
+		for _, line := range renderTree(result.Tree, "  ") {
+			fmt.Println(line)
 		}
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Encrypted field not found: %s", qrField)), 1)
+		fmt.Println()
 	}
 
-	// Default output if no specific flags
-	if !c.Bool("stats") && !c.Bool("fields") && !c.Bool("recipients") && c.String("qr") == "" {
-		fmt.Printf("File: %s\n", filename)
-		fmt.Printf("Encrypted fields: %d\n", len(encryptedFields))
-		if len(encryptedFields) > 0 {
-			fmt.Println("\nEncrypted field paths:")
-			for _, field := range encryptedFields {
-				fmt.Printf("  - %s\n", strings.Join(field.Path, "."))
+	if c.Bool("versions") {
+		if len(encryptedFields) == 0 {
+			fmt.Println(infoStyle.Render("No encrypted fields found"))
+		} else {
+			lines, warning := fieldVersionReport(encryptedFields)
+			fmt.Println(headerStyle.Render("Age Versions per Field:"))
+			for _, line := range lines {
+				fmt.Printf("  %s\n", line)
+			}
+			if warning != "" {
+				fmt.Println(errorStyle.Render("⚠ " + warning))
+			}
+		}
+		fmt.Println()
+	}
+
+	if c.Bool("audiences") {
+		if len(encryptedFields) == 0 {
+			fmt.Println(infoStyle.Render("No encrypted fields found"))
+		} else {
+			fmt.Println(headerStyle.Render("Audiences:"))
+			groups := groupAudiences(encryptedFields, recipientNotesByArmor(result.Fields))
+			for _, group := range groups {
+				for i, recipient := range group.Recipients {
+					group.Recipients[i] = labeledKey(recipient, labels, c.Bool("full-keys"))
+				}
+			}
+			for _, line := range audienceReport(groups) {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+		fmt.Println()
+	}
+
+	if c.Bool("types") {
+		if len(c.StringSlice("identity")) == 0 && c.String("identity-dir") == "" && c.String("key") == "" &&
+			!c.Bool("passphrase") && c.String("passphrase-file") == "" && c.String("passphrase-env") == "" {
+			return cli.NewExitError(errorStyle.Render("Error: --types needs an identity (--identity, --identity-dir, --key, or a passphrase flag)"), exitUserError)
+		}
+		keySources, err := buildKeySources(c)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), exitUserError)
+		}
+		decrypted, err := viola.Load(data, viola.Options{Keys: keySources})
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading configuration: %v", err)), exitUserError)
+		}
+
+		if len(decrypted.Fields) == 0 {
+			fmt.Println(infoStyle.Render("No encrypted fields found"))
+		} else {
+			fmt.Println(headerStyle.Render("Field Types:"))
+			for _, line := range fieldTypeReport(decrypted) {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+		fmt.Println()
+	}
+
+	if qrField := c.String("qr"); qrField != "" {
+		path := strings.Split(qrField, ".")
+		for _, field := range encryptedFields {
+			if len(field.Path) == len(path) {
+				match := true
+				for i, part := range path {
+					if field.Path[i] != part {
+						match = false
+						break
+					}
+				}
+				if match {
+					fmt.Printf(headerStyle.Render("QR Code for %s:"), qrField)
+					fmt.Println()
+					fmt.Println(infoStyle.Render("QR code generation not yet implemented"))
+					fmt.Printf("Armored data (%d chars):\n%s\n", len(field.Armored), field.Armored)
+					return nil
+				}
+			}
+		}
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Encrypted field not found: %s", qrField)), exitUserError)
+	}
+
+	// Default output if no specific flags
+	if !c.Bool("stats") && !c.Bool("fields") && !c.Bool("recipients") && !c.Bool("versions") && !c.Bool("audiences") && !c.Bool("tree") && !c.Bool("types") && c.String("qr") == "" {
+		fmt.Printf("File: %s\n", filename)
+		fmt.Printf("Encrypted fields: %d\n", len(encryptedFields))
+		if len(encryptedFields) > 0 {
+			fmt.Println("\nEncrypted field paths:")
+			for _, field := range encryptedFields {
+				fmt.Printf("  - %s\n", strings.Join(field.Path, "."))
 			}
 		}
 	}
@@ -561,33 +1524,236 @@ func inspectAction(c *cli.Context) error {
 	return nil
 }
 
+// inspectReport is the machine-readable result of inspect --json
+type inspectReport struct {
+	File            string         `json:"file"`
+	TotalFields     int            `json:"total_fields"`
+	EncryptedFields int            `json:"encrypted_fields"`
+	Fields          []inspectField `json:"fields"`
+}
+
+// inspectField describes an encrypted field from its armor alone
+type inspectField struct {
+	Path        string   `json:"path"`
+	ArmorBytes  int      `json:"armor_bytes"`
+	Version     string   `json:"version,omitempty"`
+	Stanzas     int      `json:"stanzas"`
+	StanzaTypes []string `json:"stanza_types,omitempty"`
+
+	// Error is set when the header can't be parsed, e.g. damaged armor
+	Error string `json:"error,omitempty"`
+}
+
+// newInspectReport describes tree and its encrypted fields without decrypting
+func newInspectReport(filename string, tree map[string]any, fields []encryptedField) inspectReport {
+	total, encrypted, _ := viola.Stats(tree)
+	report := inspectReport{
+		File:            filename,
+		TotalFields:     total,
+		EncryptedFields: encrypted,
+		Fields:          []inspectField{},
+	}
+
+	for _, field := range fields {
+		entry := inspectField{Path: strings.Join(field.Path, "."), ArmorBytes: len(field.Armored)}
+		header, err := enc.ParseHeader(field.Armored)
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Version = header.Version
+			entry.Stanzas = len(header.Stanzas)
+			entry.StanzaTypes = header.StanzaTypes()
+		}
+		report.Fields = append(report.Fields, entry)
+	}
+	return report
+}
+
+// verifyReport is the machine-readable result of the verify command
+type verifyReport struct {
+	File      string       `json:"file"`
+	Passed    bool         `json:"passed"`
+	Format    *verifyCheck `json:"format,omitempty"`
+	Armor     *verifyCheck `json:"armor,omitempty"`
+	Decrypt   *verifyCheck `json:"decrypt,omitempty"`
+	Roundtrip *verifyCheck `json:"roundtrip,omitempty"`
+
+	// Warnings don't affect Passed (e.g., expired recipient annotations, or
+	// fields written by a newer age format)
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// verifyCheck is the outcome of a single verify check
+type verifyCheck struct {
+	Passed      bool     `json:"passed"`
+	Message     string   `json:"message"`
+	FailedPaths []string `json:"failed_paths,omitempty"`
+}
+
+// roundtripChange is a leaf that verify --check-roundtrip found altered by a
+// re-save. It records types rather than values, which may be secret.
+type roundtripChange struct {
+	Path    string
+	Before  string // Type before the re-save, "" if the leaf appeared
+	After   string // Type after the re-save, "" if the leaf disappeared
+	Guessed bool   // Before was guessed from untagged plaintext
+}
+
+func (rc roundtripChange) String() string {
+	switch {
+	case rc.Guessed:
+		return fmt.Sprintf("%s: read as %s from untagged plaintext, which may not be its original type", rc.Path, rc.Before)
+	case rc.Before == "":
+		return fmt.Sprintf("%s: added (%s)", rc.Path, rc.After)
+	case rc.After == "":
+		return fmt.Sprintf("%s: lost (%s)", rc.Path, rc.Before)
+	case rc.Before != rc.After:
+		return fmt.Sprintf("%s: type changed from %s to %s", rc.Path, rc.Before, rc.After)
+	default:
+		return fmt.Sprintf("%s: value changed (%s)", rc.Path, rc.Before)
+	}
+}
+
+// roundtripChanges decrypts data with keys, saves the tree again with the
+// same fields encrypted, reloads the result, and returns the leaves whose
+// value or type differ, sorted by path. Comparing the two loads can't catch
+// what the first one lost, so fields whose type Load had to guess (an
+// integer written as untagged JSON reads back as float64) are returned too.
+// The re-save is encrypted to a throwaway X25519 key, so it works with any
+// identity (SSH keys included) and never needs the file's recipients.
+func roundtripChanges(data []byte, keys enc.KeySources) ([]roundtripChange, error) {
+	// A field left armored would compare equal to itself and prove nothing
+	strict := func(path []string, armored string, err error) (any, bool) { return nil, false }
+	before, err := viola.Load(data, viola.Options{Keys: keys, OnDecryptError: strict})
+	if err != nil {
+		return nil, err
+	}
+
+	var encryptedPaths []string
+	var changes []roundtripChange
+	for _, field := range before.Fields {
+		if field.WasEncrypted {
+			encryptedPaths = append(encryptedPaths, strings.Join(field.Path, "."))
+		}
+		if field.TypeGuessed {
+			changes = append(changes, roundtripChange{
+				Path:    strings.Join(field.Path, "."),
+				Before:  field.Type,
+				After:   field.Type,
+				Guessed: true,
+			})
+		}
+	}
+
+	scratch, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, err
+	}
+	// Save walks a copy of the tree, leaving before.Tree as loaded
+	resaved, _, err := viola.Save(before.Tree, viola.Options{
+		Keys:          enc.KeySources{Recipients: []string{scratch.Recipient().String()}},
+		ShouldEncrypt: viola.EncryptByPath(encryptedPaths...),
+		InlineTables:  before.InlineTables,
+		HeaderComment: before.HeaderComment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("re-saving: %w", err)
+	}
+	after, err := viola.Load(resaved, viola.Options{
+		Keys:           enc.KeySources{IdentitiesData: []string{scratch.String()}},
+		OnDecryptError: strict,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reloading: %w", err)
+	}
+
+	for _, change := range compareLeaves(before.Tree, after.Tree) {
+		if !slices.ContainsFunc(changes, func(guessed roundtripChange) bool { return guessed.Path == change.Path }) {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// compareLeaves returns the leaves of after whose value or type differ from
+// the same path in before, or that only one of the trees has, sorted by path
+func compareLeaves(before, after any) []roundtripChange {
+	leaves := func(tree any) map[string]any {
+		var pairs []flatPair
+		flattenPairs(tree, "", &pairs)
+		values := make(map[string]any, len(pairs))
+		for _, pair := range pairs {
+			values[pair.key] = pair.value
+		}
+		return values
+	}
+	beforeLeaves, afterLeaves := leaves(before), leaves(after)
+
+	var changes []roundtripChange
+	for path, value := range beforeLeaves {
+		change := roundtripChange{Path: path, Before: fmt.Sprintf("%T", value)}
+		newValue, found := afterLeaves[path]
+		if found {
+			change.After = fmt.Sprintf("%T", newValue)
+			if change.Before == change.After && reflect.DeepEqual(value, newValue) {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+	for path, value := range afterLeaves {
+		if _, found := beforeLeaves[path]; !found {
+			changes = append(changes, roundtripChange{Path: path, After: fmt.Sprintf("%T", value)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
 func verifyAction(c *cli.Context) error {
+	if file := c.String("check-recipients"); file != "" {
+		return verifyRecipientsFile(c, file)
+	}
+
 	filename := c.Args().First()
 	if filename == "" {
-		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), exitUserError)
 	}
 
-	fmt.Print(headerStyle.Render(" VERIFY COMMAND "))
-	fmt.Println()
-	fmt.Println()
+	jsonOutput := c.Bool("json")
+	if !jsonOutput && !c.Bool("quiet") {
+		fmt.Print(headerStyle.Render(" VERIFY COMMAND "))
+		fmt.Println()
+		fmt.Println()
+	}
 
-	// Read the TOML file
-	data, err := readFile(filename)
+	// Read the TOML file, from stdin when the filename is "-"
+	data, err := readInput(filename)
 	if err != nil {
-		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
 	}
 
-	var hasErrors bool
+	report := verifyReport{File: filename, Passed: true}
 	results := []string{}
 
+	// Failures are the only results --quiet prints
+	var failures []string
+	fail := func(message string) {
+		line := errorStyle.Render("✗ " + message)
+		results = append(results, line)
+		failures = append(failures, line)
+	}
+
 	// Check TOML format
 	if c.Bool("check-format") || c.Bool("check-all") {
 		_, err := viola.Load(data, viola.Options{})
 		if err != nil {
-			results = append(results, errorStyle.Render("✗ TOML format invalid: "+err.Error()))
-			hasErrors = true
+			report.Format = &verifyCheck{Message: "TOML format invalid: " + err.Error()}
+			fail(report.Format.Message)
 		} else {
-			results = append(results, successStyle.Render("✓ TOML format valid"))
+			report.Format = &verifyCheck{Passed: true, Message: "TOML format valid"}
+			results = append(results, successStyle.Render("✓ "+report.Format.Message))
 		}
 	}
 
@@ -595,44 +1761,62 @@ func verifyAction(c *cli.Context) error {
 	if c.Bool("check-armor") || c.Bool("check-all") {
 		result, err := viola.Load(data, viola.Options{})
 		if err != nil {
-			results = append(results, errorStyle.Render("✗ Could not parse file to check armor"))
-			hasErrors = true
+			report.Armor = &verifyCheck{Message: "Could not parse file to check armor"}
+			fail(report.Armor.Message)
 		} else {
-			encryptedFields := findEncryptedFields(result.Tree, []string{})
-			armorValid := true
+			// Load also reports blocks missing a marker, which aren't armored strings
+			var encryptedFields []viola.FieldMeta
+			for _, field := range result.Fields {
+				if field.WasEncrypted {
+					encryptedFields = append(encryptedFields, field)
+				}
+			}
+			report.Armor = &verifyCheck{Passed: true}
 			for _, field := range encryptedFields {
-				if !isValidArmor(field.Armored) {
-					results = append(results, errorStyle.Render(fmt.Sprintf("✗ Invalid armor block in field: %s", strings.Join(field.Path, "."))))
-					armorValid = false
-					hasErrors = true
+				path := strings.Join(field.Path, ".")
+				if err := enc.ValidateArmor(field.Armored); err != nil {
+					report.Armor.Passed = false
+					report.Armor.FailedPaths = append(report.Armor.FailedPaths, path)
+					fail(fmt.Sprintf("Invalid armor block in field: %s (%v)", path, err))
+					continue
+				}
+				// A well-formed block from a newer age would only fail at decryption
+				if header, err := enc.ParseHeader(field.Armored); err == nil {
+					if err := header.CheckVersion(); err != nil {
+						report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v", path, err))
+					}
 				}
 			}
-			if armorValid {
+			if report.Armor.Passed {
 				if len(encryptedFields) > 0 {
-					results = append(results, successStyle.Render(fmt.Sprintf("✓ All %d armor blocks are valid", len(encryptedFields))))
+					report.Armor.Message = fmt.Sprintf("All %d armor blocks are valid", len(encryptedFields))
+					results = append(results, successStyle.Render("✓ "+report.Armor.Message))
 				} else {
-					results = append(results, infoStyle.Render("ℹ No armor blocks found to verify"))
+					report.Armor.Message = "No armor blocks found to verify"
+					results = append(results, infoStyle.Render("ℹ "+report.Armor.Message))
 				}
+			} else {
+				report.Armor.Message = fmt.Sprintf("%d invalid armor blocks", len(report.Armor.FailedPaths))
 			}
 		}
 	}
 
 	// Check decryptability
-	if c.Bool("check-all") || len(c.StringSlice("identity")) > 0 {
+	if c.Bool("check-all") || len(c.StringSlice("identity")) > 0 || c.String("identity-dir") != "" {
 		keySources, err := buildKeySources(c)
 		if err != nil {
-			results = append(results, errorStyle.Render("✗ Error setting up keys: "+err.Error()))
-			hasErrors = true
+			report.Decrypt = &verifyCheck{Message: "Error setting up keys: " + err.Error()}
+			fail(report.Decrypt.Message)
 		} else {
 			opts := viola.Options{Keys: keySources}
 			result, err := viola.Load(data, opts)
 			if err != nil {
-				results = append(results, errorStyle.Render("✗ Decryption failed: "+err.Error()))
-				hasErrors = true
+				report.Decrypt = &verifyCheck{Message: "Decryption failed: " + err.Error()}
+				fail(report.Decrypt.Message)
 			} else {
 				encryptedFields := result.Fields
 				decryptableFields := 0
-				undecryptableFields := 0
+				report.Decrypt = &verifyCheck{Passed: true}
 
 				for _, field := range encryptedFields {
 					if field.WasEncrypted {
@@ -640,7 +1824,7 @@ func verifyAction(c *cli.Context) error {
 						value, found := extractPath(result.Tree, field.Path)
 						if found {
 							if strVal, ok := value.(string); ok && strings.Contains(strVal, "AGE ENCRYPTED FILE") {
-								undecryptableFields++
+								report.Decrypt.FailedPaths = append(report.Decrypt.FailedPaths, strings.Join(field.Path, "."))
 							} else {
 								decryptableFields++
 							}
@@ -648,9 +1832,10 @@ func verifyAction(c *cli.Context) error {
 					}
 				}
 
+				undecryptableFields := len(report.Decrypt.FailedPaths)
 				if undecryptableFields > 0 {
-					results = append(results, errorStyle.Render(fmt.Sprintf("✗ %d fields could not be decrypted", undecryptableFields)))
-					hasErrors = true
+					report.Decrypt.Passed = false
+					fail(fmt.Sprintf("%d fields could not be decrypted", undecryptableFields))
 				}
 				if decryptableFields > 0 {
 					results = append(results, successStyle.Render(fmt.Sprintf("✓ %d fields successfully decrypted", decryptableFields)))
@@ -658,155 +1843,1096 @@ func verifyAction(c *cli.Context) error {
 				if decryptableFields == 0 && undecryptableFields == 0 {
 					results = append(results, infoStyle.Render("ℹ No encrypted fields found"))
 				}
+				report.Decrypt.Message = fmt.Sprintf("%d fields decrypted, %d failed", decryptableFields, undecryptableFields)
+			}
+		}
+	}
+
+	// Check that the file survives being re-saved
+	if c.Bool("check-roundtrip") {
+		keySources, err := buildKeySources(c)
+		if err != nil {
+			report.Roundtrip = &verifyCheck{Message: "Error setting up keys: " + err.Error()}
+			fail(report.Roundtrip.Message)
+		} else if changes, err := roundtripChanges(data, keySources); err != nil {
+			report.Roundtrip = &verifyCheck{Message: "Round trip failed: " + err.Error()}
+			fail(report.Roundtrip.Message)
+		} else if len(changes) > 0 {
+			report.Roundtrip = &verifyCheck{Message: fmt.Sprintf("%d fields changed after re-saving", len(changes))}
+			fail(report.Roundtrip.Message)
+			for _, change := range changes {
+				report.Roundtrip.FailedPaths = append(report.Roundtrip.FailedPaths, change.Path)
+				fail("  " + change.String())
 			}
+		} else {
+			report.Roundtrip = &verifyCheck{Passed: true, Message: "All fields survive a re-save unchanged"}
+			results = append(results, successStyle.Render("✓ "+report.Roundtrip.Message))
+		}
+	}
+
+	if parsed, err := viola.Load(data, viola.Options{}); err == nil {
+		report.Warnings = append(report.Warnings, expiredRecipientWarnings(parsed.Fields, time.Now())...)
+	}
+	for _, warning := range report.Warnings {
+		results = append(results, infoStyle.Render("⚠ "+warning))
+		failures = append(failures, infoStyle.Render("⚠ "+warning))
+	}
+
+	for _, check := range []*verifyCheck{report.Format, report.Armor, report.Decrypt, report.Roundtrip} {
+		if check != nil && !check.Passed {
+			report.Passed = false
 		}
 	}
 
 	// Print results
-	fmt.Printf("File: %s\n\n", filename)
-	for _, result := range results {
-		fmt.Println(result)
+	if jsonOutput {
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error formatting output: %v", err)), exitInternalError)
+		}
+		fmt.Println(string(output))
+	} else if c.Bool("quiet") {
+		for _, failure := range failures {
+			fmt.Fprintln(os.Stderr, failure)
+		}
+	} else {
+		fmt.Printf("File: %s\n\n", filename)
+		for _, result := range results {
+			fmt.Println(result)
+		}
 	}
 
-	if hasErrors {
-		return cli.NewExitError("", 1)
+	if !report.Passed {
+		return cli.NewExitError("", exitUserError)
 	}
 
 	return nil
 }
 
-// Helper functions
+func serveAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+	}
 
-// readFile reads a file and returns its contents
-func readFile(filename string) ([]byte, error) {
-	absPath, err := filepath.Abs(filename)
+	data, err := readFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("invalid file path: %w", err)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
 	}
 
-	data, err := os.ReadFile(absPath)
+	keySources, err := buildKeySources(c)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read file %s: %w", filename, err)
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), 1)
 	}
 
-	return data, nil
-}
+	result, err := viola.Load(data, viola.Options{Keys: keySources})
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading configuration: %v", err)), 1)
+	}
 
-// buildKeySources creates KeySources from CLI flags
-func buildKeySources(c *cli.Context) (enc.KeySources, error) {
-	ks := enc.KeySources{}
+	socketPath := c.String("socket")
+	server, err := serve.Listen(socketPath, result.Tree)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error creating socket: %v", err)), 1)
+	}
 
-	// Add identity files
-	identityFiles := c.StringSlice("identity")
+	// Shut down cleanly so the socket file is removed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Close()
+	}()
 
-	if len(identityFiles) > 0 {
-		for _, file := range identityFiles {
-			if _, err := os.Stat(file); err != nil {
-				return ks, fmt.Errorf("identity file not accessible: %s", file)
-			}
-		}
-		if len(identityFiles) == 1 {
-			ks.IdentitiesFile = identityFiles[0]
-		} else {
-			// Multiple files - read them all into IdentitiesData
-			for _, file := range identityFiles {
-				data, err := os.ReadFile(file)
-				if err != nil {
-					return ks, fmt.Errorf("cannot read identity file %s: %w", file, err)
-				}
-				ks.IdentitiesData = append(ks.IdentitiesData, string(data))
-			}
-		}
+	if !c.Bool("quiet") {
+		fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Serving %s on %s (Ctrl+C to stop)", filename, socketPath)))
 	}
 
-	// Add inline key
-	key := c.String("key")
-	if key != "" {
-		ks.IdentitiesData = append(ks.IdentitiesData, key)
+	if err := server.Serve(); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error serving: %v", err)), 1)
 	}
 
-	// Set up passphrase provider
-	if c.Bool("passphrase") {
-		ks.PassphraseProvider = func() (string, error) {
-			fmt.Print("Enter passphrase: ")
-			password, err := term.ReadPassword(int(syscall.Stdin))
-			fmt.Println()
-			return string(password), err
-		}
-	} else if passphraseFile := c.String("passphrase-file"); passphraseFile != "" {
-		ks.PassphraseProvider = func() (string, error) {
-			data, err := os.ReadFile(passphraseFile)
-			if err != nil {
-				return "", err
-			}
-			// Use first line only
-			lines := strings.Split(string(data), "\n")
-			if len(lines) > 0 {
-				return strings.TrimSpace(lines[0]), nil
-			}
-			return "", fmt.Errorf("empty passphrase file")
-		}
-	} else if passphraseEnv := c.String("passphrase-env"); passphraseEnv != "" {
-		ks.PassphraseProvider = func() (string, error) {
-			passphrase := os.Getenv(passphraseEnv)
-			if passphrase == "" {
-				return "", fmt.Errorf("passphrase environment variable %s is empty", passphraseEnv)
-			}
-			return passphrase, nil
-		}
+	return nil
+}
+
+func pubkeyAction(c *cli.Context) error {
+	publicKeys, err := identityPublicKeys(c.StringSlice("identity"), c.String("identity-dir"), c.String("key"))
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), 1)
 	}
 
-	return ks, nil
+	for _, publicKey := range publicKeys {
+		fmt.Println(publicKey)
+	}
+
+	return nil
 }
 
-// buildRecipients creates a list of recipients from CLI flags
-func buildRecipients(c *cli.Context) ([]string, error) {
-	var recipients []string
+// Helper functions
 
-	// Add recipients from file
-	recipientFiles := c.StringSlice("recipients")
+// undecryptablePaths returns the sorted dotted paths of fields that failed to decrypt
+func undecryptablePaths(fields []viola.FieldMeta) []string {
+	var paths []string
+	for _, field := range fields {
+		if field.WasEncrypted && field.DecryptErr != nil {
+			paths = append(paths, strings.Join(field.Path, "."))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
 
-	if len(recipientFiles) > 0 {
-		for _, file := range recipientFiles {
-			if _, err := os.Stat(file); err != nil {
-				return nil, fmt.Errorf("recipients file not accessible: %s", file)
-			}
+// progressReporter returns a viola.Options.OnField callback that keeps an
+// "Encrypting field N of M" counter on one line of w
+func progressReporter(w io.Writer) func(path []string, index, total int) {
+	return func(path []string, index, total int) {
+		fmt.Fprintf(w, "\rEncrypting field %d of %d", index, total)
+	}
+}
 
-			data, err := os.ReadFile(file)
-			if err != nil {
-				return nil, fmt.Errorf("cannot read recipients file %s: %w", file, err)
-			}
+// clearProgress erases the line written by progressReporter
+func clearProgress(w io.Writer) {
+	fmt.Fprint(w, "\r\033[K")
+}
 
-			lines := strings.Split(string(data), "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line != "" && !strings.HasPrefix(line, "#") {
-					recipients = append(recipients, line)
-				}
-			}
-		}
+// verboseLogger returns a logger that writes viola's per-field events to
+// stderr for --verbose, or nil when not verbose or --quiet
+func verboseLogger(c *cli.Context) *slog.Logger {
+	if !c.Bool("verbose") || c.Bool("quiet") {
+		return nil
 	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
 
-	// Add inline recipients
-	inlineRecipients := c.String("recipients-inline")
+// minPassphraseLength is the shortest passphrase accepted for encryption
+const minPassphraseLength = 8
 
-	if inlineRecipients != "" {
-		parts := strings.Split(inlineRecipients, ",")
-		for _, part := range parts {
-			part = strings.TrimSpace(part)
-			if part != "" {
-				recipients = append(recipients, part)
-			}
+// readPassword prints prompt to stderr and reads a line from the terminal without echo
+func readPassword(prompt string) (string, error) {
+	fd := int(syscall.Stdin)
+	if !term.IsTerminal(fd) {
+		// Standard input may be the piped configuration; prompt on the terminal instead
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return "", fmt.Errorf("standard input is not a terminal and no terminal is available to prompt on")
+		}
+		defer tty.Close()
+		fd = int(tty.Fd())
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+// confirmPassphrase asks for a new passphrase twice and returns it if both
+// entries match and it is long enough. A weak passphrase is accepted with a warning.
+func confirmPassphrase(read func(prompt string) (string, error)) (string, error) {
+	passphrase, err := read("Enter passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	warning, err := checkPassphrase(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := read("Confirm passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if confirmation != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+
+	if warning != "" {
+		fmt.Fprintln(os.Stderr, infoStyle.Render("Warning: "+warning))
+	}
+
+	return passphrase, nil
+}
+
+// checkPassphrase rejects passphrases shorter than minPassphraseLength and
+// returns a warning for ones that are short or use a single kind of character
+func checkPassphrase(passphrase string) (string, error) {
+	length := len([]rune(passphrase))
+	if length < minPassphraseLength {
+		return "", fmt.Errorf("passphrase must be at least %d characters", minPassphraseLength)
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range passphrase {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+
+	if length < 12 || classes < 2 {
+		return "passphrase is weak; consider a longer passphrase with mixed characters", nil
+	}
+	return "", nil
+}
+
+// identityPublicKeys loads identities from each file and the inline key and
+// returns their public keys, one per identity that has one
+func identityPublicKeys(identityFiles []string, identityDir, inlineKey string) ([]string, error) {
+	if len(identityFiles) == 0 && identityDir == "" && inlineKey == "" {
+		return nil, fmt.Errorf("no identities specified (use --identity, --identity-dir, or --key)")
+	}
+
+	var sources []enc.KeySources
+	for _, file := range identityFiles {
+		sources = append(sources, enc.KeySources{IdentitiesFile: file})
+	}
+	if identityDir != "" {
+		dirIdentities, err := readIdentityDir(identityDir)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, enc.KeySources{IdentitiesData: dirIdentities})
+	}
+	if inlineKey != "" {
+		sources = append(sources, enc.KeySources{IdentitiesData: []string{inlineKey}})
+	}
+
+	var publicKeys []string
+	for _, source := range sources {
+		identities, err := source.LoadIdentities()
+		if err != nil {
+			return nil, err
+		}
+		for _, identity := range identities {
+			if publicKey, ok := enc.PublicKeyString(identity); ok {
+				publicKeys = append(publicKeys, publicKey)
+			} else {
+				fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: skipping identity without a public key (%T)", identity)))
+			}
+		}
+	}
+
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("no public keys found in the specified identities")
+	}
+
+	return publicKeys, nil
+}
+
+// cachePassphrase wraps a passphrase provider so it is only asked once
+func cachePassphrase(provider func() (string, error)) func() (string, error) {
+	var passphrase string
+	var err error
+	asked := false
+	return func() (string, error) {
+		if !asked {
+			passphrase, err = provider()
+			asked = true
+		}
+		return passphrase, err
+	}
+}
+
+// explainDecryptTrace describes, for each encrypted field, every identity
+// tried and why it did or did not decrypt the field. Plaintext is never included.
+func explainDecryptTrace(fields []viola.FieldMeta, identities []age.Identity) []string {
+	var encrypted []viola.FieldMeta
+	for _, field := range fields {
+		if field.WasEncrypted {
+			encrypted = append(encrypted, field)
+		}
+	}
+	sort.Slice(encrypted, func(i, j int) bool {
+		return strings.Join(encrypted[i].Path, ".") < strings.Join(encrypted[j].Path, ".")
+	})
+
+	var lines []string
+	for _, field := range encrypted {
+		lines = append(lines, fmt.Sprintf("explain: %s", strings.Join(field.Path, ".")))
+		if len(identities) == 0 {
+			lines = append(lines, "  no identities provided")
+			continue
+		}
+		for _, attempt := range enc.ExplainDecrypt(field.Armored, identities) {
+			if attempt.Err != nil {
+				lines = append(lines, fmt.Sprintf("  %s: %s (%v)", attempt.Identity, attempt.Outcome, attempt.Err))
+			} else {
+				lines = append(lines, fmt.Sprintf("  %s: %s", attempt.Identity, attempt.Outcome))
+			}
+		}
+	}
+	return lines
+}
+
+// backupFile copies filename to filename.bak, replacing any earlier backup, and
+// returns the backup path. It does nothing and returns "" if filename doesn't exist.
+func backupFile(filename string) (string, error) {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	backup := filename + ".bak"
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return "", err
+	}
+
+	return backup, nil
+}
+
+// writeFileAtomic replaces filename with data by writing a temporary file in
+// the same directory, syncing it, and renaming it over filename, so readers see
+// either the old or the new content. An existing file's permissions are kept.
+func writeFileAtomic(filename string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// writeOutDir writes every value in tree to its own 0600 file under dir, named
+// by its path with tables as subdirectories (e.g. database/private_password).
+// Strings are written as-is, other scalars in their usual text form, and arrays
+// as JSON. It returns the number of files written.
+func writeOutDir(tree map[string]any, dir string) (int, error) {
+	count := 0
+	var writeErr error
+
+	walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+		if key == "" || writeErr != nil {
+			return value, writeErr == nil
+		}
+		if _, isTable := value.(map[string]any); isTable {
+			return value, true
+		}
+
+		segments := append(append([]string{}, path...), key)
+		for _, segment := range segments {
+			if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, `/\`) {
+				writeErr = fmt.Errorf("cannot use key %q in a file name (at %s)", segment, strings.Join(segments, "."))
+				return value, false
+			}
+		}
+
+		content, err := outFileContent(value)
+		if err != nil {
+			writeErr = fmt.Errorf("cannot serialize %s: %w", strings.Join(segments, "."), err)
+			return value, false
+		}
+
+		file := filepath.Join(append([]string{dir}, segments...)...)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			writeErr = err
+			return value, false
+		}
+		if err := writePrivateFile(file, content); err != nil {
+			writeErr = err
+			return value, false
+		}
+		count++
+
+		// Arrays are written whole
+		return value, false
+	})
+
+	return count, writeErr
+}
+
+// outFileContent renders a value for writeOutDir
+func outFileContent(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case time.Time:
+		return []byte(v.Format(time.RFC3339Nano)), nil
+	}
+	if walk.IsScalarValue(value) {
+		return []byte(fmt.Sprint(value)), nil
+	}
+	return json.Marshal(value)
+}
+
+// createPrivateFile creates or truncates file with mode 0600. The mode given
+// to os.OpenFile only applies to new files, so an existing file is chmodded
+// before anything is written to it.
+func createPrivateFile(file string) (*os.File, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// writePrivateFile is os.WriteFile with mode 0600, for new and existing files
+func writePrivateFile(file string, data []byte) error {
+	f, err := createPrivateFile(file)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readFile reads a file and returns its contents
+func readFile(filename string) ([]byte, error) {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %w", err)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file %s: %w", filename, err)
+	}
+
+	return data, nil
+}
+
+// readPassphraseFile returns the passphrase stored in file: its first line with
+// surrounding whitespace trimmed, or with raw the whole content verbatim, for
+// passphrases that span lines or begin or end with spaces
+func readPassphraseFile(file string, raw bool) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	passphrase := string(data)
+	if !raw {
+		firstLine, _, _ := strings.Cut(passphrase, "\n")
+		passphrase = strings.TrimSpace(firstLine)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("empty passphrase file %s", file)
+	}
+	return passphrase, nil
+}
+
+// readPassphraseFD returns the first line of the open file descriptor fd,
+// with surrounding whitespace trimmed. It reads one byte at a time so nothing
+// past the line is consumed, and closes fd afterwards.
+func readPassphraseFD(fd int) (string, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return "", fmt.Errorf("invalid passphrase file descriptor %d", fd)
+	}
+	defer f.Close()
+	if _, err := f.Stat(); err != nil {
+		return "", fmt.Errorf("passphrase file descriptor %d is not open", fd)
+	}
+
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := f.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot read passphrase file descriptor %d: %w", fd, err)
+		}
+	}
+
+	passphrase := strings.TrimSpace(string(line))
+	if passphrase == "" {
+		return "", fmt.Errorf("empty passphrase on file descriptor %d", fd)
+	}
+	return passphrase, nil
+}
+
+// buildKeySources creates KeySources from CLI flags
+func buildKeySources(c *cli.Context) (enc.KeySources, error) {
+	ks := enc.KeySources{}
+
+	// Add identity files
+	identityFiles := c.StringSlice("identity")
+
+	if len(identityFiles) > 0 {
+		for _, file := range identityFiles {
+			if _, err := os.Stat(file); err != nil {
+				return ks, identityFlagError(file)
+			}
+		}
+		if len(identityFiles) == 1 {
+			ks.IdentitiesFile = identityFiles[0]
+		} else {
+			// Multiple files - read them all into IdentitiesData
+			for _, file := range identityFiles {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return ks, fmt.Errorf("cannot read identity file %s: %w", file, err)
+				}
+				ks.IdentitiesData = append(ks.IdentitiesData, string(data))
+			}
+		}
+	}
+
+	// Add every identity file in --identity-dir
+	if dir := c.String("identity-dir"); dir != "" {
+		dirIdentities, err := readIdentityDir(dir)
+		if err != nil {
+			return ks, err
+		}
+		ks.IdentitiesData = append(ks.IdentitiesData, dirIdentities...)
+	}
+
+	// Passphrase-protected SSH keys are only unlocked when a field needs them
+	ks.SSHPassphraseProvider = func() ([]byte, error) {
+		passphrase, err := readPassword("Enter passphrase for SSH key: ")
+		return []byte(passphrase), err
+	}
+
+	// An age-encrypted identity file is unlocked with --identity-passphrase or a
+	// prompt, asked at most once
+	identityPassphrase := c.String("identity-passphrase")
+	ks.IdentityPassphraseProvider = func() (string, error) {
+		if identityPassphrase != "" {
+			return identityPassphrase, nil
+		}
+		passphrase, err := readPassword("Enter passphrase for identity file: ")
+		if err == nil {
+			identityPassphrase = passphrase
+		}
+		return passphrase, err
+	}
+
+	// Add inline key
+	key := c.String("key")
+	if key != "" {
+		ks.IdentitiesData = append(ks.IdentitiesData, key)
+	}
+
+	// Set up passphrase provider
+	if c.Bool("passphrase") {
+		ks.PassphraseProvider = func() (string, error) {
+			fmt.Print("Enter passphrase: ")
+			password, err := term.ReadPassword(int(syscall.Stdin))
+			fmt.Println()
+			return string(password), err
+		}
+	} else if passphraseFile := c.String("passphrase-file"); passphraseFile != "" {
+		raw := c.Bool("passphrase-raw")
+		ks.PassphraseProvider = func() (string, error) {
+			return readPassphraseFile(passphraseFile, raw)
+		}
+	} else if c.IsSet("passphrase-fd") {
+		// A descriptor can only be read once, so remember what it held
+		fd := c.Int("passphrase-fd")
+		var passphrase string
+		ks.PassphraseProvider = func() (string, error) {
+			if passphrase == "" {
+				var err error
+				if passphrase, err = readPassphraseFD(fd); err != nil {
+					return "", err
+				}
+			}
+			return passphrase, nil
+		}
+	} else if passphraseEnv := c.String("passphrase-env"); passphraseEnv != "" {
+		ks.PassphraseProvider = func() (string, error) {
+			passphrase := os.Getenv(passphraseEnv)
+			if passphrase == "" {
+				return "", fmt.Errorf("passphrase environment variable %s is empty", passphraseEnv)
+			}
+			return passphrase, nil
+		}
+	}
+
+	return ks, nil
+}
+
+// readIdentityDir returns the contents of the identity files directly in dir,
+// in name order. Hidden files, subdirectories, and files that hold no private
+// key (public keys, notes) are skipped; a key file that doesn't parse is an
+// error. Encrypted identity files are checked when they are unlocked.
+func readIdentityDir(dir string) ([]string, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("identity directory not accessible: %s", dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read identity directory %s: %w", dir, err)
+	}
+
+	var identities []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read identity file %s: %w", path, err)
+		}
+		if !enc.IsIdentityFile(data) {
+			continue
+		}
+		if !enc.IsEncryptedIdentityFile(data) {
+			if _, err := (enc.KeySources{IdentitiesData: []string{string(data)}}).LoadIdentities(); err != nil {
+				return nil, fmt.Errorf("identity file %s: %w", path, err)
+			}
+		}
+		identities = append(identities, string(data))
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no identity files found in %s", dir)
+	}
+	return identities, nil
+}
+
+// buildRecipients creates a list of recipients from CLI flags
+func buildRecipients(c *cli.Context) ([]string, error) {
+	var recipients []string
+
+	// Add recipients from file
+	recipientFiles := c.StringSlice("recipients")
+
+	keyringOpts := enc.KeyringOptions{
+		Timeout:   c.Duration("keyring-timeout"),
+		PinSHA256: c.String("keyring-pin"),
+		AllowHTTP: c.Bool("insecure-http"),
+		CacheDir:  c.String("keyring-cache-dir"),
+		CacheTTL:  c.Duration("keyring-cache-ttl"),
+		OnStaleCache: func(url string, age time.Duration, fetchErr error) {
+			fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Warning: %v; using the copy cached %s ago", fetchErr, age.Round(time.Second))))
+		},
+	}
+
+	for _, file := range recipientFiles {
+		var fileRecipients []string
+		var err error
+		if _, parseErr := enc.ParseRecipient(file); errors.Is(parseErr, enc.ErrIdentityAsRecipient) {
+			return nil, fmt.Errorf("--recipients takes a file or URL: %w", parseErr)
+		}
+		if isURL(file) {
+			fileRecipients, err = enc.FetchRecipients(file, keyringOpts)
+		} else {
+			fileRecipients, err = readRecipientsFile(file)
+		}
+		if err == nil {
+			err = checkNotIdentities(file, fileRecipients)
+		}
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, fileRecipients...)
+	}
+
+	// Add inline recipients
+	inlineRecipients := c.String("recipients-inline")
+
+	if inlineRecipients != "" {
+		var inline []string
+		parts := strings.Split(inlineRecipients, ",")
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part != "" {
+				inline = append(inline, part)
+			}
+		}
+		if err := checkNotIdentities("--recipients-inline", inline); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, inline...)
+	}
+
+	// Add recipients from named groups in an alias file
+	groupNames := c.StringSlice("recipients-group")
+	if len(groupNames) > 0 {
+		groupRecipients, err := readRecipientGroups(c.String("recipients-age-file"), groupNames)
+		if err == nil {
+			err = checkNotIdentities("--recipients-group", groupRecipients)
+		}
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, groupRecipients...)
+	}
+
+	// Add labeled recipients from a remote keyring
+	keyringURL := c.String("keyring")
+	if keyringURL != "" {
+		entries, err := enc.FetchKeyring(keyringURL, keyringOpts)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			recipients = append(recipients, entry.Key)
+			if c.Bool("verbose") && !c.Bool("quiet") {
+				fmt.Fprintf(os.Stderr, "Keyring recipient: %s (%s)\n", entry.Name, displayKey(entry.Key, c.Bool("full-keys")))
+			}
+		}
+	}
+
+	// Add recipients derived from our own identities
+	if c.Bool("recipients-self") {
+		selfRecipients, err := buildSelfRecipients(c.StringSlice("identity"), c.String("identity-dir"))
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, selfRecipients...)
+	}
+
+	if len(recipients) == 0 {
+		if len(recipientFiles) == 0 && inlineRecipients == "" && len(groupNames) == 0 && keyringURL == "" && !c.Bool("recipients-self") {
+			return nil, fmt.Errorf("no recipients specified (use --recipients or --recipients-inline)")
+		}
+		return nil, fmt.Errorf("no recipients found in the specified sources")
+	}
+
+	return recipients, nil
+}
+
+// readFieldManifest reads the dotted field paths listed in a manifest file
+func readFieldManifest(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open manifest %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	paths, err := viola.ParseFieldManifest(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no fields", filename)
+	}
+
+	return paths, nil
+}
+
+// readEncryptRules reads the per-subtree encryption rules in a rules file
+func readEncryptRules(filename string) ([]viola.EncryptRule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open rules file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	rules, err := viola.ParseEncryptRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("rules file %s lists no rules", filename)
+	}
+
+	return rules, nil
+}
+
+// readRCRules compiles the --violarc policy file, or the .violarc file in the
+// working directory unless --no-violarc. It returns nil when there is none.
+func readRCRules(c *cli.Context) (func(path []string, key string, value any) bool, error) {
+	var rules viola.RCRules
+	if file := c.String("violarc"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if rules, err = viola.ParseRCRules(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	} else if !c.Bool("no-violarc") {
+		var found bool
+		var err error
+		if rules, found, err = viola.LoadRCRules("."); err != nil || !found {
+			return nil, err
+		}
+	} else {
+		return nil, nil
+	}
+	return rules.ShouldEncrypt()
+}
+
+// loadPreviousTree reads the existing --output file and the identities needed to
+// compare against it. A missing output file yields a nil tree.
+func loadPreviousTree(c *cli.Context) (map[string]any, error) {
+	outputFile := c.String("output")
+	if outputFile == "" {
+		return nil, fmt.Errorf("--changed-only requires --output")
+	}
+
+	if len(c.StringSlice("identity")) == 0 && c.String("identity-dir") == "" {
+		return nil, fmt.Errorf("--changed-only requires --identity or --identity-dir to compare existing ciphertext")
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read output file %s: %w", outputFile, err)
+	}
+
+	result, err := viola.Load(data, viola.Options{}) // No keys - just parse
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Tree, nil
+}
+
+// readRecipientsFile reads recipient strings from a file, skipping blank lines and comments.
+// A file that exists but contains no recipients is an error, so a typo'd file is easy to spot.
+func readRecipientsFile(file string) ([]string, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("recipients file not accessible: %s", file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recipients file %s: %w", file, err)
+	}
+
+	var recipients []string
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			recipients = append(recipients, line)
 		}
 	}
 
 	if len(recipients) == 0 {
-		return nil, fmt.Errorf("no recipients specified (use --recipients or --recipients-inline)")
+		return nil, fmt.Errorf("recipients file %s contains no recipients (only blank lines or comments)", file)
+	}
+
+	return recipients, nil
+}
+
+// recipientLabels collects the labels the comments in local recipients files
+// give their keys (see enc.ParseRecipientLabels); URLs are skipped. SSH keys
+// are labeled by their header tag too, so fields can be labeled from their
+// age headers alone.
+func recipientLabels(files []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, file := range files {
+		if isURL(file) {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read recipients file %s: %w", file, err)
+		}
+		for recipient, label := range enc.ParseRecipientLabels(data) {
+			labels[recipient] = label
+			if tag, err := enc.SSHRecipientTag(recipient); err == nil {
+				labels[tag] = label
+			}
+		}
+	}
+	return labels, nil
+}
+
+// labeledKey is displayKey with the key's label in front, if it has one, e.g.
+// "alice@example.com (x25519:1f3a9c0e)"
+func labeledKey(key string, labels map[string]string, full bool) string {
+	if label := labels[key]; label != "" {
+		return label + " (" + displayKey(key, full) + ")"
+	}
+	return displayKey(key, full)
+}
+
+// checkNotIdentities fails with enc.ErrIdentityAsRecipient if a recipient
+// from source is actually a private key, without repeating the key
+func checkNotIdentities(source string, recipients []string) error {
+	for i, recipient := range recipients {
+		if _, err := enc.ParseRecipient(recipient); errors.Is(err, enc.ErrIdentityAsRecipient) {
+			return fmt.Errorf("%s: recipient %d: %w", source, i+1, err)
+		}
+	}
+	return nil
+}
+
+// identityFlagError explains an --identity value that isn't a readable file,
+// recognizing a key pasted in place of the path (without repeating it)
+func identityFlagError(value string) error {
+	if _, err := enc.ParseRecipient(value); err == nil {
+		return fmt.Errorf("--identity %s: %w; pass it to --recipients-inline, or the path of an identity file to --identity", value, enc.ErrRecipientAsIdentity)
+	}
+	if _, err := enc.ParseIdentity(value); err == nil || strings.HasPrefix(strings.ToUpper(strings.TrimSpace(value)), "AGE-SECRET-KEY-") {
+		return fmt.Errorf("--identity takes the path of an identity file; pass the key itself with --key")
+	}
+	return fmt.Errorf("identity file not accessible: %s", value)
+}
+
+// isURL reports whether a --recipients value names a remote file rather than a path
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// readRecipientGroups returns the recipient strings of the named groups in an alias file
+func readRecipientGroups(file string, names []string) ([]string, error) {
+	if file == "" {
+		return nil, fmt.Errorf("--recipients-group requires --recipients-age-file")
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recipient groups file %s: %w", file, err)
+	}
+
+	groups, err := enc.ParseRecipientGroups(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient groups file %s: %w", file, err)
+	}
+
+	var recipients []string
+	for _, name := range names {
+		keys, ok := groups[name]
+		if !ok {
+			return nil, fmt.Errorf("recipient group %s not found in %s", name, file)
+		}
+		recipients = append(recipients, keys...)
+	}
+	return recipients, nil
+}
+
+// buildSelfRecipients derives recipient strings from the given identity files
+func buildSelfRecipients(identityFiles []string, identityDir string) ([]string, error) {
+	if len(identityFiles) == 0 && identityDir == "" {
+		return nil, fmt.Errorf("--recipients-self requires at least one --identity file or an --identity-dir")
+	}
+
+	var recipients []string
+	for _, file := range identityFiles {
+		identities, err := enc.KeySources{IdentitiesFile: file}.LoadIdentities()
+		if err != nil {
+			return nil, err
+		}
+
+		derived := enc.GetRecipientStrings(enc.RecipientsFromIdentities(identities))
+		if len(derived) == 0 {
+			return nil, fmt.Errorf("identity file %s contains no X25519 identities", file)
+		}
+		recipients = append(recipients, derived...)
+	}
+
+	if identityDir != "" {
+		dirIdentities, err := readIdentityDir(identityDir)
+		if err != nil {
+			return nil, err
+		}
+		identities, err := enc.KeySources{IdentitiesData: dirIdentities}.LoadIdentities()
+		if err != nil {
+			return nil, err
+		}
+
+		derived := enc.GetRecipientStrings(enc.RecipientsFromIdentities(identities))
+		if len(derived) == 0 {
+			return nil, fmt.Errorf("identity directory %s contains no X25519 identities", identityDir)
+		}
+		recipients = append(recipients, derived...)
 	}
 
 	return recipients, nil
 }
 
+// outputFormats are the formats formatOutput writes
+var outputFormats = []string{"toml", "json", "jsonl", "yaml", "env", "flat", "hcl", "ini", "properties"}
+
+// outputExtensions maps output file extensions to the format they imply
+var outputExtensions = map[string]string{
+	".toml":       "toml",
+	".json":       "json",
+	".jsonl":      "jsonl",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".env":        "env",
+	".hcl":        "hcl",
+	".ini":        "ini",
+	".properties": "properties",
+}
+
+// readOutputTarget resolves read's --output and --output-file into a format
+// and a file ("" for stdout). A file's format comes from its extension unless
+// --output is given explicitly. A --output that is not a format but has a file
+// extension, as in "-o config.json", is taken as --output-file.
+func readOutputTarget(c *cli.Context) (format, file string, err error) {
+	format, file = c.String("output"), c.String("output-file")
+	explicit := c.IsSet("output")
+	if file == "" && !slices.Contains(outputFormats, format) && filepath.Ext(format) != "" {
+		format, file, explicit = "", format, false
+	}
+	if file == "" || explicit {
+		return format, file, nil
+	}
+
+	inferred, ok := outputExtensions[strings.ToLower(filepath.Ext(file))]
+	if !ok {
+		return "", "", fmt.Errorf("cannot tell the output format of %s from its extension; pass --output", file)
+	}
+	return inferred, file, nil
+}
+
 // formatOutput formats data according to the specified format
 func formatOutput(data any, format string, noColor bool) ([]byte, error) {
 	switch format {
@@ -816,6 +2942,11 @@ func formatOutput(data any, format string, noColor bool) ([]byte, error) {
 		}
 		return json.MarshalIndent(data, "", "  ")
 
+	case "jsonl":
+		var buf strings.Builder
+		err := writeJSONLines(&buf, data)
+		return []byte(buf.String()), err
+
 	case "yaml":
 		return yaml.Marshal(data)
 
@@ -825,77 +2956,354 @@ func formatOutput(data any, format string, noColor bool) ([]byte, error) {
 	case "flat":
 		return formatAsFlat(data, ""), nil
 
+	case "hcl":
+		return formatAsHCL(data)
+
+	case "ini":
+		return formatAsINI(data)
+
+	case "properties":
+		return formatAsProperties(data), nil
+
 	case "toml":
 		fallthrough
 	default:
 		return formatAsTOML(data)
 	}
-}
+}
+
+// formatAsTOML formats data as TOML
+func formatAsTOML(data any) ([]byte, error) {
+	var buf strings.Builder
+	encoder := toml.NewEncoder(&buf)
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return []byte(buf.String()), nil
+}
+
+// formatAsEnv formats data as environment variables
+func formatAsEnv(data any, prefix string) []byte {
+	var result []string
+	flattenForEnv(data, prefix, &result)
+	return []byte(strings.Join(result, "\n"))
+}
+
+// flattenForEnv recursively flattens data for environment variable format
+func flattenForEnv(data any, prefix string, result *[]string) {
+	switch v := data.(type) {
+	case map[string]any:
+		for key, value := range v {
+			newPrefix := key
+			if prefix != "" {
+				newPrefix = prefix + "_" + key
+			}
+			flattenForEnv(value, newPrefix, result)
+		}
+	case []any:
+		for i, value := range v {
+			newPrefix := fmt.Sprintf("%s_%d", prefix, i)
+			flattenForEnv(value, newPrefix, result)
+		}
+	default:
+		*result = append(*result, fmt.Sprintf("%s=%v", strings.ToUpper(prefix), v))
+	}
+}
+
+// formatNullDelimited formats data as the env or flat format does, but ends
+// every record with a NUL byte instead of separating records with newlines,
+// so values that contain newlines (PEM keys) survive a shell loop such as
+//
+//	while IFS= read -r -d '' record; do export "$record"; done
+func formatNullDelimited(data any, format string) ([]byte, error) {
+	var records []string
+	switch format {
+	case "env":
+		flattenForEnv(data, "", &records)
+	case "flat":
+		flattenForFlat(data, "", &records)
+	default:
+		return nil, fmt.Errorf("--null only applies to the env and flat formats, not %s", format)
+	}
+
+	var out []byte
+	for _, record := range records {
+		if strings.ContainsRune(record, 0) {
+			key, _, _ := strings.Cut(record, "=")
+			return nil, fmt.Errorf("the value of %s contains a NUL byte, which --null can't delimit", key)
+		}
+		out = append(append(out, record...), 0)
+	}
+	return out, nil
+}
+
+// formatAsFlat formats data as flat key=value pairs
+func formatAsFlat(data any, prefix string) []byte {
+	var result []string
+	flattenForFlat(data, prefix, &result)
+	return []byte(strings.Join(result, "\n"))
+}
+
+// flattenForFlat recursively flattens data for flat format
+func flattenForFlat(data any, prefix string, result *[]string) {
+	var pairs []flatPair
+	flattenPairs(data, prefix, &pairs)
+	for _, pair := range pairs {
+		*result = append(*result, fmt.Sprintf("%s=%v", pair.key, pair.value))
+	}
+}
+
+// flatPair is a leaf value with its dotted key
+type flatPair struct {
+	key   string
+	value any
+}
+
+// flattenPairs recursively flattens data into dotted keys and leaf values
+func flattenPairs(data any, prefix string, result *[]flatPair) {
+	switch v := data.(type) {
+	case map[string]any:
+		for key, value := range v {
+			newPrefix := key
+			if prefix != "" {
+				newPrefix = prefix + "." + key
+			}
+			flattenPairs(value, newPrefix, result)
+		}
+	case []map[string]any:
+		for i, value := range v {
+			flattenPairs(value, fmt.Sprintf("%s[%d]", prefix, i), result)
+		}
+	case []any:
+		for i, value := range v {
+			newPrefix := fmt.Sprintf("%s[%d]", prefix, i)
+			flattenPairs(value, newPrefix, result)
+		}
+	default:
+		*result = append(*result, flatPair{key: prefix, value: v})
+	}
+}
+
+// formatAsProperties formats data as a Java .properties file
+func formatAsProperties(data any) []byte {
+	var pairs []flatPair
+	flattenPairs(data, "", &pairs)
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].key < pairs[j].key })
+
+	var lines []string
+	for _, pair := range pairs {
+		key := escapeProperty(pair.key, true)
+		value := escapeProperty(fmt.Sprintf("%v", pair.value), false)
+		lines = append(lines, key+"="+value)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// escapeProperty escapes a .properties key or value. Separators, comment markers,
+// control characters, and non-ASCII runes (as \uXXXX) are escaped.
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '=' || r == ':':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '#' || r == '!' || r == ' ':
+			if isKey || i == 0 {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// formatAsINI formats data as INI. Top-level scalars come first, top-level
+// tables become sections, and anything nested deeper is rejected.
+func formatAsINI(data any) ([]byte, error) {
+	tree, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("INI output requires a table at the top level")
+	}
+
+	var globals, sections []string
+	for key, value := range tree {
+		if _, ok := value.(map[string]any); ok {
+			sections = append(sections, key)
+		} else {
+			globals = append(globals, key)
+		}
+	}
+	sort.Strings(globals)
+	sort.Strings(sections)
+
+	var lines []string
+	for _, key := range globals {
+		line, err := iniLine(key, tree[key], key)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	for _, section := range sections {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]")
+
+		table := tree[section].(map[string]any)
+		keys := make([]string, 0, len(table))
+		for key := range table {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			line, err := iniLine(key, table[key], section+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// iniLine renders a single INI key/value, rejecting values INI can't represent
+func iniLine(key string, value any, path string) (string, error) {
+	switch value.(type) {
+	case map[string]any, []any, []map[string]any:
+		return "", fmt.Errorf("INI cannot represent nested value at %s (only top-level tables are supported)", path)
+	}
+
+	rendered := fmt.Sprintf("%v", value)
+	rendered = strings.ReplaceAll(rendered, "\n", `\n`)
+	return fmt.Sprintf("%s = %s", key, rendered), nil
+}
+
+// recipientsReport lists the recipients the fields were encrypted to, one
+// per line and deduplicated. When every field used the same recipients the
+// list is the global set (which, unlike FieldMeta.UsedRecipients, includes SSH
+// keys); otherwise each field's recipients follow a "# <path>" comment. Either
+// way the report can be read back as a recipients file.
+func recipientsReport(fields []viola.FieldMeta, recipients []string) []byte {
+	var encrypted []viola.FieldMeta
+	for _, field := range fields {
+		if field.WasEncrypted {
+			encrypted = append(encrypted, field)
+		}
+	}
+
+	uniform := true
+	for _, field := range encrypted {
+		if !reflect.DeepEqual(dedupeStrings(field.UsedRecipients), dedupeStrings(encrypted[0].UsedRecipients)) {
+			uniform = false
+			break
+		}
+	}
+
+	var b strings.Builder
+	if uniform {
+		for _, recipient := range dedupeStrings(trimStrings(recipients)) {
+			b.WriteString(recipient + "\n")
+		}
+		if len(encrypted) > 0 && encrypted[0].UsedPassphrase {
+			b.WriteString("# passphrase\n")
+		}
+		return []byte(b.String())
+	}
 
-// formatAsTOML formats data as TOML
-func formatAsTOML(data any) ([]byte, error) {
-	var buf strings.Builder
-	encoder := toml.NewEncoder(&buf)
-	if err := encoder.Encode(data); err != nil {
-		return nil, err
+	for i, field := range encrypted {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("# " + strings.Join(field.Path, ".") + "\n")
+		for _, recipient := range dedupeStrings(field.UsedRecipients) {
+			if recipient == "passphrase" {
+				b.WriteString("# passphrase\n")
+				continue
+			}
+			b.WriteString(recipient + "\n")
+		}
 	}
-	return []byte(buf.String()), nil
+	return []byte(b.String())
 }
 
-// formatAsEnv formats data as environment variables
-func formatAsEnv(data any, prefix string) []byte {
+// dedupeStrings returns values without repeats, keeping the first occurrence
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool)
 	var result []string
-	flattenForEnv(data, prefix, &result)
-	return []byte(strings.Join(result, "\n"))
-}
-
-// flattenForEnv recursively flattens data for environment variable format
-func flattenForEnv(data any, prefix string, result *[]string) {
-	switch v := data.(type) {
-	case map[string]any:
-		for key, value := range v {
-			newPrefix := key
-			if prefix != "" {
-				newPrefix = prefix + "_" + key
-			}
-			flattenForEnv(value, newPrefix, result)
-		}
-	case []any:
-		for i, value := range v {
-			newPrefix := fmt.Sprintf("%s_%d", prefix, i)
-			flattenForEnv(value, newPrefix, result)
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
 		}
-	default:
-		*result = append(*result, fmt.Sprintf("%s=%v", strings.ToUpper(prefix), v))
 	}
+	return result
 }
 
-// formatAsFlat formats data as flat key=value pairs
-func formatAsFlat(data any, prefix string) []byte {
-	var result []string
-	flattenForFlat(data, prefix, &result)
-	return []byte(strings.Join(result, "\n"))
+// trimStrings returns values with surrounding whitespace removed
+func trimStrings(values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = strings.TrimSpace(value)
+	}
+	return result
 }
 
-// flattenForFlat recursively flattens data for flat format
-func flattenForFlat(data any, prefix string, result *[]string) {
-	switch v := data.(type) {
-	case map[string]any:
-		for key, value := range v {
-			newPrefix := key
-			if prefix != "" {
-				newPrefix = prefix + "." + key
-			}
-			flattenForFlat(value, newPrefix, result)
+// redactedValue is the placeholder for a redacted field
+const redactedValue = "***"
+
+// redactFields replaces the value of every encrypted field in tree with a mask,
+// in place. With showLength the mask has one * per character of the decrypted
+// value (tables and other non-strings are measured as their JSON); fields that
+// could not be decrypted get the plain placeholder.
+func redactFields(tree map[string]any, fields []viola.FieldMeta, showLength bool) {
+	for _, field := range fields {
+		if !field.WasEncrypted {
+			continue
 		}
-	case []any:
-		for i, value := range v {
-			newPrefix := fmt.Sprintf("%s[%d]", prefix, i)
-			flattenForFlat(value, newPrefix, result)
+		value, found := walk.GetValue(tree, field.Path)
+		if !found {
+			continue
 		}
-	default:
-		*result = append(*result, fmt.Sprintf("%s=%v", prefix, v))
+
+		mask := redactedValue
+		if showLength && field.DecryptErr == nil {
+			mask = strings.Repeat("*", redactedLength(value))
+		}
+		walk.SetValue(tree, field.Path, mask)
+	}
+}
+
+// redactedLength returns the number of characters in value's plaintext form
+func redactedLength(value any) int {
+	if str, ok := value.(string); ok {
+		return utf8.RuneCountInString(str)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return len(redactedValue)
 	}
+	return utf8.RuneCount(data)
 }
 
 // filterFields filters the tree to show only private or public fields
@@ -927,6 +3335,104 @@ func filterFields(tree map[string]any, fields []viola.FieldMeta, privateOnly boo
 	}
 }
 
+// filterByGlobs returns the parts of tree selected by path globs. A field
+// matching an only glob is kept with everything under it (plus the tables
+// leading to it); with no only globs everything is selected. A field matching
+// an exclude glob is dropped with everything under it. Globs are dotted paths
+// where '*' matches within one level (so "servers.*.name" covers each element)
+// and '**' matches any number of levels.
+func filterByGlobs(tree map[string]any, only, exclude []string) map[string]any {
+	parse := func(globs []string) [][]string {
+		parsed := make([][]string, len(globs))
+		for i, glob := range globs {
+			parsed[i] = walk.ParsePath(glob)
+		}
+		return parsed
+	}
+
+	result, _ := filterGlobValue(nil, tree, parse(only), parse(exclude), len(only) == 0)
+	if m, ok := result.(map[string]any); ok {
+		return m
+	}
+	return map[string]any{}
+}
+
+// filterGlobValue filters the value at path; included reports whether an
+// ancestor already matched an only glob
+func filterGlobValue(path []string, value any, only, exclude [][]string, included bool) (any, bool) {
+	if len(path) > 0 && matchesAnyGlob(exclude, path) {
+		return nil, false
+	}
+	included = included || matchesAnyGlob(only, path)
+
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any)
+		for key, child := range v {
+			if kept, ok := filterGlobValue(append(path[:len(path):len(path)], key), child, only, exclude, included); ok {
+				result[key] = kept
+			}
+		}
+		return result, included || len(result) > 0
+	case []map[string]any:
+		elements := make([]any, len(v))
+		for i, table := range v {
+			elements[i] = table
+		}
+		return filterGlobValue(path, elements, only, exclude, included)
+	case []any:
+		var result []any
+		for i, element := range v {
+			if kept, ok := filterGlobValue(append(path[:len(path):len(path)], fmt.Sprintf("[%d]", i)), element, only, exclude, included); ok {
+				result = append(result, kept)
+			}
+		}
+		if result == nil {
+			result = []any{}
+		}
+		return result, included || len(result) > 0
+	default:
+		return value, included
+	}
+}
+
+// matchesAnyGlob reports whether path matches any of the parsed globs
+func matchesAnyGlob(globs [][]string, path []string) bool {
+	for _, glob := range globs {
+		if matchGlob(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches path against a parsed glob, where "**" spans any number of segments
+func matchGlob(glob, path []string) bool {
+	if len(glob) == 0 {
+		return len(path) == 0
+	}
+	if glob[0] == "**" {
+		return matchGlob(glob[1:], path) || (len(path) > 0 && matchGlob(glob, path[1:]))
+	}
+	if len(path) == 0 || !matchGlobSegment(glob[0], path[0]) {
+		return false
+	}
+	return matchGlob(glob[1:], path[1:])
+}
+
+// matchGlobSegment matches one path segment. Index segments like "[0]" are
+// compared literally, since brackets are character classes to filepath.Match.
+func matchGlobSegment(pattern, segment string) bool {
+	if pattern == segment {
+		return true
+	}
+	if strings.HasPrefix(pattern, "[") {
+		return false
+	}
+	matched, err := filepath.Match(pattern, segment)
+	return err == nil && matched
+}
+
 // copyNonEncrypted recursively copies non-encrypted fields
 func copyNonEncrypted(src, dest map[string]any, prefix string, encryptedPaths map[string]bool) {
 	for key, value := range src {
@@ -994,6 +3500,40 @@ func setNestedValue(data map[string]any, path []string, value any) {
 	}
 }
 
+// countUniqueStrings counts the distinct values in a slice
+func countUniqueStrings(values []string) int {
+	seen := make(map[string]bool)
+	for _, value := range values {
+		seen[value] = true
+	}
+	return len(seen)
+}
+
+// uniqueStrings returns values without duplicates, in first-seen order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// displayKey shortens a recipient key to its enc.ShortIDString unless full is
+// set. Strings that aren't valid keys, such as header tags, are kept as-is.
+func displayKey(key string, full bool) string {
+	if full {
+		return key
+	}
+	if _, err := enc.ParseRecipient(key); err != nil {
+		return key
+	}
+	return enc.ShortIDString(key)
+}
+
 // countEncryptedFields counts how many fields were encrypted
 func countEncryptedFields(fields []viola.FieldMeta) int {
 	count := 0
@@ -1005,105 +3545,467 @@ func countEncryptedFields(fields []viola.FieldMeta) int {
 	return count
 }
 
-// findEncryptedFields finds all encrypted fields in a tree
-func findEncryptedFields(tree any, path []string) []struct {
+// encryptedField is an armored field found in a tree
+type encryptedField struct {
 	Path    []string
 	Armored string
-} {
-	var fields []struct {
-		Path    []string
-		Armored string
+}
+
+// findEncryptedFields finds all encrypted fields in a tree
+func findEncryptedFields(tree any, path []string) []encryptedField {
+	var fields []encryptedField
+
+	walk.WalkTyped(tree, func(segments []walk.PathSegment, value any) (any, bool) {
+		if strValue, ok := value.(string); ok && isArmoredData(strValue) {
+			fields = append(fields, encryptedField{
+				Path:    append(append([]string{}, path...), walk.SegmentStrings(segments)...),
+				Armored: strValue,
+			})
+		}
+		return value, true
+	})
+
+	return fields
+}
+
+// armorSizes returns the total armored size of the encrypted fields and the
+// largest of them, by size only, so no secret content is needed
+func armorSizes(fields []viola.FieldMeta) (int, viola.FieldMeta) {
+	total := 0
+	var largest viola.FieldMeta
+	for _, field := range fields {
+		if !field.WasEncrypted {
+			continue
+		}
+		total += field.ArmoredBytes
+		if field.ArmoredBytes > largest.ArmoredBytes {
+			largest = field
+		}
 	}
+	return total, largest
+}
 
-	switch v := tree.(type) {
-	case map[string]any:
-		for key, value := range v {
-			newPath := append(path, key)
-			if strValue, ok := value.(string); ok && isArmoredData(strValue) {
-				fields = append(fields, struct {
-					Path    []string
-					Armored string
-				}{
-					Path:    newPath,
-					Armored: strValue,
-				})
-			} else {
-				fields = append(fields, findEncryptedFields(value, newPath)...)
+// fieldVersionReport describes the age header version and stanza types of each field.
+// The returned warning is non-empty when fields use different versions.
+func fieldVersionReport(fields []encryptedField) ([]string, string) {
+	var lines []string
+	versionCounts := make(map[string]int)
+
+	for _, field := range fields {
+		path := strings.Join(field.Path, ".")
+		header, err := enc.ParseHeader(field.Armored)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: unreadable header (%v)", path, err))
+			continue
+		}
+		versionCounts[header.Version]++
+		lines = append(lines, fmt.Sprintf("%s: %s (%s)", path, header.Version, strings.Join(header.StanzaTypes(), ", ")))
+	}
+
+	if len(versionCounts) <= 1 {
+		return lines, ""
+	}
+
+	versions := make([]string, 0, len(versionCounts))
+	for version := range versionCounts {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	var parts []string
+	for _, version := range versions {
+		parts = append(parts, fmt.Sprintf("%s (%d fields)", version, versionCounts[version]))
+	}
+
+	return lines, "Mixed age versions: " + strings.Join(parts, ", ")
+}
+
+// audienceGroup is a set of encrypted fields readable by exactly the same recipients
+type audienceGroup struct {
+	Recipients []string
+	Paths      []string
+}
+
+// groupAudiences groups fields by their exact recipient set: the annotated
+// recipients when every field has recipient comments, otherwise the recipient
+// tags of each age header. Groups are ordered largest first.
+func groupAudiences(fields []encryptedField, notes map[string][]viola.RecipientNote) []audienceGroup {
+	annotated := len(fields) > 0
+	for _, field := range fields {
+		if len(notes[field.Armored]) == 0 {
+			annotated = false
+			break
+		}
+	}
+
+	byKey := make(map[string]*audienceGroup)
+	var keys []string
+	for _, field := range fields {
+		var recipients []string
+		if annotated {
+			for _, note := range notes[field.Armored] {
+				recipients = append(recipients, note.Recipient)
 			}
+			sort.Strings(recipients)
+		} else if recipients = extractRecipientsFromArmor(field.Armored); recipients == nil {
+			recipients = []string{"(unreadable header)"}
 		}
-	case []any:
-		for i, value := range v {
-			newPath := append(path, fmt.Sprintf("[%d]", i))
-			fields = append(fields, findEncryptedFields(value, newPath)...)
+
+		key := strings.Join(recipients, "\n")
+		group, ok := byKey[key]
+		if !ok {
+			group = &audienceGroup{Recipients: recipients}
+			byKey[key] = group
+			keys = append(keys, key)
 		}
+		group.Paths = append(group.Paths, strings.Join(field.Path, "."))
 	}
 
-	return fields
+	groups := make([]audienceGroup, 0, len(keys))
+	for _, key := range keys {
+		sort.Strings(byKey[key].Paths)
+		groups = append(groups, *byKey[key])
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Paths) != len(groups[j].Paths) {
+			return len(groups[i].Paths) > len(groups[j].Paths)
+		}
+		return strings.Join(groups[i].Recipients, "\n") < strings.Join(groups[j].Recipients, "\n")
+	})
+	return groups
+}
+
+// fieldTypeReport returns a "path: type" line for each encrypted field of a
+// decrypting Load, sorted by path, giving the Go type Load decoded the value
+// to (see FieldMeta.Type) but never the value itself
+func fieldTypeReport(result *viola.Result) []string {
+	var lines []string
+	for _, field := range result.Fields {
+		path := strings.Join(field.Path, ".")
+		if field.DecryptErr != nil {
+			lines = append(lines, fmt.Sprintf("%s: (not decrypted: %v)", path, field.DecryptErr))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", path, field.Type))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// audienceReport summarizes audience groups. The largest group is taken as the
+// norm; fields in every other group are listed as outliers, noting whether
+// they are readable by fewer or more recipients than the norm.
+func audienceReport(groups []audienceGroup) []string {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, group := range groups {
+		total += len(group.Paths)
+	}
+	lines := []string{fmt.Sprintf("%d unique recipient sets across %d encrypted fields", len(groups), total)}
+
+	norm := len(groups[0].Recipients)
+	for i, group := range groups {
+		line := fmt.Sprintf("Set %d (%d fields): %s", i+1, len(group.Paths), summarizeRecipients(group.Recipients))
+		if i == 0 {
+			if len(groups) > 1 {
+				line += " [most common]"
+			}
+			lines = append(lines, line)
+			continue
+		}
+
+		switch {
+		case len(group.Recipients) < norm:
+			line += fmt.Sprintf(" [outlier: fewer recipients than set 1 (%d vs %d)]", len(group.Recipients), norm)
+		case len(group.Recipients) > norm:
+			line += fmt.Sprintf(" [outlier: more recipients than set 1 (%d vs %d)]", len(group.Recipients), norm)
+		default:
+			line += " [outlier: different recipients than set 1]"
+		}
+		lines = append(lines, line)
+		for _, path := range group.Paths {
+			lines = append(lines, "  - "+path)
+		}
+	}
+	return lines
+}
+
+// summarizeRecipients joins sorted recipient descriptions, collapsing repeats
+// (e.g. three anonymous X25519 stanzas become "X25519 ×3")
+func summarizeRecipients(recipients []string) string {
+	var parts []string
+	for i := 0; i < len(recipients); {
+		j := i
+		for j < len(recipients) && recipients[j] == recipients[i] {
+			j++
+		}
+		if j-i > 1 {
+			parts = append(parts, fmt.Sprintf("%s ×%d", recipients[i], j-i))
+		} else {
+			parts = append(parts, recipients[i])
+		}
+		i = j
+	}
+	return strings.Join(parts, ", ")
 }
 
 // isArmoredData checks if a string looks like ASCII-armored age data
 func isArmoredData(s string) bool {
-	return strings.Contains(s, "-----BEGIN AGE ENCRYPTED FILE-----") &&
-		strings.Contains(s, "-----END AGE ENCRYPTED FILE-----")
+	return enc.IsArmored(s)
 }
 
-// countAllFields counts all fields in a tree
-func countAllFields(tree any) int {
-	count := 0
+// renderTree renders a tree as indented lines, annotating each value as a
+// table, an array, an encrypted value, or a plain scalar
+func renderTree(tree any, indent string) []string {
+	var lines []string
+
 	switch v := tree.(type) {
 	case map[string]any:
-		for _, value := range v {
-			count++
-			count += countAllFields(value)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			lines = append(lines, indent+key+" "+treeAnnotation(v[key]))
+			lines = append(lines, renderTree(v[key], indent+"  ")...)
+		}
+	case []map[string]any:
+		for i, value := range v {
+			lines = append(lines, fmt.Sprintf("%s[%d] %s", indent, i, treeAnnotation(value)))
+			lines = append(lines, renderTree(value, indent+"  ")...)
 		}
 	case []any:
-		for _, value := range v {
-			count += countAllFields(value)
+		for i, value := range v {
+			lines = append(lines, fmt.Sprintf("%s[%d] %s", indent, i, treeAnnotation(value)))
+			lines = append(lines, renderTree(value, indent+"  ")...)
 		}
 	}
-	return count
+
+	return lines
+}
+
+// treeAnnotation describes a value for the tree view
+func treeAnnotation(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "[table]"
+	case []map[string]any:
+		return fmt.Sprintf("[array: %d]", len(v))
+	case []any:
+		return fmt.Sprintf("[array: %d]", len(v))
+	case string:
+		if isArmoredData(v) {
+			return "[encrypted]"
+		}
+	}
+	return "[scalar]"
 }
 
-// extractRecipientsFromArmor extracts recipient info from armor block (simplified)
+// extractRecipientsFromArmor describes the recipients of an armored block from
+// its age header (see enc.Stanza.RecipientTag), or returns nil if it is unreadable
 func extractRecipientsFromArmor(armored string) []string {
-	// This is a simplified implementation
-	// In a real implementation, you'd parse the armor header
-	if strings.Contains(armored, "scrypt") {
-		return []string{"passphrase"}
+	header, err := enc.ParseHeader(armored)
+	if err != nil {
+		return nil
 	}
-	return []string{"X25519 recipient"}
+	return header.RecipientTags()
 }
 
-// isValidArmor checks if an armor block has valid structure
-func isValidArmor(armored string) bool {
-	return strings.Contains(armored, "-----BEGIN AGE ENCRYPTED FILE-----") &&
-		strings.Contains(armored, "-----END AGE ENCRYPTED FILE-----") &&
-		strings.Index(armored, "-----BEGIN AGE ENCRYPTED FILE-----") <
-		strings.Index(armored, "-----END AGE ENCRYPTED FILE-----")
+// recipientNotesByArmor indexes the recipient annotations of loaded fields by armored value
+func recipientNotesByArmor(fields []viola.FieldMeta) map[string][]viola.RecipientNote {
+	notes := make(map[string][]viola.RecipientNote)
+	for _, field := range fields {
+		if len(field.RecipientNotes) > 0 {
+			notes[field.Armored] = field.RecipientNotes
+		}
+	}
+	return notes
 }
 
-// findFieldsToEncrypt finds all fields that would be encrypted based on prefix
-func findFieldsToEncrypt(tree any, path []string, prefix string) [][]string {
-	var fields [][]string
+// describeRecipientNote formats a recipient annotation for display, e.g.
+// "x25519:1f3a9c0e (alice laptop, expires 2025-12-31)", with the complete
+// key when full is set
+func describeRecipientNote(note viola.RecipientNote, now time.Time, full bool) string {
+	recipient := displayKey(note.Recipient, full)
 
-	switch v := tree.(type) {
-	case map[string]any:
-		for key, value := range v {
-			newPath := append(path, key)
-			if strings.HasPrefix(key, prefix) {
-				// This field would be encrypted
-				fields = append(fields, newPath)
-			} else {
-				// Recursively check nested structures
-				fields = append(fields, findFieldsToEncrypt(value, newPath, prefix)...)
+	var details []string
+	if note.Label != "" {
+		details = append(details, note.Label)
+	}
+	if !note.Expires.IsZero() {
+		if note.Expired(now) {
+			details = append(details, "EXPIRED "+note.Expires.Format(time.DateOnly))
+		} else {
+			details = append(details, "expires "+note.Expires.Format(time.DateOnly))
+		}
+	}
+
+	if len(details) == 0 {
+		return recipient
+	}
+	return fmt.Sprintf("%s (%s)", recipient, strings.Join(details, ", "))
+}
+
+// expiredRecipientWarnings lists each annotated recipient whose review date has
+// passed, with the fields it is annotated on, sorted by recipient
+func expiredRecipientWarnings(fields []viola.FieldMeta, now time.Time) []string {
+	expired := make(map[string]viola.RecipientNote)
+	paths := make(map[string][]string)
+	for _, field := range fields {
+		for _, note := range field.RecipientNotes {
+			if note.Expired(now) {
+				expired[note.Recipient] = note
+				paths[note.Recipient] = append(paths[note.Recipient], strings.Join(field.Path, "."))
 			}
 		}
-	case []any:
-		for i, value := range v {
-			newPath := append(path, fmt.Sprintf("[%d]", i))
-			fields = append(fields, findFieldsToEncrypt(value, newPath, prefix)...)
+	}
+
+	recipients := make([]string, 0, len(expired))
+	for recipient := range expired {
+		recipients = append(recipients, recipient)
+	}
+	sort.Strings(recipients)
+
+	warnings := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		note := expired[recipient]
+		name := recipient
+		if note.Label != "" {
+			name = fmt.Sprintf("%s (%s)", recipient, note.Label)
+		}
+		warnings = append(warnings, fmt.Sprintf("Recipient %s expired %s, on: %s",
+			name, note.Expires.Format(time.DateOnly), strings.Join(paths[recipient], ", ")))
+	}
+	return warnings
+}
+
+// Statuses of a field in the encrypt --dry-run preview
+const (
+	previewEncrypt   = "encrypt"   // Plaintext, will be encrypted
+	previewSkip      = "skip"      // Already encrypted in the input, left as-is
+	previewNew       = "new"       // Will be encrypted, but is plaintext in the existing output
+	previewUnmatched = "unmatched" // Encrypted in the existing output, but no longer matched
+)
+
+// previewEntry is one line of the encrypt --dry-run preview
+type previewEntry struct {
+	Path   string
+	Status string
+}
+
+// previewEncryption classifies every field the rule matches in tree, plus any
+// field encrypted in previous (the existing output, or nil) that the rule no
+// longer covers. Entries are sorted by path.
+func previewEncryption(tree map[string]any, shouldEncrypt func(path []string, key string, value any) bool, previous map[string]any) []previewEntry {
+	var entries []previewEntry
+	matched := make(map[string]bool)
+
+	for _, path := range findFieldsToEncrypt(tree, shouldEncrypt) {
+		dotted := strings.Join(path, ".")
+		matched[dotted] = true
+
+		value, _ := walk.GetValue(tree, path)
+		status := previewEncrypt
+		if strValue, ok := value.(string); ok && isArmoredData(strValue) {
+			status = previewSkip
+		} else if previous != nil {
+			if old, found := walk.GetValue(previous, path); !found || !isArmoredValue(old) {
+				status = previewNew
+			}
+		}
+		entries = append(entries, previewEntry{Path: dotted, Status: status})
+	}
+
+	if previous != nil {
+		for _, field := range findEncryptedFields(previous, nil) {
+			if !coveredByMatch(field.Path, matched) {
+				entries = append(entries, previewEntry{Path: strings.Join(field.Path, "."), Status: previewUnmatched})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// coveredByMatch reports whether path or one of its ancestors is in matched
+func coveredByMatch(path []string, matched map[string]bool) bool {
+	for i := len(path); i > 0; i-- {
+		if matched[strings.Join(path[:i], ".")] {
+			return true
 		}
 	}
+	return false
+}
+
+// isArmoredValue reports whether value is an armored age block
+func isArmoredValue(value any) bool {
+	strValue, ok := value.(string)
+	return ok && isArmoredData(strValue)
+}
+
+// describePreviewEntry formats a preview entry; outputFile names the existing output
+func describePreviewEntry(entry previewEntry, outputFile string) string {
+	switch entry.Status {
+	case previewSkip:
+		return fmt.Sprintf("= %s (already encrypted, skipped)", entry.Path)
+	case previewNew:
+		return fmt.Sprintf("* %s (newly matched; plaintext in %s)", entry.Path, outputFile)
+	case previewUnmatched:
+		return fmt.Sprintf("- %s (encrypted in %s, no longer matched: will be plaintext)", entry.Path, outputFile)
+	default:
+		return fmt.Sprintf("+ %s (plaintext, will be encrypted)", entry.Path)
+	}
+}
+
+// secretKeyPattern matches keys that usually hold secrets
+var secretKeyPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token)`)
+
+// unmatchedSecretFields lists plaintext scalar fields whose key looks like a
+// secret but which the rule leaves unencrypted, sorted
+func unmatchedSecretFields(tree any, shouldEncrypt func(path []string, key string, value any) bool) []string {
+	var paths []string
+
+	walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+		if key == "" {
+			return value, true
+		}
+		if shouldEncrypt(path, key, value) {
+			return value, false
+		}
+		if secretKeyPattern.MatchString(key) && walk.IsScalarValue(value) && !isArmoredValue(value) {
+			paths = append(paths, strings.Join(append(append([]string{}, path...), key), "."))
+		}
+		return value, true
+	})
+
+	sort.Strings(paths)
+	return paths
+}
+
+// findFieldsToEncrypt finds all fields that Save would encrypt with the given rule.
+// Matched tables and arrays are not descended into, since they are encrypted whole.
+func findFieldsToEncrypt(tree any, shouldEncrypt func(path []string, key string, value any) bool) [][]string {
+	var fields [][]string
+
+	walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+		if key != "" && shouldEncrypt(path, key, value) {
+			fields = append(fields, append(append([]string{}, path...), key))
+			return value, false
+		}
+		return value, true
+	})
+
+	sort.Slice(fields, func(i, j int) bool {
+		return strings.Join(fields[i], ".") < strings.Join(fields[j], ".")
+	})
 
 	return fields
 }
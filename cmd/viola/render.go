@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/internal/walk"
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+func renderCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "render",
+		Usage:     "Render a Go text/template with the decrypted configuration",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "template",
+				Aliases:  []string{"t"},
+				Usage:    "Path to the text/template file; the decrypted tree is the dot context",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Write the result to this file (mode 0600) instead of stdout",
+			},
+			&cli.StringSliceFlag{
+				Name:    "identity",
+				Aliases: []string{"i"},
+				Usage:   "Path to age identity file",
+				Value:   cli.NewStringSlice(),
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Directory whose identity files are all loaded, like repeating --identity (non-key files are skipped)",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Inline age identity key (insecure, for testing)",
+			},
+			&cli.StringFlag{
+				Name:  "identity-passphrase",
+				Usage: "Passphrase for age-encrypted --identity files, instead of prompting (insecure)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Prompt for passphrase interactively",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-file",
+				Usage: "Read passphrase from file (first line)",
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase-raw",
+				Usage: "Use the whole --passphrase-file verbatim instead of its trimmed first line",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "Read passphrase from environment variable",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output",
+			},
+		},
+		Action: renderAction,
+	}
+}
+
+func renderAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), exitUserError)
+	}
+
+	templateFile := c.String("template")
+	templateText, err := os.ReadFile(templateFile)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading template: %v", err)), exitUserError)
+	}
+	tmpl, err := template.New(filepath.Base(templateFile)).Funcs(renderFuncs()).Parse(string(templateText))
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing template: %v", err)), exitUserError)
+	}
+
+	keySources, err := buildKeySources(c)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error setting up keys: %v", err)), exitUserError)
+	}
+
+	data, err := readInput(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
+	}
+
+	result, err := viola.Load(data, viola.Options{Keys: keySources})
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading configuration: %v", err)), exitUserError)
+	}
+
+	// Armor rendered into a config file would only fail later, and less clearly
+	if failed := undecryptablePaths(result.Fields); len(failed) > 0 {
+		msg := fmt.Sprintf("Error: %d encrypted field(s) could not be decrypted:\n  %s", len(failed), strings.Join(failed, "\n  "))
+		return cli.NewExitError(errorStyle.Render(msg), exitUserError)
+	}
+
+	// Render fully before writing, so a failed template leaves no partial file
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, result.Tree); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error rendering template: %v", err)), exitUserError)
+	}
+
+	output := c.String("output")
+	if output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return nil
+	}
+
+	if err := os.WriteFile(output, buf.Bytes(), 0600); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing output: %v", err)), exitUserError)
+	}
+	if !c.Bool("quiet") {
+		fmt.Fprintln(os.Stderr, successStyle.Render(fmt.Sprintf("✓ Rendered %s to %s", templateFile, output)))
+	}
+	return nil
+}
+
+// renderFuncs are the functions available to render templates, on top of the
+// text/template builtins:
+//
+//	required "message" .database.private_password  fails with message if the value is missing or empty
+//	get "servers[name=prod].private_key"           looks up a dotted path or selector, for keys that aren't identifiers
+func renderFuncs() template.FuncMap {
+	return template.FuncMap{
+		"required": func(message string, value any) (any, error) {
+			if value == nil {
+				return nil, fmt.Errorf("required value missing: %s", message)
+			}
+			if s, ok := value.(string); ok && s == "" {
+				return nil, fmt.Errorf("required value empty: %s", message)
+			}
+			return value, nil
+		},
+		"get": func(path string, tree map[string]any) any {
+			value, _ := walk.GetValueBySelector(tree, path)
+			return value
+		},
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/pkg/enc"
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+func planRotateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "plan-rotate",
+		Usage: "List the encrypted fields a departing recipient can still read, from their age headers alone",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "old",
+				Usage:    "The departing recipient: an age1... key or an ssh-ed25519/ssh-rsa public key",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "in",
+				Usage:    "Glob of encrypted files to scan, e.g. 'config/*.toml' (can be repeated)",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Only print fields the old recipient can read",
+			},
+		},
+		Action: planRotateAction,
+	}
+}
+
+// Exposure of a field to the old recipient, as far as its header tells
+const (
+	exposureReadable = "readable"
+	exposurePossible = "possibly readable"
+)
+
+// rotationMatch is an encrypted field the old recipient may still read
+type rotationMatch struct {
+	File     string
+	Path     string
+	Exposure string
+	Reason   string
+}
+
+func planRotateAction(c *cli.Context) error {
+	old := strings.TrimSpace(c.String("old"))
+	matchField, err := rotationMatcher(old)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: --old: %v", err)), exitUserError)
+	}
+
+	files, err := globFiles(c.StringSlice("in"))
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error: %v", err)), exitUserError)
+	}
+	if len(files) == 0 {
+		return cli.NewExitError(errorStyle.Render("Error: --in matched no files"), exitUserError)
+	}
+
+	quiet := c.Bool("quiet")
+	if !quiet {
+		fmt.Print(headerStyle.Render(" PLAN-ROTATE COMMAND "))
+		fmt.Println()
+		fmt.Println()
+		fmt.Printf("Old recipient: %s\n\n", displayKey(old, false))
+	}
+
+	var matches []rotationMatch
+	scanned := 0
+	for _, file := range files {
+		data, err := readFile(file)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), exitUserError)
+		}
+
+		// No keys: only the armor and any recipient annotations are needed
+		result, err := viola.Load(data, viola.Options{})
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error parsing %s: %v", file, err)), exitUserError)
+		}
+
+		for _, field := range result.Fields {
+			if !field.WasEncrypted {
+				continue
+			}
+			scanned++
+			exposure, reason := matchField(field)
+			if exposure != "" {
+				matches = append(matches, rotationMatch{File: file, Path: strings.Join(field.Path, "."), Exposure: exposure, Reason: reason})
+			}
+		}
+	}
+
+	readable := 0
+	for _, match := range matches {
+		line := fmt.Sprintf("%s: %s: %s (%s)", match.File, match.Path, match.Exposure, match.Reason)
+		if match.Exposure == exposureReadable {
+			readable++
+			fmt.Println(errorStyle.Render("✗ " + line))
+		} else if !quiet {
+			fmt.Println(infoStyle.Render("? " + line))
+		}
+	}
+
+	if !quiet {
+		if len(matches) > 0 {
+			fmt.Println()
+		}
+		summary := fmt.Sprintf("%d of %d encrypted field(s) in %d file(s) readable by the old recipient, %d possibly", readable, scanned, len(files), len(matches)-readable)
+		if readable > 0 {
+			fmt.Println(errorStyle.Render(summary))
+		} else {
+			fmt.Println(successStyle.Render("✓ " + summary))
+		}
+	}
+
+	// Only certain exposure fails: anonymous X25519 stanzas would otherwise
+	// fail every file that lacks recipient annotations
+	if readable > 0 {
+		return cli.NewExitError("", exitUserError)
+	}
+	return nil
+}
+
+// rotationMatcher returns a function telling, from its header and recipient
+// annotations, whether old can read a field: exposureReadable,
+// exposurePossible, or "" for no, with the reason
+func rotationMatcher(old string) (func(field viola.FieldMeta) (string, string), error) {
+	recipient, err := enc.ParseRecipient(old)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(old, "ssh-") {
+		tag, err := enc.SSHRecipientTag(old)
+		if err != nil {
+			return nil, err
+		}
+		// SSH stanzas name the key they were written for
+		return func(field viola.FieldMeta) (string, string) {
+			header, err := enc.ParseHeader(field.Armored)
+			if err != nil {
+				return exposurePossible, fmt.Sprintf("unreadable header: %v", err)
+			}
+			for _, stanzaTag := range header.RecipientTags() {
+				if stanzaTag == tag {
+					return exposureReadable, "stanza " + tag
+				}
+			}
+			return "", ""
+		}, nil
+	}
+
+	if _, ok := recipient.(*age.X25519Recipient); !ok {
+		return nil, fmt.Errorf("only age1 X25519 and SSH recipients can be matched against headers")
+	}
+
+	// X25519 stanzas are anonymous, so only recipient annotations can tell
+	return func(field viola.FieldMeta) (string, string) {
+		if len(field.RecipientNotes) > 0 {
+			for _, note := range field.RecipientNotes {
+				if note.Recipient == old {
+					return exposureReadable, "recipient annotation"
+				}
+			}
+			return "", ""
+		}
+
+		header, err := enc.ParseHeader(field.Armored)
+		if err != nil {
+			return exposurePossible, fmt.Sprintf("unreadable header: %v", err)
+		}
+		x25519 := 0
+		for _, stanza := range header.Stanzas {
+			if stanza.Type == "X25519" {
+				x25519++
+			}
+		}
+		if x25519 == 0 {
+			return "", ""
+		}
+		return exposurePossible, fmt.Sprintf("%d anonymous X25519 stanza(s); encrypt with --recipient-meta to record recipients", x25519)
+	}, nil
+}
+
+// globFiles expands each pattern and returns the matching files, sorted and
+// without duplicates
+func globFiles(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"github.com/andreweick/viola/pkg/sign"
+)
+
+func signCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "sign",
+		Usage:     "Create a detached SSH signature over an encrypted file",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "identity",
+				Aliases:  []string{"i"},
+				Usage:    "Path to SSH private key used for signing",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Signature output path (default: <file>.sig)",
+			},
+			&cli.BoolFlag{
+				Name:    "force",
+				Aliases: []string{"f"},
+				Usage:   "Overwrite signature file if it exists",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output",
+			},
+		},
+		Action: signAction,
+	}
+}
+
+func verifySignatureCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "verify-signature",
+		Usage:     "Verify a detached SSH signature over an encrypted file",
+		ArgsUsage: "<file> <signature>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "signers",
+				Aliases:  []string{"recipients", "r"},
+				Usage:    "Path to allowed signers' SSH public keys (authorized_keys format)",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Suppress non-essential output",
+			},
+		},
+		Action: verifySignatureAction,
+	}
+}
+
+func signAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return cli.NewExitError(errorStyle.Render("Error: No file specified"), 1)
+	}
+
+	data, err := readFile(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+	}
+
+	signer, err := loadSSHSigner(c.String("identity"))
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error loading signing key: %v", err)), 1)
+	}
+
+	sig, err := sign.Sign(data, signer, sign.Namespace)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error signing file: %v", err)), 1)
+	}
+
+	outputFile := c.String("output")
+	if outputFile == "" {
+		outputFile = filename + ".sig"
+	}
+	if _, err := os.Stat(outputFile); err == nil && !c.Bool("force") {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Output file exists: %s (use --force to overwrite)", outputFile)), 1)
+	}
+
+	if err := os.WriteFile(outputFile, sig, 0644); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error writing signature: %v", err)), 1)
+	}
+
+	if !c.Bool("quiet") {
+		fmt.Printf("✓ Signature written to: %s (%s)\n", outputFile, ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+
+	return nil
+}
+
+func verifySignatureAction(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError(errorStyle.Render("Error: Expected <file> <signature>"), 1)
+	}
+	filename, sigFile := c.Args().Get(0), c.Args().Get(1)
+
+	data, err := readFile(filename)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading file: %v", err)), 1)
+	}
+
+	sig, err := readFile(sigFile)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading signature: %v", err)), 1)
+	}
+
+	var allowed []ssh.PublicKey
+	for _, signersFile := range c.StringSlice("signers") {
+		signersData, err := readFile(signersFile)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading signers: %v", err)), 1)
+		}
+		keys, err := sign.ParseSigners(signersData)
+		if err != nil {
+			return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error reading signers %s: %v", signersFile, err)), 1)
+		}
+		allowed = append(allowed, keys...)
+	}
+	if len(allowed) == 0 {
+		return cli.NewExitError(errorStyle.Render("Error: No signer keys found"), 1)
+	}
+
+	key, err := sign.Verify(data, sig, allowed, sign.Namespace)
+	if err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("✗ Bad signature: %v", err)), 1)
+	}
+
+	if !c.Bool("quiet") {
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ Good signature from %s", ssh.FingerprintSHA256(key))))
+	}
+
+	return nil
+}
+
+// loadSSHSigner reads an SSH private key, prompting for its passphrase if it is encrypted
+func loadSSHSigner(keyFile string) (ssh.Signer, error) {
+	keyData, err := readFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyData)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		fmt.Fprint(os.Stderr, "Enter passphrase for SSH key: ")
+		passphrase, readErr := term.ReadPassword(int(syscall.Stdin))
+		fmt.Fprintln(os.Stderr)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", readErr)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH private key %s: %w", keyFile, err)
+	}
+
+	return signer, nil
+}
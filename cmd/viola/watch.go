@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/urfave/cli/v2"
+
+	"github.com/andreweick/viola/pkg/enc"
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+// watchDebounce is how long a file must be quiet before it is re-read, so an
+// editor's burst of writes triggers one refresh
+const watchDebounce = 200 * time.Millisecond
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// watchRead runs the read pipeline, then again each time filename changes,
+// until interrupted. Errors are printed rather than returned, since the file
+// may be briefly invalid while it is being edited.
+func watchRead(c *cli.Context, filename string, keySources enc.KeySources) error {
+	// Usually only a few fields change between saves; skip age for the rest
+	cache := viola.NewMemoryDecryptCache()
+	defer cache.Clear()
+
+	refresh := func() {
+		fmt.Print(clearScreen)
+		if err := readOnce(c, filename, keySources, cache); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if !c.Bool("quiet") {
+			fmt.Fprintln(os.Stderr, infoStyle.Render(fmt.Sprintf("Watching %s for changes (Ctrl+C to stop)", filename)))
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	refresh()
+	if err := watchFile(filename, watchDebounce, signals, refresh); err != nil {
+		return cli.NewExitError(errorStyle.Render(fmt.Sprintf("Error watching file: %v", err)), 1)
+	}
+	return nil
+}
+
+// watchFile calls onChange once filename has been written or replaced and
+// then left alone for debounce. It watches the parent directory so editors
+// that save by renaming a new file into place are seen. It returns nil when
+// stop receives a signal.
+func watchFile(filename string, debounce time.Duration, stop <-chan os.Signal, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	target := filepath.Clean(filename)
+	if err := watcher.Add(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == target && event.Has(fsnotify.Write|fsnotify.Create) {
+				pending = time.After(debounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+
+		case <-pending:
+			pending = nil
+			onChange()
+		}
+	}
+}
@@ -1,9 +1,19 @@
 // Package walk provides utilities for traversing TOML data structures.
+//
+// The traversal and lookup functions (Walk, WalkWithLimit, WalkTyped,
+// FindFields, GetValue, ...) never modify the data they are given, so any
+// number of goroutines may use them on the same data at once. SetValue,
+// SetValueDeep, and SetValueBySelector modify data in place: don't call them
+// while anything else reads or walks the same data.
 package walk
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // VisitFunc is called for each field during traversal.
@@ -15,12 +25,61 @@ type VisitFunc func(path []string, key string, value any) (newValue any, cont bo
 
 // Walk traverses a parsed TOML data structure (map[string]any) and calls the visitor
 // function for each field. The visitor can modify values by returning a different value.
+//
+// Walk returns a new tree: every table and array is copied, so data itself is
+// never modified. The visitor is called sequentially on the calling goroutine,
+// so it can collect results (e.g. append to a slice) without locking. It must
+// not modify the path slice it is given, which is shared with its siblings.
 func Walk(data any, visit VisitFunc) any {
-	return walkValue(nil, "", data, visit)
+	return walkValue(nil, "", data, visit, nil)
+}
+
+// ErrMaxDepth is returned by WalkWithLimit when the data is nested deeper than the limit
+var ErrMaxDepth = errors.New("maximum nesting depth exceeded")
+
+// WalkWithLimit is like Walk but refuses to descend more than limit levels below
+// the root, which also stops runaway recursion on a tree that contains itself.
+// Fields beyond the limit are neither visited nor changed, and an error wrapping
+// ErrMaxDepth names the first one reached. A limit of zero or less means no limit.
+func WalkWithLimit(data any, limit int, visit VisitFunc) (any, error) {
+	dl := &depthLimit{max: limit}
+	result := walkValue(nil, "", data, visit, dl)
+	return result, dl.err
+}
+
+// depthLimit tracks the depth limit for a WalkWithLimit traversal
+type depthLimit struct {
+	max int
+	err error
+}
+
+// exceeded reports whether the field at path/key lies beyond the limit,
+// recording an error for the first such field
+func (dl *depthLimit) exceeded(path []string, key string) bool {
+	if dl == nil || dl.max <= 0 {
+		return false
+	}
+
+	depth := len(path)
+	if key != "" {
+		depth++
+	}
+	if depth <= dl.max {
+		return false
+	}
+
+	if dl.err == nil {
+		dl.err = fmt.Errorf("%w (%d) at %s", ErrMaxDepth, dl.max, strings.Join(append(path[:len(path):len(path)], key), "."))
+	}
+	return true
 }
 
 // walkValue recursively walks through any value type
-func walkValue(path []string, key string, value any, visit VisitFunc) any {
+func walkValue(path []string, key string, value any, visit VisitFunc, dl *depthLimit) any {
+	if dl.exceeded(path, key) {
+		return value
+	}
+
 	// Call the visitor for this value
 	newValue, cont := visit(path, key, value)
 	if !cont {
@@ -32,9 +91,12 @@ func walkValue(path []string, key string, value any, visit VisitFunc) any {
 
 	switch v := value.(type) {
 	case map[string]any:
-		return walkMap(path, key, v, visit)
+		return walkMap(path, key, v, visit, dl)
 	case []any:
-		return walkSlice(path, key, v, visit)
+		return walkSlice(path, key, v, visit, dl)
+	case []map[string]any:
+		// TOML arrays of tables decode to []map[string]any
+		return walkSlice(path, key, toSlice(v), visit, dl)
 	default:
 		// Leaf value (string, int, bool, etc.)
 		return value
@@ -42,7 +104,7 @@ func walkValue(path []string, key string, value any, visit VisitFunc) any {
 }
 
 // walkMap walks through a map (TOML table)
-func walkMap(parentPath []string, parentKey string, m map[string]any, visit VisitFunc) map[string]any {
+func walkMap(parentPath []string, parentKey string, m map[string]any, visit VisitFunc, dl *depthLimit) map[string]any {
 	// Build the path for this level
 	var currentPath []string
 	if parentKey != "" {
@@ -50,17 +112,19 @@ func walkMap(parentPath []string, parentKey string, m map[string]any, visit Visi
 	} else {
 		currentPath = parentPath
 	}
+	// Clip capacity so visitors that append to path get their own copy
+	currentPath = currentPath[:len(currentPath):len(currentPath)]
 
 	result := make(map[string]any)
 	for k, v := range m {
-		newValue := walkValue(currentPath, k, v, visit)
+		newValue := walkValue(currentPath, k, v, visit, dl)
 		result[k] = newValue
 	}
 	return result
 }
 
 // walkSlice walks through a slice (TOML array)
-func walkSlice(parentPath []string, parentKey string, s []any, visit VisitFunc) []any {
+func walkSlice(parentPath []string, parentKey string, s []any, visit VisitFunc, dl *depthLimit) []any {
 	// Build the path for this level
 	var currentPath []string
 	if parentKey != "" {
@@ -68,17 +132,116 @@ func walkSlice(parentPath []string, parentKey string, s []any, visit VisitFunc)
 	} else {
 		currentPath = parentPath
 	}
+	// Clip capacity so visitors that append to path get their own copy
+	currentPath = currentPath[:len(currentPath):len(currentPath)]
 
 	result := make([]any, len(s))
 	for i, v := range s {
 		// For arrays, use the index as the key
 		indexKey := fmt.Sprintf("[%d]", i)
-		newValue := walkValue(currentPath, indexKey, v, visit)
+		newValue := walkValue(currentPath, indexKey, v, visit, dl)
 		result[i] = newValue
 	}
 	return result
 }
 
+// PathSegment is one step in a path: a table key, or an array index
+type PathSegment struct {
+	Key   string // Table key; empty for array elements
+	Index int    // Array index; -1 for table keys
+}
+
+// IsIndex reports whether the segment addresses an array element
+func (ps PathSegment) IsIndex() bool {
+	return ps.Index >= 0
+}
+
+// String returns the segment in the string form used by Walk, e.g. "name" or "[0]"
+func (ps PathSegment) String() string {
+	if ps.IsIndex() {
+		return fmt.Sprintf("[%d]", ps.Index)
+	}
+	return ps.Key
+}
+
+// SegmentStrings converts structured segments to the string path form used by Walk and GetValue
+func SegmentStrings(path []PathSegment) []string {
+	result := make([]string, len(path))
+	for i, seg := range path {
+		result[i] = seg.String()
+	}
+	return result
+}
+
+// TypedVisitFunc is called for each value during WalkTyped traversal.
+// path holds the segments leading to the value, including its own (empty for the root).
+// Returns the new value and whether to continue traversal, as with VisitFunc.
+type TypedVisitFunc func(path []PathSegment, value any) (newValue any, cont bool)
+
+// WalkTyped is like Walk but reports paths as structured segments, so array
+// indices arrive as integers rather than "[0]"-style strings.
+func WalkTyped(data any, visit TypedVisitFunc) any {
+	return walkTypedValue(nil, data, visit)
+}
+
+// walkTypedValue recursively walks through any value type for WalkTyped
+func walkTypedValue(path []PathSegment, value any, visit TypedVisitFunc) any {
+	newValue, cont := visit(path, value)
+	if !cont {
+		return newValue
+	}
+	value = newValue
+
+	if maps, ok := value.([]map[string]any); ok {
+		value = toSlice(maps)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			result[k] = walkTypedValue(appendSegment(path, PathSegment{Key: k, Index: -1}), item, visit)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = walkTypedValue(appendSegment(path, PathSegment{Index: i}), item, visit)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// appendSegment returns a new path with seg appended, never sharing path's backing array
+func appendSegment(path []PathSegment, seg PathSegment) []PathSegment {
+	result := make([]PathSegment, len(path), len(path)+1)
+	copy(result, path)
+	return append(result, seg)
+}
+
+// parseIndex parses an array key like "[0]" into its index
+func parseIndex(key string) (int, bool) {
+	if len(key) < 3 || key[0] != '[' || key[len(key)-1] != ']' {
+		return 0, false
+	}
+	index, err := strconv.Atoi(key[1 : len(key)-1])
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// toSlice converts a slice of maps to a generic slice
+func toSlice(maps []map[string]any) []any {
+	result := make([]any, len(maps))
+	for i, m := range maps {
+		result[i] = m
+	}
+	return result
+}
+
 // FindFields searches for fields matching a predicate function and returns their paths and values
 func FindFields(data any, predicate func(path []string, key string, value any) bool) []FieldInfo {
 	var results []FieldInfo
@@ -86,10 +249,13 @@ func FindFields(data any, predicate func(path []string, key string, value any) b
 	Walk(data, func(path []string, key string, value any) (any, bool) {
 		if predicate(path, key, value) {
 			fullPath := append(path, key)
+			index, isArrayElem := parseIndex(key)
 			results = append(results, FieldInfo{
-				Path:  fullPath,
-				Key:   key,
-				Value: value,
+				Path:        fullPath,
+				Key:         key,
+				Value:       value,
+				Index:       index,
+				IsArrayElem: isArrayElem,
 			})
 		}
 		return value, true
@@ -98,11 +264,54 @@ func FindFields(data any, predicate func(path []string, key string, value any) b
 	return results
 }
 
+// AllLeaves returns every scalar leaf in data with its full path, array
+// elements included (as "[0]", "[1]", ... like FindFields). Empty tables and
+// arrays have no leaves. Leaves are ordered by path, with indices in numeric order.
+func AllLeaves(data any) []FieldInfo {
+	leaves := FindFields(data, func(path []string, key string, value any) bool {
+		return key != "" && IsScalarValue(value)
+	})
+
+	sort.Slice(leaves, func(i, j int) bool {
+		return comparePaths(leaves[i].Path, leaves[j].Path) < 0
+	})
+	return leaves
+}
+
+// AllPaths returns the dotted path of every scalar leaf in data (e.g.
+// "servers.[0].name"), in the same order as AllLeaves
+func AllPaths(data any) []string {
+	leaves := AllLeaves(data)
+	paths := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		paths[i] = leaf.GetFullPath()
+	}
+	return paths
+}
+
+// comparePaths orders paths segment by segment, comparing array indices numerically
+func comparePaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		ai, aIsIndex := parseIndex(a[i])
+		bi, bIsIndex := parseIndex(b[i])
+		if aIsIndex && bIsIndex {
+			return ai - bi
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return len(a) - len(b)
+}
+
 // FieldInfo contains information about a field found during traversal
 type FieldInfo struct {
-	Path  []string // Full path including the key
-	Key   string   // Just the key
-	Value any      // The value
+	Path        []string // Full path including the key
+	Key         string   // Just the key
+	Value       any      // The value
+	Index       int      // Array index when IsArrayElem is set
+	IsArrayElem bool     // Whether the field is an array element (Key is "[Index]")
 }
 
 // GetFullPath returns the full path as a string, e.g., "database.config.private_password"
@@ -121,6 +330,159 @@ func (fi FieldInfo) GetFullPath() string {
 	return result
 }
 
+// ParsePath splits a dotted path into the segments used by GetValue and SetValue.
+// Array indices may be written as their own segment or attached to a key, so both
+// "servers.[0].name" and "servers[0].name" yield ["servers", "[0]", "name"].
+// Dots inside brackets don't split, so selectors like "[host=db.internal]" stay whole.
+func ParsePath(s string) []string {
+	var path []string
+	for _, part := range splitOutsideBrackets(s) {
+		for part != "" {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				path = append(path, part)
+				break
+			}
+			if open > 0 {
+				path = append(path, part[:open])
+				part = part[open:]
+				continue
+			}
+			end := strings.Index(part, "]")
+			if end < 0 {
+				path = append(path, part)
+				break
+			}
+			path = append(path, part[:end+1])
+			part = part[end+1:]
+		}
+	}
+	return path
+}
+
+// splitOutsideBrackets splits s on dots that are not inside square brackets
+func splitOutsideBrackets(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case '.':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseSelector parses a "[key=value]" segment. Quotes around the value are optional.
+func parseSelector(segment string) (key, value string, ok bool) {
+	if !strings.HasPrefix(segment, "[") || !strings.HasSuffix(segment, "]") {
+		return "", "", false
+	}
+	key, value, ok = strings.Cut(segment[1:len(segment)-1], "=")
+	if !ok || key == "" {
+		return "", "", false
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	return key, value, true
+}
+
+// ResolveSelector converts a path that may contain "[key=value]" selectors, such
+// as "servers[name=prod].api_key", into the index path it currently refers to
+// (["servers", "[1]", "api_key"]). A selector matches the first array element
+// that is a table whose key, formatted with fmt.Sprint, equals value. Index
+// segments and plain keys are passed through unchanged.
+func ResolveSelector(data any, selector string) ([]string, bool) {
+	return resolveSegments(data, ParsePath(selector))
+}
+
+// resolveSegments replaces selector segments in path with array indices,
+// requiring every segment to exist
+func resolveSegments(data any, path []string) ([]string, bool) {
+	resolved := make([]string, 0, len(path))
+
+	current := data
+	for _, segment := range path {
+		if maps, ok := current.([]map[string]any); ok {
+			current = toSlice(maps)
+		}
+
+		if key, value, ok := parseSelector(segment); ok {
+			elements, isSlice := current.([]any)
+			if !isSlice {
+				return nil, false
+			}
+			match := -1
+			for i, element := range elements {
+				if table, ok := element.(map[string]any); ok {
+					if field, exists := table[key]; exists && fmt.Sprint(field) == value {
+						match = i
+						break
+					}
+				}
+			}
+			if match < 0 {
+				return nil, false
+			}
+			segment = fmt.Sprintf("[%d]", match)
+		}
+
+		next, found := GetValue(current, []string{segment})
+		if !found {
+			return nil, false
+		}
+		resolved = append(resolved, segment)
+		current = next
+	}
+
+	return resolved, true
+}
+
+// GetValueBySelector gets a value using a dotted path that may contain
+// "[key=value]" selectors (see ResolveSelector)
+func GetValueBySelector(data any, selector string) (any, bool) {
+	path, ok := ResolveSelector(data, selector)
+	if !ok {
+		return nil, false
+	}
+	return GetValue(data, path)
+}
+
+// SetValueBySelector sets a value using a dotted path that may contain
+// "[key=value]" selectors (see ResolveSelector). As with SetValue, the final
+// key may be new, but everything before it must exist.
+func SetValueBySelector(data any, selector string, newValue any) bool {
+	path := ParsePath(selector)
+	if len(path) == 0 {
+		return false
+	}
+
+	last := path[len(path)-1]
+	if _, _, isSelector := parseSelector(last); isSelector {
+		resolved, ok := resolveSegments(data, path)
+		if !ok {
+			return false
+		}
+		return SetValue(data, resolved, newValue)
+	}
+
+	parent, ok := resolveSegments(data, path[:len(path)-1])
+	if !ok {
+		return false
+	}
+	return SetValue(data, append(parent, last), newValue)
+}
+
 // GetValue safely gets a value from the data structure using a path
 func GetValue(data any, path []string) (any, bool) {
 	if len(path) == 0 {
@@ -129,6 +491,9 @@ func GetValue(data any, path []string) (any, bool) {
 
 	current := data
 	for _, key := range path {
+		if maps, ok := current.([]map[string]any); ok {
+			current = toSlice(maps)
+		}
 		switch v := current.(type) {
 		case map[string]any:
 			val, exists := v[key]
@@ -138,15 +503,8 @@ func GetValue(data any, path []string) (any, bool) {
 			current = val
 		case []any:
 			// Handle array access like "[0]"
-			if len(key) < 3 || key[0] != '[' || key[len(key)-1] != ']' {
-				return nil, false
-			}
-			indexStr := key[1 : len(key)-1]
-			var index int
-			if _, err := fmt.Sscanf(indexStr, "%d", &index); err != nil {
-				return nil, false
-			}
-			if index < 0 || index >= len(v) {
+			index, ok := parseIndex(key)
+			if !ok || index >= len(v) {
 				return nil, false
 			}
 			current = v[index]
@@ -158,7 +516,8 @@ func GetValue(data any, path []string) (any, bool) {
 	return current, true
 }
 
-// SetValue safely sets a value in the data structure using a path
+// SetValue safely sets a value in the data structure using a path. It
+// modifies data in place.
 func SetValue(data any, path []string, newValue any) bool {
 	if len(path) == 0 {
 		return false
@@ -187,15 +546,8 @@ func SetValue(data any, path []string, newValue any) bool {
 		return true
 	case []any:
 		// Handle array access like "[0]"
-		if len(finalKey) < 3 || finalKey[0] != '[' || finalKey[len(finalKey)-1] != ']' {
-			return false
-		}
-		indexStr := finalKey[1 : len(finalKey)-1]
-		var index int
-		if _, err := fmt.Sscanf(indexStr, "%d", &index); err != nil {
-			return false
-		}
-		if index < 0 || index >= len(p) {
+		index, ok := parseIndex(finalKey)
+		if !ok || index >= len(p) {
 			return false
 		}
 		p[index] = newValue
@@ -205,6 +557,108 @@ func SetValue(data any, path []string, newValue any) bool {
 	}
 }
 
+// AppendMarker is the path segment SetValueDeep treats as "append to the end of the array"
+const AppendMarker = "[-]"
+
+// SetValueDeep sets a value like SetValue, but creates missing intermediate
+// tables as map[string]any and appends to arrays at the AppendMarker segment,
+// e.g. ["servers", "[-]", "name"] adds a new table to servers. Indexing past
+// the end of an array still fails. Nothing is modified when it returns false,
+// which includes a nil root: it is modified in place, so it must exist.
+func SetValueDeep(data any, path []string, newValue any) bool {
+	if len(path) == 0 || path[0] == AppendMarker {
+		// The root itself can't be replaced or grown
+		return false
+	}
+	if root, isMap := data.(map[string]any); data == nil || isMap && root == nil {
+		return false
+	}
+
+	_, ok := setDeep(data, path, newValue)
+	return ok
+}
+
+// setDeep sets newValue at path below node and returns the (possibly new) node
+func setDeep(node any, path []string, newValue any) (any, bool) {
+	if len(path) == 0 {
+		return newValue, true
+	}
+
+	key, rest := path[0], path[1:]
+
+	if key == AppendMarker {
+		child, ok := setDeep(nil, rest, newValue)
+		if !ok {
+			return node, false
+		}
+		switch v := node.(type) {
+		case nil:
+			return []any{child}, true
+		case []any:
+			return append(v, child), true
+		case []map[string]any:
+			if m, isMap := child.(map[string]any); isMap {
+				return append(v, m), true
+			}
+			return append(toSlice(v), child), true
+		default:
+			return node, false
+		}
+	}
+
+	if index, isIndex := parseIndex(key); isIndex {
+		switch v := node.(type) {
+		case []any:
+			if index >= len(v) {
+				return node, false
+			}
+			child, ok := setDeep(v[index], rest, newValue)
+			if !ok {
+				return node, false
+			}
+			v[index] = child
+			return v, true
+		case []map[string]any:
+			if index >= len(v) {
+				return node, false
+			}
+			child, ok := setDeep(v[index], rest, newValue)
+			if !ok {
+				return node, false
+			}
+			if m, isMap := child.(map[string]any); isMap {
+				v[index] = m
+				return v, true
+			}
+			converted := toSlice(v)
+			converted[index] = child
+			return converted, true
+		default:
+			return node, false
+		}
+	}
+
+	var m map[string]any
+	switch v := node.(type) {
+	case nil:
+		m = make(map[string]any)
+	case map[string]any:
+		m = v
+		if m == nil {
+			m = make(map[string]any)
+		}
+	default:
+		return node, false
+	}
+
+	child, ok := setDeep(m[key], rest, newValue)
+	if !ok {
+		return node, false
+	}
+	m[key] = child
+	return m, true
+}
+
 // IsScalarValue checks if a value is a scalar (not a map or slice)
 func IsScalarValue(value any) bool {
 	if value == nil {
@@ -1,8 +1,11 @@
 package walk
 
 import (
+	"errors"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -149,6 +152,65 @@ func TestWalk(t *testing.T) {
 	})
 }
 
+func TestWalkWithLimit(t *testing.T) {
+	identity := func(path []string, key string, value any) (any, bool) {
+		return value, true
+	}
+
+	// nest builds {"a": {"a": ... {"leaf": 1}}} with depth levels of tables
+	nest := func(depth int) map[string]any {
+		tree := map[string]any{"leaf": 1}
+		for i := 1; i < depth; i++ {
+			tree = map[string]any{"a": tree}
+		}
+		return tree
+	}
+
+	t.Run("within limit", func(t *testing.T) {
+		visited := 0
+		_, err := WalkWithLimit(nest(5), 5, func(path []string, key string, value any) (any, bool) {
+			visited++
+			return value, true
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if visited != 6 { // root, four tables, leaf
+			t.Errorf("Expected 6 visits, got %d", visited)
+		}
+	})
+
+	t.Run("beyond limit", func(t *testing.T) {
+		_, err := WalkWithLimit(nest(6), 5, identity)
+		if !errors.Is(err, ErrMaxDepth) {
+			t.Fatalf("Expected ErrMaxDepth, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "a.a.a.a.a.leaf") {
+			t.Errorf("Expected error to name the path, got %v", err)
+		}
+	})
+
+	t.Run("cyclic tree", func(t *testing.T) {
+		cyclic := map[string]any{"name": "loop"}
+		cyclic["self"] = cyclic
+		list := []any{"x"}
+		list = append(list, nil)
+		list[1] = list
+
+		for name, tree := range map[string]any{"map": cyclic, "slice": map[string]any{"list": list}} {
+			if _, err := WalkWithLimit(tree, 100, identity); !errors.Is(err, ErrMaxDepth) {
+				t.Errorf("%s: expected ErrMaxDepth, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		if _, err := WalkWithLimit(nest(50), 0, identity); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
 func TestFindFields(t *testing.T) {
 	testData := map[string]any{
 		"username":         "alice",
@@ -255,6 +317,52 @@ func TestGetValue(t *testing.T) {
 	}
 }
 
+func TestWalkArrayOfTables(t *testing.T) {
+	// TOML arrays of tables decode to []map[string]any rather than []any
+	testData := map[string]any{
+		"servers": []map[string]any{
+			{"name": "prod", "private_api_key": "key123"},
+			{"name": "staging", "private_api_key": "key456"},
+		},
+	}
+
+	fields := FindFields(testData, func(path []string, key string, value any) bool {
+		return strings.HasPrefix(key, "private_")
+	})
+
+	if len(fields) != 2 {
+		t.Fatalf("Expected 2 private fields inside array of tables, got %d", len(fields))
+	}
+
+	value, found := GetValue(testData, []string{"servers", "[1]", "name"})
+	if !found || value != "staging" {
+		t.Errorf("Expected servers.[1].name=staging, got %v (found=%v)", value, found)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"username", []string{"username"}},
+		{"database.host", []string{"database", "host"}},
+		{"servers.[0].name", []string{"servers", "[0]", "name"}},
+		{"servers[0].name", []string{"servers", "[0]", "name"}},
+		{"matrix[1][2]", []string{"matrix", "[1]", "[2]"}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			path := ParsePath(test.input)
+			if !reflect.DeepEqual(path, test.expected) {
+				t.Errorf("ParsePath(%q): expected %v, got %v", test.input, test.expected, path)
+			}
+		})
+	}
+}
+
 func TestSetValue(t *testing.T) {
 	t.Run("should set values in map", func(t *testing.T) {
 		testData := map[string]any{
@@ -332,6 +440,180 @@ func TestSetValue(t *testing.T) {
 	})
 }
 
+func TestValueBySelector(t *testing.T) {
+	newData := func() map[string]any {
+		return map[string]any{
+			"servers": []any{
+				map[string]any{"name": "staging", "id": int64(1), "private_api_key": "key-staging"},
+				map[string]any{"name": "prod", "id": int64(2), "private_api_key": "key-prod"},
+				map[string]any{"name": "db.internal", "id": int64(3)},
+			},
+			"tables": []map[string]any{
+				{"name": "users", "rows": int64(10)},
+			},
+		}
+	}
+
+	tests := []struct {
+		selector string
+		resolved []string
+		expected any
+		found    bool
+	}{
+		{"servers[name=prod].private_api_key", []string{"servers", "[1]", "private_api_key"}, "key-prod", true},
+		{"servers.[name=staging].id", []string{"servers", "[0]", "id"}, int64(1), true},
+		{"servers[id=3].name", []string{"servers", "[2]", "name"}, "db.internal", true},
+		{"servers[name=db.internal].id", []string{"servers", "[2]", "id"}, int64(3), true},
+		{`servers[name="prod"].id`, []string{"servers", "[1]", "id"}, int64(2), true},
+		{"servers[0].name", []string{"servers", "[0]", "name"}, "staging", true},
+		{"tables[name=users].rows", []string{"tables", "[0]", "rows"}, int64(10), true},
+		{"servers[name=dev].name", nil, nil, false},
+		{"servers[name=prod].missing", nil, nil, false},
+		{"servers[=prod].name", nil, nil, false},
+		{"tables.name[x=y]", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			data := newData()
+
+			resolved, ok := ResolveSelector(data, tt.selector)
+			if ok != tt.found {
+				t.Fatalf("Expected found=%v, got %v", tt.found, ok)
+			}
+			if ok && !reflect.DeepEqual(resolved, tt.resolved) {
+				t.Errorf("Expected path %v, got %v", tt.resolved, resolved)
+			}
+
+			value, ok := GetValueBySelector(data, tt.selector)
+			if ok != tt.found || !reflect.DeepEqual(value, tt.expected) {
+				t.Errorf("Expected (%v, %v), got (%v, %v)", tt.expected, tt.found, value, ok)
+			}
+		})
+	}
+
+	t.Run("set", func(t *testing.T) {
+		data := newData()
+
+		if !SetValueBySelector(data, "servers[name=prod].private_api_key", "rotated") {
+			t.Fatal("Failed to set existing value")
+		}
+		if !SetValueBySelector(data, "servers[name=prod].region", "us-east") {
+			t.Fatal("Failed to set new key")
+		}
+		prod := data["servers"].([]any)[1].(map[string]any)
+		if prod["private_api_key"] != "rotated" || prod["region"] != "us-east" {
+			t.Errorf("Unexpected prod server: %v", prod)
+		}
+
+		if SetValueBySelector(data, "servers[name=dev].region", "x") {
+			t.Error("Expected set through an unmatched selector to fail")
+		}
+	})
+}
+
+func TestSetValueDeep(t *testing.T) {
+	t.Run("should create intermediate maps", func(t *testing.T) {
+		testData := map[string]any{}
+
+		if !SetValueDeep(testData, []string{"database", "primary", "host"}, "localhost") {
+			t.Fatal("Failed to set deep value")
+		}
+
+		value, found := GetValue(testData, []string{"database", "primary", "host"})
+		if !found || value != "localhost" {
+			t.Errorf("Expected database.primary.host=localhost, got %v", value)
+		}
+	})
+
+	t.Run("should append to arrays", func(t *testing.T) {
+		testData := map[string]any{
+			"servers": []map[string]any{
+				{"name": "prod"},
+			},
+		}
+
+		if !SetValueDeep(testData, []string{"servers", "[-]", "name"}, "staging") {
+			t.Fatal("Failed to append to array of tables")
+		}
+		if !SetValueDeep(testData, []string{"tags", "[-]"}, "blue") {
+			t.Fatal("Failed to append to new array")
+		}
+		if !SetValueDeep(testData, []string{"tags", "[-]"}, "green") {
+			t.Fatal("Failed to append to existing array")
+		}
+
+		servers := testData["servers"].([]map[string]any)
+		if len(servers) != 2 || servers[1]["name"] != "staging" {
+			t.Errorf("Expected appended server staging, got %v", servers)
+		}
+
+		if !reflect.DeepEqual(testData["tags"], []any{"blue", "green"}) {
+			t.Errorf("Expected tags [blue green], got %v", testData["tags"])
+		}
+	})
+
+	t.Run("should set existing array elements", func(t *testing.T) {
+		testData := map[string]any{
+			"servers": []any{
+				map[string]any{"name": "prod"},
+			},
+		}
+
+		if !SetValueDeep(testData, []string{"servers", "[0]", "region", "name"}, "us-east") {
+			t.Fatal("Failed to set value inside existing element")
+		}
+
+		value, _ := GetValue(testData, []string{"servers", "[0]", "region", "name"})
+		if value != "us-east" {
+			t.Errorf("Expected us-east, got %v", value)
+		}
+	})
+
+	t.Run("should fail without modifying data", func(t *testing.T) {
+		testData := map[string]any{
+			"username": "alice",
+			"servers":  []any{},
+		}
+
+		cases := [][]string{
+			{"username", "first"},      // can't descend into a scalar
+			{"servers", "[3]", "name"}, // index out of range
+			{"[-]"},                    // can't append to the root
+			{"new", "username", "[0]"}, // index into a missing array
+		}
+		for _, path := range cases {
+			if SetValueDeep(testData, path, "x") {
+				t.Errorf("Expected SetValueDeep(%v) to fail", path)
+			}
+		}
+
+		if _, exists := testData["new"]; exists {
+			t.Error("Expected failed set not to create intermediate maps")
+		}
+	})
+
+	t.Run("nil root", func(t *testing.T) {
+		var cfg map[string]any
+		if SetValueDeep(cfg, []string{"database", "host"}, "localhost") {
+			t.Error("Expected a nil map root to fail")
+		}
+		if SetValueDeep(nil, []string{"database", "host"}, "localhost") {
+			t.Error("Expected a nil root to fail")
+		}
+	})
+
+	t.Run("nil intermediate map", func(t *testing.T) {
+		testData := map[string]any{"database": map[string]any(nil)}
+		if !SetValueDeep(testData, []string{"database", "host"}, "localhost") {
+			t.Fatal("Expected SetValueDeep to replace the nil table")
+		}
+		if host, _ := GetValue(testData, []string{"database", "host"}); host != "localhost" {
+			t.Errorf("Expected localhost, got %v", host)
+		}
+	})
+}
+
 func TestIsScalarValue(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -384,3 +666,198 @@ func TestFieldInfo(t *testing.T) {
 		t.Errorf("Expected full path %s, got %s", expectedPath2, actualPath2)
 	}
 }
+
+func TestWalkTyped(t *testing.T) {
+	testData := map[string]any{
+		"database": map[string]any{
+			"private_password": "secret123",
+		},
+		"servers": []map[string]any{
+			{"name": "prod"},
+			{"name": "staging"},
+		},
+	}
+
+	visited := make(map[string][]PathSegment)
+	WalkTyped(testData, func(path []PathSegment, value any) (any, bool) {
+		if _, ok := value.(string); ok {
+			visited[strings.Join(SegmentStrings(path), ".")] = path
+		}
+		return value, true
+	})
+
+	expected := map[string][]PathSegment{
+		"database.private_password": {{Key: "database", Index: -1}, {Key: "private_password", Index: -1}},
+		"servers.[0].name":          {{Key: "servers", Index: -1}, {Index: 0}, {Key: "name", Index: -1}},
+		"servers.[1].name":          {{Key: "servers", Index: -1}, {Index: 1}, {Key: "name", Index: -1}},
+	}
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, visited)
+	}
+
+	if !visited["servers.[1].name"][1].IsIndex() || visited["servers.[1].name"][0].IsIndex() {
+		t.Error("Expected only the array segment to report IsIndex")
+	}
+}
+
+func TestFindFieldsArrayIndex(t *testing.T) {
+	testData := map[string]any{
+		"tags": []any{"a", "b"},
+		"name": "alice",
+	}
+
+	fields := FindFields(testData, func(path []string, key string, value any) bool {
+		_, isString := value.(string)
+		return isString
+	})
+
+	for _, field := range fields {
+		switch field.Key {
+		case "[1]":
+			if !field.IsArrayElem || field.Index != 1 {
+				t.Errorf("Expected array element with index 1, got %+v", field)
+			}
+		case "name":
+			if field.IsArrayElem {
+				t.Errorf("Expected table key not to be an array element, got %+v", field)
+			}
+		}
+	}
+}
+
+func TestAllLeaves(t *testing.T) {
+	testData := map[string]any{
+		"name": "alice",
+		"database": map[string]any{
+			"host": "localhost",
+			"pool": map[string]any{
+				"options": map[string]any{"min": 1, "max": 10},
+			},
+		},
+		"ports": []any{80, 443},
+		"servers": []map[string]any{
+			{"name": "prod"},
+			{"name": "staging", "tags": []any{"blue"}},
+		},
+		"matrix": func() []any {
+			rows := make([]any, 11)
+			for i := range rows {
+				rows[i] = i
+			}
+			return rows
+		}(),
+		"empty_table": map[string]any{},
+		"empty_array": []any{},
+		"nothing":     nil,
+	}
+
+	expectedPaths := []string{
+		"database.host",
+		"database.pool.options.max",
+		"database.pool.options.min",
+		"matrix.[0]", "matrix.[1]", "matrix.[2]", "matrix.[3]", "matrix.[4]", "matrix.[5]",
+		"matrix.[6]", "matrix.[7]", "matrix.[8]", "matrix.[9]", "matrix.[10]",
+		"name",
+		"nothing",
+		"ports.[0]",
+		"ports.[1]",
+		"servers.[0].name",
+		"servers.[1].name",
+		"servers.[1].tags.[0]",
+	}
+
+	paths := AllPaths(testData)
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Expected paths %v, got %v", expectedPaths, paths)
+	}
+
+	leaves := AllLeaves(testData)
+	if len(leaves) != len(expectedPaths) {
+		t.Fatalf("Expected %d leaves, got %d", len(expectedPaths), len(leaves))
+	}
+	for _, leaf := range leaves {
+		value, found := GetValue(testData, leaf.Path)
+		if !found || !reflect.DeepEqual(value, leaf.Value) {
+			t.Errorf("Leaf %s: expected value %v at its path, got %v", leaf.GetFullPath(), leaf.Value, value)
+		}
+	}
+
+	if leaves := AllLeaves(map[string]any{}); len(leaves) != 0 {
+		t.Errorf("Expected no leaves for an empty table, got %v", leaves)
+	}
+}
+
+func TestWalkDoesNotMutateInput(t *testing.T) {
+	data := func() map[string]any {
+		return map[string]any{
+			"private_password": "secret",
+			"database":         map[string]any{"private_token": "abc", "port": 5432},
+			"servers": []map[string]any{
+				{"name": "prod", "private_key": "k1"},
+			},
+			"hosts": []any{"a", map[string]any{"private_x": "y"}},
+		}
+	}
+	input := data()
+
+	replaceAll := func(path []string, key string, value any) (any, bool) {
+		if IsScalarValue(value) {
+			return "replaced", true
+		}
+		return value, true
+	}
+
+	Walk(input, replaceAll)
+	if _, err := WalkWithLimit(input, 10, replaceAll); err != nil {
+		t.Fatalf("WalkWithLimit failed: %v", err)
+	}
+	WalkTyped(input, func(path []PathSegment, value any) (any, bool) {
+		return replaceAll(nil, "", value)
+	})
+
+	if !reflect.DeepEqual(input, data()) {
+		t.Errorf("Expected the input to be unchanged, got %v", input)
+	}
+}
+
+func TestWalkConcurrent(t *testing.T) {
+	data := map[string]any{
+		"private_password": "secret",
+		"database":         map[string]any{"private_token": "abc", "port": 5432},
+		"servers": []map[string]any{
+			{"name": "prod", "private_key": "k1"},
+			{"name": "staging", "private_key": "k2"},
+		},
+	}
+
+	// Run with -race: walks, lookups, and visitors collecting results must not
+	// race on shared input
+	const goroutines = 8
+	var wg sync.WaitGroup
+	results := make([][]string, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Walk(data, func(path []string, key string, value any) (any, bool) {
+				if strings.HasPrefix(key, "private_") {
+					results[i] = append(results[i], strings.Join(append(path, key), "."))
+					return "***", false
+				}
+				return value, true
+			})
+			GetValue(data, []string{"servers", "[1]", "name"})
+			AllPaths(data)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, paths := range results {
+		sort.Strings(paths)
+		want := "database.private_token,private_password,servers.[0].private_key,servers.[1].private_key"
+		if got := strings.Join(paths, ","); got != want {
+			t.Errorf("goroutine %d visited %s, want %s", i, got, want)
+		}
+	}
+}
@@ -4,21 +4,55 @@ package enc
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"filippo.io/age"
 	"filippo.io/age/armor"
 )
 
+var (
+	// ErrNoRecipients is returned by Encrypt when it is given no recipients
+	ErrNoRecipients = errors.New("no recipients provided")
+
+	// ErrNoIdentities is returned by Decrypt when it is given no identities
+	ErrNoIdentities = errors.New("no identities provided")
+)
+
+// DecryptError is returned by Decrypt when age fails to decrypt the data. Err
+// is the underlying age error. NoMatch is true when the data is intact but none
+// of the identities is a recipient of it; otherwise the armor or ciphertext is
+// malformed or corrupt.
+type DecryptError struct {
+	Err     error
+	NoMatch bool
+}
+
+func (e *DecryptError) Error() string {
+	return "failed to decrypt: " + e.Err.Error()
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// newDecryptError classifies an age decryption error
+func newDecryptError(err error) *DecryptError {
+	var noMatch *age.NoIdentityMatchError
+	return &DecryptError{Err: err, NoMatch: errors.As(err, &noMatch)}
+}
+
 // KeySources contains various sources for age identities and recipients
 type KeySources struct {
 	// IdentitiesFile is the path to a file containing age private keys
 	IdentitiesFile string
 
-	// IdentitiesData contains age private keys as strings
+	// IdentitiesData contains age private keys as strings, or whole identity
+	// files (comments and several keys included)
 	IdentitiesData []string
 
 	// RecipientsFile is the path to a file containing age public keys
@@ -29,6 +63,15 @@ type KeySources struct {
 
 	// PassphraseProvider returns a passphrase for age-scrypt decryption
 	PassphraseProvider func() (string, error)
+
+	// SSHPassphraseProvider returns the passphrase for a passphrase-protected SSH
+	// identity file. It is only called when a file has a stanza for that key.
+	SSHPassphraseProvider func() ([]byte, error)
+
+	// IdentityPassphraseProvider returns the passphrase for an identity file that
+	// is itself age-encrypted with a passphrase. It is only called for encrypted
+	// files; when nil, PassphraseProvider is used instead.
+	IdentityPassphraseProvider func() (string, error)
 }
 
 // LoadIdentities loads age identities from the key sources
@@ -37,16 +80,25 @@ func (ks KeySources) LoadIdentities() ([]age.Identity, error) {
 
 	// Load from file
 	if ks.IdentitiesFile != "" {
-		fileIdentities, err := loadIdentitiesFromFile(ks.IdentitiesFile)
+		fileIdentities, err := loadIdentitiesFromFile(ks.IdentitiesFile, ks.SSHPassphraseProvider, ks.identityFilePassphrase())
 		if err != nil {
 			return nil, fmt.Errorf("failed to load identities from file %s: %w", ks.IdentitiesFile, err)
 		}
 		identities = append(identities, fileIdentities...)
 	}
 
-	// Load from data
+	// Load from data; an encrypted identity file's content is decrypted first,
+	// and multi-line data is read as an identity file
 	for _, identityStr := range ks.IdentitiesData {
-		identity, err := age.ParseX25519Identity(identityStr)
+		if IsEncryptedIdentityFile([]byte(identityStr)) || strings.Contains(strings.TrimSpace(identityStr), "\n") {
+			dataIdentities, err := parseIdentityFile([]byte(identityStr), ks.SSHPassphraseProvider, ks.identityFilePassphrase())
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse identity: %w", err)
+			}
+			identities = append(identities, dataIdentities...)
+			continue
+		}
+		identity, err := parseIdentity(identityStr, ks.SSHPassphraseProvider)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse identity: %w", err)
 		}
@@ -69,6 +121,14 @@ func (ks KeySources) LoadIdentities() ([]age.Identity, error) {
 	return identities, nil
 }
 
+// identityFilePassphrase returns the provider for encrypted identity files
+func (ks KeySources) identityFilePassphrase() func() (string, error) {
+	if ks.IdentityPassphraseProvider != nil {
+		return ks.IdentityPassphraseProvider
+	}
+	return ks.PassphraseProvider
+}
+
 // LoadRecipients loads age recipients from the key sources
 func (ks KeySources) LoadRecipients() ([]age.Recipient, error) {
 	var recipients []age.Recipient
@@ -83,10 +143,14 @@ func (ks KeySources) LoadRecipients() ([]age.Recipient, error) {
 	}
 
 	// Load from explicit recipients
-	for _, recipientStr := range ks.Recipients {
-		recipient, err := age.ParseX25519Recipient(recipientStr)
+	for i, recipientStr := range ks.Recipients {
+		recipient, err := ParseRecipient(recipientStr)
+		if errors.Is(err, ErrIdentityAsRecipient) {
+			// Don't echo a private key into error output
+			return nil, fmt.Errorf("failed to parse recipient %d: %w", i+1, err)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse recipient: %w", err)
+			return nil, fmt.Errorf("failed to parse recipient %d (%q): %w", i+1, recipientStr, err)
 		}
 		recipients = append(recipients, recipient)
 	}
@@ -104,13 +168,64 @@ func (ks KeySources) LoadRecipients() ([]age.Recipient, error) {
 		recipients = append(recipients, scryptRecipient)
 	}
 
-	return recipients, nil
+	return DedupeRecipients(recipients), nil
+}
+
+// DedupeRecipients removes recipients that appear more than once, comparing by
+// their canonical string form and keeping the first occurrence. Recipients
+// without a string form (e.g., passphrase recipients) are always kept.
+func DedupeRecipients(recipients []age.Recipient) []age.Recipient {
+	seen := make(map[string]bool)
+	var result []age.Recipient
+	for _, recipient := range recipients {
+		if stringer, ok := recipient.(fmt.Stringer); ok {
+			key := stringer.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		result = append(result, recipient)
+	}
+	return result
+}
+
+// SortRecipients returns recipients in a canonical order, so the stanza order
+// of what they encrypt doesn't depend on the order they were listed in:
+// recipients with a string form (X25519 keys) sorted by it, then the rest by
+// ShortID. Plugin recipients with the same name keep their relative order.
+func SortRecipients(recipients []age.Recipient) []age.Recipient {
+	type keyed struct {
+		recipient age.Recipient
+		stringer  bool
+		key       string
+	}
+	entries := make([]keyed, len(recipients))
+	for i, r := range recipients {
+		entries[i].recipient = r
+		if s, ok := r.(fmt.Stringer); ok {
+			entries[i].stringer, entries[i].key = true, s.String()
+		} else {
+			entries[i].key = ShortID(r)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].stringer != entries[j].stringer {
+			return entries[i].stringer
+		}
+		return entries[i].key < entries[j].key
+	})
+	sorted := make([]age.Recipient, len(entries))
+	for i, e := range entries {
+		sorted[i] = e.recipient
+	}
+	return sorted
 }
 
 // Encrypt encrypts data with the given recipients and returns ASCII-armored ciphertext
 func Encrypt(data []byte, recipients []age.Recipient) (string, error) {
 	if len(recipients) == 0 {
-		return "", fmt.Errorf("no recipients provided")
+		return "", ErrNoRecipients
 	}
 
 	var buf bytes.Buffer
@@ -136,19 +251,24 @@ func Encrypt(data []byte, recipients []age.Recipient) (string, error) {
 	return buf.String(), nil
 }
 
-// Decrypt decrypts ASCII-armored ciphertext using the given identities
+// Decrypt decrypts ASCII-armored ciphertext using the given identities.
+// Failures are reported as ErrNoIdentities or a *DecryptError.
 func Decrypt(armoredData string, identities []age.Identity) ([]byte, error) {
 	if len(identities) == 0 {
-		return nil, fmt.Errorf("no identities provided")
+		return nil, ErrNoIdentities
 	}
 
-	armorReader := armor.NewReader(strings.NewReader(armoredData))
+	armorReader := newArmorReader(armoredData)
 	ageReader, err := age.Decrypt(armorReader, identities...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
+		return nil, newDecryptError(err)
 	}
 
-	return io.ReadAll(ageReader)
+	plaintext, err := io.ReadAll(ageReader)
+	if err != nil {
+		return nil, newDecryptError(err)
+	}
+	return plaintext, nil
 }
 
 // GetRecipientStrings extracts string representations of recipients for metadata
@@ -177,18 +297,141 @@ func HasPassphraseRecipient(recipients []age.Recipient) bool {
 	return false
 }
 
-// loadIdentitiesFromFile reads age identities from a file
-func loadIdentitiesFromFile(filename string) ([]age.Identity, error) {
-	file, err := os.Open(filename)
+// CountX25519Recipients returns the number of distinct X25519 recipients.
+// Passphrase and other recipient types are not counted.
+func CountX25519Recipients(recipients []age.Recipient) int {
+	seen := make(map[string]bool)
+	for _, recipient := range recipients {
+		if x25519, ok := recipient.(*age.X25519Recipient); ok {
+			seen[x25519.String()] = true
+		}
+	}
+	return len(seen)
+}
+
+// RecipientsFromIdentities derives the public recipients for the given identities.
+// Only X25519 identities have a derivable recipient; other identity types are skipped.
+func RecipientsFromIdentities(identities []age.Identity) []age.Recipient {
+	var recipients []age.Recipient
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient())
+		}
+	}
+	return recipients
+}
+
+// loadIdentitiesFromFile reads age identities from a file (one per line), which
+// may also be an ssh-ed25519 or ssh-rsa private key, or either of those
+// encrypted with an age passphrase
+func loadIdentitiesFromFile(filename string, sshPassphrase func() ([]byte, error), filePassphrase func() (string, error)) ([]age.Identity, error) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return parseIdentityFile(data, sshPassphrase, filePassphrase)
+}
+
+// IsEncryptedIdentityFile reports whether data is an age-encrypted file, binary
+// or armored, as produced by "age -p" to protect a key file at rest
+func IsEncryptedIdentityFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(SupportedVersion+"\n")) ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// IsIdentityFile reports whether data looks like the content of an identity
+// file: age-encrypted, an SSH private key, or with an age secret key or plugin
+// identity line. It doesn't check that the keys parse.
+func IsIdentityFile(data []byte) bool {
+	if IsEncryptedIdentityFile(data) || isSSHPrivateKey(data) {
+		return true
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && looksLikeIdentity(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptIdentityFile decrypts a passphrase-encrypted identity file in memory
+func decryptIdentityFile(data []byte, filePassphrase func() (string, error)) ([]byte, error) {
+	if filePassphrase == nil {
+		return nil, fmt.Errorf("identity file is encrypted and no passphrase was provided")
+	}
+	passphrase, err := filePassphrase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity file passphrase: %w", err)
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scrypt identity: %w", err)
+	}
 
-	return age.ParseIdentities(file)
+	var src io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(SupportedVersion+"\n")) {
+		src = newArmorReader(string(data))
+	}
+	r, err := age.Decrypt(src, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identity file: %w", err)
+	}
+	return io.ReadAll(r)
 }
 
-// loadRecipientsFromFile reads age recipients from a file (one per line)
+// parseIdentityFile parses the content of an identity file
+func parseIdentityFile(data []byte, sshPassphrase func() ([]byte, error), filePassphrase func() (string, error)) ([]age.Identity, error) {
+	if IsEncryptedIdentityFile(data) {
+		decrypted, err := decryptIdentityFile(data, filePassphrase)
+		if err != nil {
+			return nil, err
+		}
+		data = decrypted
+	}
+
+	if isSSHPrivateKey(data) {
+		identity, err := parseSSHIdentity(data, sshPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	var identities []age.Identity
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		identity, err := ParseIdentity(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse identity: %w", lineNum, err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no identities found")
+	}
+
+	return identities, nil
+}
+
+// loadRecipientsFromFile reads age recipients from a file (one per line);
+// its comment labels are read by ParseRecipientLabels
 func loadRecipientsFromFile(filename string) ([]age.Recipient, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -198,8 +441,10 @@ func loadRecipientsFromFile(filename string) ([]age.Recipient, error) {
 
 	var recipients []age.Recipient
 	scanner := bufio.NewScanner(file)
+	lineNum := 0
 
 	for scanner.Scan() {
+		lineNum++
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
@@ -207,9 +452,12 @@ func loadRecipientsFromFile(filename string) ([]age.Recipient, error) {
 			continue
 		}
 
-		recipient, err := age.ParseX25519Recipient(line)
+		recipient, err := ParseRecipient(line)
+		if errors.Is(err, ErrIdentityAsRecipient) {
+			return nil, fmt.Errorf("line %d: failed to parse recipient: %w", lineNum, err)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse recipient %s: %w", line, err)
+			return nil, fmt.Errorf("line %d: failed to parse recipient %s: %w", lineNum, line, err)
 		}
 
 		recipients = append(recipients, recipient)
@@ -221,3 +469,33 @@ func loadRecipientsFromFile(filename string) ([]age.Recipient, error) {
 
 	return recipients, nil
 }
+
+// ParseRecipientLabels returns the labels a recipients file gives its keys,
+// keyed by the recipient as written: the text of a comment on the line
+// directly above it, as in
+//
+//	# alice@example.com
+//	age1...
+//
+// A blank line in between breaks the association, and recipients without such
+// a comment have no entry. Lines that aren't recipients are not checked.
+func ParseRecipientLabels(data []byte) map[string]string {
+	labels := make(map[string]string)
+	label := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			label = ""
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			label = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
+		if label != "" {
+			labels[line] = label
+		}
+		label = ""
+	}
+	return labels
+}
@@ -0,0 +1,78 @@
+package enc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+// Outcomes of a single decryption attempt
+const (
+	AttemptDecrypted = "decrypted"
+	AttemptNoMatch   = "no match"
+	AttemptFailed    = "failed"
+)
+
+// DecryptAttempt records what happened when one identity was tried against an armored block
+type DecryptAttempt struct {
+	// Identity is a public description of the identity (never secret key material)
+	Identity string
+
+	// Outcome is AttemptDecrypted, AttemptNoMatch, or AttemptFailed
+	Outcome string
+
+	// Err is the age error for unsuccessful attempts
+	Err error
+}
+
+// ExplainDecrypt tries each identity on its own against armoredData and reports
+// the outcome of every attempt. A block that an identity matches but cannot
+// open (e.g., a corrupt payload) is reported as AttemptFailed rather than
+// AttemptNoMatch. The plaintext is read to verify it and then discarded.
+func ExplainDecrypt(armoredData string, identities []age.Identity) []DecryptAttempt {
+	attempts := make([]DecryptAttempt, 0, len(identities))
+	for _, identity := range identities {
+		attempt := DecryptAttempt{Identity: DescribeIdentity(identity)}
+
+		err := tryDecrypt(armoredData, identity)
+		var noMatch *age.NoIdentityMatchError
+		switch {
+		case err == nil:
+			attempt.Outcome = AttemptDecrypted
+		case errors.As(err, &noMatch):
+			attempt.Outcome = AttemptNoMatch
+			attempt.Err = err
+		default:
+			attempt.Outcome = AttemptFailed
+			attempt.Err = err
+		}
+
+		attempts = append(attempts, attempt)
+	}
+	return attempts
+}
+
+// DescribeIdentity returns a printable, non-secret description of an identity:
+// the public key for X25519 and SSH identities, "passphrase" for scrypt
+// identities, and the Go type otherwise
+func DescribeIdentity(identity age.Identity) string {
+	if publicKey, ok := PublicKeyString(identity); ok {
+		return publicKey
+	}
+	if _, ok := identity.(*age.ScryptIdentity); ok {
+		return "passphrase"
+	}
+	return fmt.Sprintf("%T", identity)
+}
+
+// tryDecrypt decrypts armoredData with a single identity and discards the plaintext
+func tryDecrypt(armoredData string, identity age.Identity) error {
+	ageReader, err := age.Decrypt(newArmorReader(armoredData), identity)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, ageReader)
+	return err
+}
@@ -0,0 +1,78 @@
+package enc
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func TestExplainDecrypt(t *testing.T) {
+	recipient, err := age.ParseX25519Recipient(testkeys.TestRecipient1)
+	if err != nil {
+		t.Fatalf("Failed to parse recipient: %v", err)
+	}
+
+	encrypted, err := Encrypt([]byte("secret"), []age.Recipient{recipient})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	identities, err := KeySources{
+		IdentitiesData: []string{testkeys.TestIdentity2, testkeys.TestIdentity1},
+	}.LoadIdentities()
+	if err != nil {
+		t.Fatalf("Failed to load identities: %v", err)
+	}
+
+	t.Run("mixed identities", func(t *testing.T) {
+		attempts := ExplainDecrypt(encrypted, identities)
+		if len(attempts) != 2 {
+			t.Fatalf("Expected 2 attempts, got %d", len(attempts))
+		}
+
+		if attempts[0].Identity != testkeys.TestRecipient2 || attempts[0].Outcome != AttemptNoMatch {
+			t.Errorf("Expected no match for identity 2, got %+v", attempts[0])
+		}
+		if attempts[1].Identity != testkeys.TestRecipient1 || attempts[1].Outcome != AttemptDecrypted {
+			t.Errorf("Expected identity 1 to decrypt, got %+v", attempts[1])
+		}
+		if attempts[1].Err != nil {
+			t.Errorf("Expected no error for successful attempt, got %v", attempts[1].Err)
+		}
+	})
+
+	t.Run("corrupt payload", func(t *testing.T) {
+		// Flip a payload byte so the header still matches but the MAC check fails
+		raw := readArmored(t, encrypted)
+		raw[len(raw)-1] ^= 0xff
+
+		attempts := ExplainDecrypt(armorRaw(t, string(raw)), identities[1:])
+		if attempts[0].Outcome != AttemptFailed {
+			t.Errorf("Expected failed attempt for corrupt payload, got %+v", attempts[0])
+		}
+	})
+
+	t.Run("no secret material in description", func(t *testing.T) {
+		for _, attempt := range ExplainDecrypt(encrypted, identities) {
+			if strings.Contains(attempt.Identity, "AGE-SECRET-KEY") {
+				t.Errorf("Identity description leaks secret key: %s", attempt.Identity)
+			}
+		}
+	})
+}
+
+// readArmored decodes an armored block to its raw bytes
+func readArmored(t *testing.T, armored string) []byte {
+	t.Helper()
+
+	raw, err := io.ReadAll(armor.NewReader(strings.NewReader(armored)))
+	if err != nil {
+		t.Fatalf("Failed to read armor: %v", err)
+	}
+	return raw
+}
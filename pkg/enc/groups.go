@@ -0,0 +1,94 @@
+package enc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// LoadRecipientGroups reads a recipient alias file and returns the parsed
+// recipients of each group (see ParseRecipientGroups for the format)
+func LoadRecipientGroups(file string) (map[string][]age.Recipient, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recipient groups file %s: %w", file, err)
+	}
+
+	groups, err := ParseRecipientGroups(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient groups file %s: %w", file, err)
+	}
+
+	result := make(map[string][]age.Recipient, len(groups))
+	for name, keys := range groups {
+		for _, key := range keys {
+			recipient, err := ParseRecipient(key)
+			if err != nil {
+				return nil, fmt.Errorf("group %s: %w", name, err)
+			}
+			result[name] = append(result[name], recipient)
+		}
+	}
+	return result, nil
+}
+
+// ParseRecipientGroups parses a recipient alias file, mapping each group name
+// to its public keys. Each line names a group and lists its keys, separated by
+// commas; blank lines and lines starting with # are ignored:
+//
+//	team-backend = age1..., age1...
+//	ops = ssh-ed25519 AAAA...
+//
+// Every key is validated, and a group may only be defined once.
+func ParseRecipientGroups(data []byte) (map[string][]string, error) {
+	groups := make(map[string][]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, list, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: expected \"group = key, key\"", lineNum)
+		}
+		if _, exists := groups[name]; exists {
+			return nil, fmt.Errorf("line %d: group %s is already defined", lineNum, name)
+		}
+
+		var keys []string
+		for _, key := range strings.Split(list, ",") {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			if _, err := ParseRecipient(key); err != nil {
+				return nil, fmt.Errorf("line %d: group %s: %w", lineNum, name, err)
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("line %d: group %s has no recipients", lineNum, name)
+		}
+		groups[name] = keys
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no recipient groups found")
+	}
+
+	return groups, nil
+}
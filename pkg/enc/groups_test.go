@@ -0,0 +1,73 @@
+package enc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func TestParseRecipientGroups(t *testing.T) {
+	data := []byte(`
+# Teams
+team-backend = ` + testkeys.TestRecipient1 + `, ` + testkeys.TestRecipient2 + `
+ops=` + testkeys.TestRecipient2 + `,
+`)
+
+	groups, err := ParseRecipientGroups(data)
+	if err != nil {
+		t.Fatalf("Failed to parse groups: %v", err)
+	}
+
+	expected := map[string][]string{
+		"team-backend": {testkeys.TestRecipient1, testkeys.TestRecipient2},
+		"ops":          {testkeys.TestRecipient2},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %v, got %v", expected, groups)
+	}
+
+	invalid := map[string]string{
+		"missing equals": testkeys.TestRecipient1,
+		"empty name":     " = " + testkeys.TestRecipient1,
+		"spaced name":    "team backend = " + testkeys.TestRecipient1,
+		"no recipients":  "ops = ,",
+		"bad key":        "ops = age1invalid",
+		"duplicate":      "ops = " + testkeys.TestRecipient1 + "\nops = " + testkeys.TestRecipient2,
+		"empty file":     "# nothing here\n",
+	}
+	for name, input := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseRecipientGroups([]byte(input)); err == nil {
+				t.Errorf("Expected error for %q", input)
+			}
+		})
+	}
+}
+
+func TestLoadRecipientGroups(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "groups")
+	data := "backend = " + testkeys.TestRecipient1 + ", " + testkeys.TestRecipient2 + "\n"
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write groups file: %v", err)
+	}
+
+	groups, err := LoadRecipientGroups(file)
+	if err != nil {
+		t.Fatalf("Failed to load groups: %v", err)
+	}
+
+	got := GetRecipientStrings(groups["backend"])
+	expected := []string{testkeys.TestRecipient1, testkeys.TestRecipient2}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	_, err = LoadRecipientGroups(filepath.Join(t.TempDir(), "missing"))
+	if err == nil || !strings.Contains(err.Error(), "cannot read recipient groups file") {
+		t.Errorf("Expected read error for missing file, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package enc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+)
+
+// SupportedVersion is the age format version line this build can decrypt
+const SupportedVersion = "age-encryption.org/v1"
+
+// ErrUnsupportedVersion is returned by Header.CheckVersion for a header with a
+// format version other than SupportedVersion
+var ErrUnsupportedVersion = errors.New("unsupported age format version")
+
+// Header describes the unencrypted header of an armored age file
+type Header struct {
+	// Version is the format version line (e.g., "age-encryption.org/v1")
+	Version string
+
+	// Stanzas are the recipient stanzas, one per recipient the file was encrypted to
+	Stanzas []Stanza
+}
+
+// Stanza is a single recipient stanza from an age header
+type Stanza struct {
+	// Type is the stanza type (e.g., "X25519", "scrypt", "ssh-ed25519")
+	Type string
+
+	// Args are the remaining stanza arguments
+	Args []string
+}
+
+// ParseHeader decodes an armored age file and parses its header without decrypting it
+func ParseHeader(armoredData string) (*Header, error) {
+	reader := bufio.NewReader(newArmorReader(armoredData))
+
+	version, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header version: %w", err)
+	}
+
+	header := &Header{Version: strings.TrimSuffix(version, "\n")}
+	if !strings.HasPrefix(header.Version, "age-encryption.org/") {
+		return nil, fmt.Errorf("unexpected header version line: %q", header.Version)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "---"):
+			return header, nil
+		case strings.HasPrefix(line, "-> "):
+			fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("malformed stanza line: %q", line)
+			}
+			header.Stanzas = append(header.Stanzas, Stanza{Type: fields[0], Args: fields[1:]})
+		default:
+			// Stanza body line
+			if len(header.Stanzas) == 0 {
+				return nil, fmt.Errorf("unexpected header line before first stanza: %q", line)
+			}
+		}
+	}
+}
+
+// minPayloadSize is the smallest possible age payload: a 16-byte nonce and
+// one chunk holding at least its 16-byte authentication tag
+const minPayloadSize = 16 + 16
+
+// ValidateArmor checks, without decrypting, that armoredData is a complete
+// armored age file: both markers, valid base64, a parseable header, and a
+// payload long enough to hold a nonce and one chunk. It catches truncated
+// pastes, but not corruption inside the payload; only decryption finds that.
+func ValidateArmor(armoredData string) error {
+	if _, err := ParseHeader(armoredData); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(newArmorReader(armoredData))
+	if err != nil {
+		return fmt.Errorf("invalid armor: %w", err)
+	}
+
+	// The header ends with the "--- <mac>" line
+	macLine := bytes.Index(data, []byte("\n--- "))
+	if macLine < 0 {
+		return fmt.Errorf("header has no MAC line")
+	}
+	end := bytes.IndexByte(data[macLine+1:], '\n')
+	if end < 0 {
+		return fmt.Errorf("payload is missing")
+	}
+	payload := data[macLine+1+end+1:]
+	if len(payload) < minPayloadSize {
+		return fmt.Errorf("payload is truncated (%d bytes)", len(payload))
+	}
+
+	return nil
+}
+
+// CheckVersion returns an error wrapping ErrUnsupportedVersion unless the
+// header has SupportedVersion. A newer version (e.g. "age-encryption.org/v2")
+// means the file was written by a newer age, and the error says to upgrade.
+func (h *Header) CheckVersion() error {
+	if h.Version == SupportedVersion {
+		return nil
+	}
+	version, ok := versionNumber(h.Version)
+	supported, _ := versionNumber(SupportedVersion)
+	if ok && version > supported {
+		return fmt.Errorf("%w: %s is newer than the %s this viola supports; upgrade viola to decrypt it", ErrUnsupportedVersion, h.Version, SupportedVersion)
+	}
+	return fmt.Errorf("%w: %q (this viola supports %s)", ErrUnsupportedVersion, h.Version, SupportedVersion)
+}
+
+// versionNumber returns N from an "age-encryption.org/vN" version line
+func versionNumber(version string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "age-encryption.org/v"))
+	if err != nil || !strings.HasPrefix(version, "age-encryption.org/v") {
+		return 0, false
+	}
+	return n, true
+}
+
+// StanzaTypes returns the type of each stanza in the header
+func (h *Header) StanzaTypes() []string {
+	types := make([]string, len(h.Stanzas))
+	for i, stanza := range h.Stanzas {
+		types[i] = stanza.Type
+	}
+	return types
+}
+
+// RecipientTag describes who a stanza is for, as precisely as the header
+// allows: SSH stanzas carry a tag derived from the recipient's public key
+// ("ssh-ed25519 <tag>"), scrypt stanzas are "passphrase", and X25519 stanzas
+// are anonymous, so every one of them is just "X25519"
+func (s Stanza) RecipientTag() string {
+	switch {
+	case s.Type == "scrypt":
+		return "passphrase"
+	case strings.HasPrefix(s.Type, "ssh-") && len(s.Args) > 0:
+		return s.Type + " " + s.Args[0]
+	}
+	return s.Type
+}
+
+// RecipientTags returns the RecipientTag of each stanza in sorted order, so
+// two files encrypted to the same audience have equal tag lists
+func (h *Header) RecipientTags() []string {
+	tags := make([]string, len(h.Stanzas))
+	for i, stanza := range h.Stanzas {
+		tags[i] = stanza.RecipientTag()
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// AudienceTags returns the RecipientTags of a file encrypted to recipients,
+// to compare with the header of existing ciphertext: equal tags mean the same
+// SSH keys, the same number of X25519 keys, and the same use of a passphrase.
+// It encrypts an empty probe to read them, except for a passphrase, which is
+// always the only recipient and is tagged without running scrypt.
+func AudienceTags(recipients []age.Recipient) ([]string, error) {
+	if HasPassphraseRecipient(recipients) {
+		return []string{"passphrase"}, nil
+	}
+	probe, err := Encrypt(nil, recipients)
+	if err != nil {
+		return nil, err
+	}
+	header, err := ParseHeader(probe)
+	if err != nil {
+		return nil, err
+	}
+	return header.RecipientTags(), nil
+}
+
+// SSHRecipientTag returns the RecipientTag of the stanzas age writes for an
+// SSH public key (an authorized_keys line), e.g. "ssh-ed25519 dGFnIQ", so a
+// header can be checked for that recipient without decrypting. The tag is
+// short, so a match is near-certain rather than proof.
+func SSHRecipientTag(publicKey string) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH public key: %w", err)
+	}
+	if key.Type() != ssh.KeyAlgoED25519 && key.Type() != ssh.KeyAlgoRSA {
+		return "", fmt.Errorf("unsupported SSH key type %s (expected ssh-ed25519 or ssh-rsa)", key.Type())
+	}
+
+	// age tags a stanza with the first 4 bytes of the key's SHA-256
+	sum := sha256.Sum256(key.Marshal())
+	return key.Type() + " " + base64.RawStdEncoding.EncodeToString(sum[:4]), nil
+}
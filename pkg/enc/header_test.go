@@ -0,0 +1,223 @@
+package enc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+// armorRaw armors raw bytes, for crafting headers the age library won't produce
+func armorRaw(t *testing.T, raw string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := armor.NewWriter(&buf)
+	if _, err := w.Write([]byte(raw)); err != nil {
+		t.Fatalf("Failed to write armor: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close armor: %v", err)
+	}
+	return buf.String()
+}
+
+func TestParseHeader(t *testing.T) {
+	t.Run("X25519 recipients", func(t *testing.T) {
+		recipients, err := testkeys.GetTestRecipients()
+		if err != nil {
+			t.Fatalf("Failed to get test recipients: %v", err)
+		}
+
+		encrypted, err := Encrypt([]byte("secret"), recipients)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+
+		header, err := ParseHeader(encrypted)
+		if err != nil {
+			t.Fatalf("Failed to parse header: %v", err)
+		}
+
+		if header.Version != SupportedVersion {
+			t.Errorf("Expected version %s, got %s", SupportedVersion, header.Version)
+		}
+
+		expected := []string{"X25519", "X25519", "X25519"}
+		if !reflect.DeepEqual(header.StanzaTypes(), expected) {
+			t.Errorf("Expected stanza types %v, got %v", expected, header.StanzaTypes())
+		}
+	})
+
+	t.Run("passphrase recipient", func(t *testing.T) {
+		ks := KeySources{
+			PassphraseProvider: func() (string, error) {
+				return testkeys.TestPassphrase, nil
+			},
+		}
+
+		recipients, err := ks.LoadRecipients()
+		if err != nil {
+			t.Fatalf("Failed to load recipients: %v", err)
+		}
+
+		encrypted, err := Encrypt([]byte("secret"), recipients)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+
+		header, err := ParseHeader(encrypted)
+		if err != nil {
+			t.Fatalf("Failed to parse header: %v", err)
+		}
+
+		if !reflect.DeepEqual(header.StanzaTypes(), []string{"scrypt"}) {
+			t.Errorf("Expected a single scrypt stanza, got %v", header.StanzaTypes())
+		}
+	})
+
+	t.Run("future version", func(t *testing.T) {
+		raw := "age-encryption.org/v2\n-> X25519 c2hhcmU\nYm9keQ\n--- bWFj\npayload"
+
+		header, err := ParseHeader(armorRaw(t, raw))
+		if err != nil {
+			t.Fatalf("Failed to parse header: %v", err)
+		}
+
+		if header.Version != "age-encryption.org/v2" {
+			t.Errorf("Expected v2 version line, got %s", header.Version)
+		}
+
+		if len(header.Stanzas) != 1 || header.Stanzas[0].Args[0] != "c2hhcmU" {
+			t.Errorf("Unexpected stanzas: %+v", header.Stanzas)
+		}
+	})
+
+	t.Run("not an age file", func(t *testing.T) {
+		if _, err := ParseHeader(armorRaw(t, "hello world\n")); err == nil {
+			t.Error("Expected error for non-age payload")
+		}
+	})
+}
+
+func TestValidateArmor(t *testing.T) {
+	recipients, err := testkeys.GetTestRecipients()
+	if err != nil {
+		t.Fatalf("Failed to get test recipients: %v", err)
+	}
+	encrypted, err := Encrypt([]byte("secret"), recipients[:1])
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	if err := ValidateArmor(encrypted); err != nil {
+		t.Errorf("Expected a complete block to validate, got: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(encrypted, "\n"), "\n")
+	footer := lines[len(lines)-1]
+
+	tests := map[string]string{
+		"missing footer":    strings.Join(lines[:len(lines)-1], "\n"),
+		"missing header":    strings.Join(lines[1:], "\n"),
+		"last line dropped": strings.Join(append(lines[:len(lines)-2:len(lines)-2], footer), "\n"),
+		"only the header":   strings.Join([]string{lines[0], lines[1], footer}, "\n"),
+		"empty":             "",
+	}
+	for name, armored := range tests {
+		if err := ValidateArmor(armored); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRecipientTags(t *testing.T) {
+	raw := "age-encryption.org/v1\n" +
+		"-> X25519 c2hhcmU\nYm9keQ\n" +
+		"-> ssh-ed25519 dGFn c2hhcmU\nYm9keQ\n" +
+		"-> scrypt c2FsdA 18\nYm9keQ\n" +
+		"-> X25519 b3RoZXI\nYm9keQ\n" +
+		"--- bWFj\npayload"
+
+	header, err := ParseHeader(armorRaw(t, raw))
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	expected := []string{"X25519", "X25519", "passphrase", "ssh-ed25519 dGFn"}
+	if !reflect.DeepEqual(header.RecipientTags(), expected) {
+		t.Errorf("Expected recipient tags %v, got %v", expected, header.RecipientTags())
+	}
+}
+
+func TestHeaderCheckVersion(t *testing.T) {
+	recipients, err := testkeys.GetTestRecipients()
+	if err != nil {
+		t.Fatalf("Failed to get test recipients: %v", err)
+	}
+	encrypted, err := Encrypt([]byte("secret"), recipients[:1])
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	header, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	if err := header.CheckVersion(); err != nil {
+		t.Errorf("Expected the current version to be supported, got %v", err)
+	}
+
+	tests := map[string]string{
+		"age-encryption.org/v2":   "upgrade viola",
+		"age-encryption.org/v0":   "this viola supports",
+		"age-encryption.org/beta": "this viola supports",
+	}
+	for version, want := range tests {
+		header, err := ParseHeader(armorRaw(t, version+"\n-> X25519 abc\nYm9keQ\n--- bWFj\npayload"))
+		if err != nil {
+			t.Fatalf("%s: failed to parse header: %v", version, err)
+		}
+		err = header.CheckVersion()
+		if !errors.Is(err, ErrUnsupportedVersion) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected ErrUnsupportedVersion mentioning %q, got %v", version, want, err)
+		}
+	}
+}
+
+func TestSSHRecipientTag(t *testing.T) {
+	_, publicKey := writeSSHKey(t, "")
+	recipient, err := ParseRecipient(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to parse SSH recipient: %v", err)
+	}
+	encrypted, err := Encrypt([]byte("secret"), []age.Recipient{recipient})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	header, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	tag, err := SSHRecipientTag(publicKey)
+	if err != nil {
+		t.Fatalf("SSHRecipientTag failed: %v", err)
+	}
+	if tags := header.RecipientTags(); len(tags) != 1 || tags[0] != tag {
+		t.Errorf("Expected the stanza tag %q, got %v", tag, tags)
+	}
+
+	_, otherKey := writeSSHKey(t, "")
+	if other, err := SSHRecipientTag(otherKey); err != nil || other == tag {
+		t.Errorf("Expected a different tag for another key, got %q, %v", other, err)
+	}
+	if _, err := SSHRecipientTag(testkeys.TestRecipient1); err == nil {
+		t.Error("Expected an age key to be rejected")
+	}
+}
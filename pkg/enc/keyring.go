@@ -0,0 +1,349 @@
+package enc
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+// defaultKeyringTimeout bounds how long a keyring fetch may take
+const defaultKeyringTimeout = 10 * time.Second
+
+// maxKeyringSize caps the keyring response body to avoid unbounded reads
+const maxKeyringSize = 1 << 20
+
+// KeyringEntry is a labeled recipient from a JSON keyring
+type KeyringEntry struct {
+	// Name is a human-readable label for the key owner (e.g., "alice")
+	Name string `json:"name"`
+
+	// Key is the age public key
+	Key string `json:"key"`
+
+	// Recipient is the parsed form of Key
+	Recipient age.Recipient `json:"-"`
+}
+
+// KeyringOptions configures how a keyring is fetched
+type KeyringOptions struct {
+	// Timeout bounds the whole request (default: 10s)
+	Timeout time.Duration
+
+	// PinSHA256 is an optional hex SHA-256 of the server's leaf certificate.
+	// When set, the connection is rejected unless the certificate matches.
+	PinSHA256 string
+
+	// RootCAs overrides the system certificate pool (mainly for tests)
+	RootCAs *x509.CertPool
+
+	// AllowHTTP permits plain http:// URLs, and redirects to them. Anyone on
+	// the network path can then substitute their own keys, so only use it on
+	// trusted networks.
+	AllowHTTP bool
+
+	// CacheDir, if set, keeps a copy of every successfully fetched and
+	// validated document there, and falls back to that copy when a later
+	// fetch fails because the server can't be reached. A failed certificate
+	// or pin check, a bad status, or an invalid document is an error even
+	// with a cached copy. Copies are kept per URL and PinSHA256. Anyone who
+	// can write to it can substitute keys while offline, so it should be
+	// private to the user.
+	CacheDir string
+
+	// CacheTTL is how long a cached copy is used without fetching at all.
+	// Zero always fetches, using the cache only as a fallback.
+	CacheTTL time.Duration
+
+	// OnStaleCache, if set, is called when the server couldn't be reached
+	// and an older cached copy was used instead; age is the time since it was fetched
+	OnStaleCache func(url string, age time.Duration, fetchErr error)
+}
+
+// keyringCache holds validated keyrings by URL for the lifetime of the process
+var keyringCache sync.Map
+
+// FetchKeyring downloads a JSON keyring of the form [{"name":"alice","key":"age1..."}]
+// over HTTPS and returns its validated entries. Results are cached per URL and pin.
+func FetchKeyring(url string, opts KeyringOptions) ([]KeyringEntry, error) {
+	if err := checkKeysURL("keyring", url, opts); err != nil {
+		return nil, err
+	}
+
+	cacheKey := url + "#" + strings.ToLower(opts.PinSHA256)
+	if cached, ok := keyringCache.Load(cacheKey); ok {
+		return cached.([]KeyringEntry), nil
+	}
+
+	var entries []KeyringEntry
+	err := loadKeys("keyring", url, opts, func(body []byte) error {
+		var err error
+		entries, err = ParseKeyring(body)
+		if err != nil {
+			return fmt.Errorf("invalid keyring %s: %w", url, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keyringCache.Store(cacheKey, entries)
+	return entries, nil
+}
+
+// FetchRecipients downloads a recipients file (one public key per line, with
+// blank lines and "#" comments ignored, as for KeySources.RecipientsFile) over
+// HTTPS and returns its validated recipient strings
+func FetchRecipients(url string, opts KeyringOptions) ([]string, error) {
+	if err := checkKeysURL("recipients", url, opts); err != nil {
+		return nil, err
+	}
+
+	var recipients []string
+	err := loadKeys("recipients", url, opts, func(body []byte) error {
+		var err error
+		recipients, err = parseRecipientsBody(url, body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+// parseRecipientsBody validates a fetched recipients file
+func parseRecipientsBody(url string, body []byte) ([]string, error) {
+	var recipients []string
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := ParseRecipient(line); err != nil {
+			return nil, fmt.Errorf("invalid recipients %s: line %d: %w", url, i+1, err)
+		}
+		recipients = append(recipients, line)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("recipients %s contains no recipients", url)
+	}
+
+	return recipients, nil
+}
+
+// loadKeys fetches the document at url and hands it to parse, going through
+// opts.CacheDir when set: a cached copy younger than opts.CacheTTL is used
+// without fetching, and a fetched document that parses is written back to the
+// cache. A fetched document that doesn't parse is an error. Only when the
+// fetch fails with a network error (see isNetworkError) is a cached copy that
+// still parses used instead, and reported to opts.OnStaleCache.
+func loadKeys(what, url string, opts KeyringOptions, parse func(body []byte) error) error {
+	if opts.CacheDir == "" {
+		body, err := fetchKeys(what, url, opts)
+		if err != nil {
+			return err
+		}
+		return parse(body)
+	}
+
+	path := keysCachePath(opts.CacheDir, what, url, opts.PinSHA256)
+	if opts.CacheTTL > 0 {
+		if body, age, err := readKeysCache(path); err == nil && age < opts.CacheTTL && parse(body) == nil {
+			return nil
+		}
+	}
+
+	body, fetchErr := fetchKeys(what, url, opts)
+	if fetchErr == nil {
+		if err := parse(body); err != nil {
+			return err
+		}
+		return writeKeysCache(path, body)
+	}
+	if !isNetworkError(fetchErr) {
+		return fetchErr
+	}
+
+	cached, age, err := readKeysCache(path)
+	if err != nil || parse(cached) != nil {
+		return fetchErr
+	}
+	if opts.OnStaleCache != nil {
+		opts.OnStaleCache(url, age, fetchErr)
+	}
+	return nil
+}
+
+// keysCachePath names the cache file for a document by a hash of its kind,
+// URL, and pin, so URLs never need escaping and a copy fetched under one pin
+// is never used under another
+func keysCachePath(dir, what, url, pin string) string {
+	sum := sha256.Sum256([]byte(what + " " + url + " " + strings.ToLower(pin)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".keys")
+}
+
+// readKeysCache returns a cached document and the time since it was written
+func readKeysCache(path string) ([]byte, time.Duration, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, time.Since(info.ModTime()), nil
+}
+
+// writeKeysCache replaces the cached document atomically, so a concurrent
+// reader never sees a partial file
+func writeKeysCache(path string, body []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create key cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".keys-*")
+	if err != nil {
+		return fmt.Errorf("failed to write key cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write key cache: %w", err)
+	}
+	return nil
+}
+
+// isNetworkError reports whether a fetchKeys error means the server couldn't
+// be reached (DNS, refused connection, timeout, reset), as opposed to the
+// server answering in a way that must not be papered over with a cached
+// copy: a TLS alert, a failed certificate or pin check, a refused redirect
+func isNetworkError(err error) bool {
+	if errors.As(err, new(*tls.CertificateVerificationError)) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return false
+	}
+	// *url.Error is itself a net.Error, so look at what it wraps
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// checkKeysURL rejects URLs that do not use https, unless opts.AllowHTTP
+// permits http
+func checkKeysURL(what, url string, opts KeyringOptions) error {
+	if strings.HasPrefix(url, "https://") || (opts.AllowHTTP && strings.HasPrefix(url, "http://")) {
+		return nil
+	}
+	return fmt.Errorf("%s URL must use https: %s", what, url)
+}
+
+// fetchKeys performs the GET shared by FetchKeyring and FetchRecipients; what
+// names the document in errors
+func fetchKeys(what, url string, opts KeyringOptions) ([]byte, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultKeyringTimeout
+	}
+
+	tlsConfig := &tls.Config{RootCAs: opts.RootCAs}
+	if opts.PinSHA256 != "" {
+		pin := strings.ToLower(opts.PinSHA256)
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("%s server presented no certificate", what)
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if hex.EncodeToString(sum[:]) != pin {
+				return fmt.Errorf("%s server certificate does not match pin", what)
+			}
+			return nil
+		}
+	}
+
+	client := &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		// A redirect must meet the same https requirement as the URL itself
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("%s %s: stopped after 10 redirects", what, url)
+			}
+			if err := checkKeysURL(what, req.URL.String(), opts); err != nil {
+				return fmt.Errorf("refusing redirect: %w", err)
+			}
+			return nil
+		},
+	}
+
+	// The transport is only used for this request, so don't leave its
+	// connection open
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s %s: %w", what, url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s %s: unexpected status %s", what, url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKeyringSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s: %w", what, url, err)
+	}
+
+	return body, nil
+}
+
+// ParseKeyring parses and validates a JSON keyring document
+func ParseKeyring(data []byte) ([]KeyringEntry, error) {
+	var entries []KeyringEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring JSON: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("keyring contains no entries")
+	}
+
+	for i := range entries {
+		recipient, err := ParseRecipient(entries[i].Key)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d (%s): failed to parse recipient: %w", i, entries[i].Name, err)
+		}
+		entries[i].Recipient = recipient
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,343 @@
+package enc
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func newKeyringServer(t *testing.T, body string) (*httptest.Server, *int) {
+	t.Helper()
+
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func serverPool(server *httptest.Server) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return pool
+}
+
+func TestFetchKeyring(t *testing.T) {
+	keyring := fmt.Sprintf(`[{"name":"alice","key":"%s"},{"name":"bob","key":"%s"}]`,
+		testkeys.TestRecipient1, testkeys.TestRecipient2)
+
+	t.Run("fetch and parse", func(t *testing.T) {
+		server, requests := newKeyringServer(t, keyring)
+
+		entries, err := FetchKeyring(server.URL+"/team.json", KeyringOptions{RootCAs: serverPool(server)})
+		if err != nil {
+			t.Fatalf("Failed to fetch keyring: %v", err)
+		}
+
+		if len(entries) != 2 {
+			t.Fatalf("Expected 2 entries, got %d", len(entries))
+		}
+
+		if entries[0].Name != "alice" || entries[0].Key != testkeys.TestRecipient1 {
+			t.Errorf("Unexpected first entry: %+v", entries[0])
+		}
+
+		if entries[1].Recipient == nil {
+			t.Error("Expected parsed recipient for second entry")
+		}
+
+		// A second fetch should be served from the cache
+		if _, err := FetchKeyring(server.URL+"/team.json", KeyringOptions{RootCAs: serverPool(server)}); err != nil {
+			t.Fatalf("Failed to fetch cached keyring: %v", err)
+		}
+
+		if *requests != 1 {
+			t.Errorf("Expected 1 request with caching, got %d", *requests)
+		}
+	})
+
+	t.Run("matching pin", func(t *testing.T) {
+		server, _ := newKeyringServer(t, keyring)
+
+		sum := sha256.Sum256(server.Certificate().Raw)
+		opts := KeyringOptions{
+			RootCAs:   serverPool(server),
+			PinSHA256: hex.EncodeToString(sum[:]),
+		}
+
+		if _, err := FetchKeyring(server.URL+"/pinned.json", opts); err != nil {
+			t.Fatalf("Expected pinned fetch to succeed: %v", err)
+		}
+	})
+
+	t.Run("mismatched pin", func(t *testing.T) {
+		server, _ := newKeyringServer(t, keyring)
+
+		opts := KeyringOptions{
+			RootCAs:   serverPool(server),
+			PinSHA256: strings.Repeat("00", sha256.Size),
+		}
+
+		_, err := FetchKeyring(server.URL+"/mismatch.json", opts)
+		if err == nil {
+			t.Fatal("Expected error for mismatched pin")
+		}
+
+		if !strings.Contains(err.Error(), "pin") {
+			t.Errorf("Expected pin error, got: %v", err)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		server, _ := newKeyringServer(t, `[{"name":"mallory","key":"age1notakey"}]`)
+
+		_, err := FetchKeyring(server.URL+"/bad.json", KeyringOptions{RootCAs: serverPool(server)})
+		if err == nil {
+			t.Fatal("Expected error for invalid key")
+		}
+
+		if !strings.Contains(err.Error(), "mallory") {
+			t.Errorf("Expected error to name the entry, got: %v", err)
+		}
+	})
+
+	t.Run("requires https", func(t *testing.T) {
+		_, err := FetchKeyring("http://keys.example.com/team.json", KeyringOptions{})
+		if err == nil {
+			t.Fatal("Expected error for non-https URL")
+		}
+	})
+}
+
+func TestFetchRecipients(t *testing.T) {
+	recipientsFile := fmt.Sprintf("# team\n%s\n\n%s\n", testkeys.TestRecipient1, testkeys.TestRecipient2)
+
+	t.Run("fetch and parse", func(t *testing.T) {
+		server, _ := newKeyringServer(t, recipientsFile)
+
+		recipients, err := FetchRecipients(server.URL+"/team.txt", KeyringOptions{RootCAs: serverPool(server)})
+		if err != nil {
+			t.Fatalf("Failed to fetch recipients: %v", err)
+		}
+
+		expected := []string{testkeys.TestRecipient1, testkeys.TestRecipient2}
+		if strings.Join(recipients, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected %v, got %v", expected, recipients)
+		}
+	})
+
+	t.Run("non-200 status", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		t.Cleanup(server.Close)
+
+		_, err := FetchRecipients(server.URL+"/missing.txt", KeyringOptions{RootCAs: serverPool(server)})
+		if err == nil || !strings.Contains(err.Error(), "404") {
+			t.Errorf("Expected a 404 error, got: %v", err)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		server, _ := newKeyringServer(t, testkeys.TestRecipient1+"\nage1notakey\n")
+
+		_, err := FetchRecipients(server.URL+"/bad.txt", KeyringOptions{RootCAs: serverPool(server)})
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("Expected an error naming line 2, got: %v", err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		server, _ := newKeyringServer(t, "# nobody\n")
+
+		if _, err := FetchRecipients(server.URL+"/empty.txt", KeyringOptions{RootCAs: serverPool(server)}); err == nil {
+			t.Error("Expected error for a file without recipients")
+		}
+	})
+
+	t.Run("http only when allowed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, recipientsFile)
+		}))
+		t.Cleanup(server.Close)
+
+		if _, err := FetchRecipients(server.URL+"/team.txt", KeyringOptions{}); err == nil {
+			t.Fatal("Expected error for non-https URL")
+		}
+
+		recipients, err := FetchRecipients(server.URL+"/team.txt", KeyringOptions{AllowHTTP: true})
+		if err != nil {
+			t.Fatalf("Expected http fetch to succeed with AllowHTTP: %v", err)
+		}
+		if len(recipients) != 2 {
+			t.Errorf("Expected 2 recipients, got %d", len(recipients))
+		}
+	})
+
+	t.Run("redirect to http", func(t *testing.T) {
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, recipientsFile)
+		}))
+		t.Cleanup(plain.Close)
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, plain.URL+"/team.txt", http.StatusFound)
+		}))
+		t.Cleanup(server.Close)
+
+		_, err := FetchRecipients(server.URL+"/team.txt", KeyringOptions{RootCAs: serverPool(server)})
+		if err == nil || !strings.Contains(err.Error(), "must use https") {
+			t.Fatalf("Expected a redirect to http to be refused, got %v", err)
+		}
+
+		opts := KeyringOptions{RootCAs: serverPool(server), AllowHTTP: true}
+		if _, err := FetchRecipients(server.URL+"/team.txt", opts); err != nil {
+			t.Errorf("Expected the redirect to be followed with AllowHTTP: %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+
+		opts := KeyringOptions{RootCAs: serverPool(server), Timeout: 50 * time.Millisecond}
+		if _, err := FetchRecipients(server.URL+"/slow.txt", opts); err == nil {
+			t.Error("Expected a timeout error")
+		}
+	})
+}
+
+func TestFetchRecipientsCache(t *testing.T) {
+	recipientsFile := fmt.Sprintf("%s\n%s\n", testkeys.TestRecipient1, testkeys.TestRecipient2)
+
+	t.Run("falls back to the cache when the fetch fails", func(t *testing.T) {
+		server, requests := newKeyringServer(t, recipientsFile)
+		url := server.URL + "/team.txt"
+		opts := KeyringOptions{RootCAs: serverPool(server), CacheDir: t.TempDir()}
+
+		if _, err := FetchRecipients(url, opts); err != nil {
+			t.Fatalf("Failed to fetch recipients: %v", err)
+		}
+		server.Close()
+
+		var staleURL string
+		opts.OnStaleCache = func(url string, age time.Duration, fetchErr error) {
+			staleURL = url
+			if fetchErr == nil {
+				t.Error("Expected the fetch error to be reported")
+			}
+		}
+		recipients, err := FetchRecipients(url, opts)
+		if err != nil {
+			t.Fatalf("Expected cached recipients while offline: %v", err)
+		}
+		if len(recipients) != 2 {
+			t.Errorf("Expected 2 recipients, got %d", len(recipients))
+		}
+		if staleURL != url {
+			t.Errorf("Expected stale cache warning for %s, got %q", url, staleURL)
+		}
+		if *requests != 1 {
+			t.Errorf("Expected 1 successful request, got %d", *requests)
+		}
+	})
+
+	t.Run("fresh cache skips the fetch", func(t *testing.T) {
+		server, requests := newKeyringServer(t, recipientsFile)
+		url := server.URL + "/team.txt"
+		opts := KeyringOptions{RootCAs: serverPool(server), CacheDir: t.TempDir(), CacheTTL: time.Hour}
+
+		for i := 0; i < 2; i++ {
+			if _, err := FetchRecipients(url, opts); err != nil {
+				t.Fatalf("Failed to fetch recipients: %v", err)
+			}
+		}
+		if *requests != 1 {
+			t.Errorf("Expected 1 request within the TTL, got %d", *requests)
+		}
+	})
+
+	t.Run("invalid document is an error and keeps the previous cache", func(t *testing.T) {
+		body := recipientsFile
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		t.Cleanup(server.Close)
+		url := server.URL + "/team.txt"
+		opts := KeyringOptions{RootCAs: serverPool(server), CacheDir: t.TempDir()}
+
+		if _, err := FetchRecipients(url, opts); err != nil {
+			t.Fatalf("Failed to fetch recipients: %v", err)
+		}
+
+		body = "<html>captive portal</html>"
+		stale := false
+		opts.OnStaleCache = func(string, time.Duration, error) { stale = true }
+		if _, err := FetchRecipients(url, opts); err == nil || stale {
+			t.Errorf("Expected an invalid document to fail without the cache, got %v (stale=%v)", err, stale)
+		}
+
+		body = ""
+		server.Close()
+		recipients, err := FetchRecipients(url, opts)
+		if err != nil || len(recipients) != 2 {
+			t.Errorf("Expected the earlier copy to survive the invalid document, got %v, %v", recipients, err)
+		}
+	})
+
+	t.Run("certificate failure does not fall back", func(t *testing.T) {
+		server, _ := newKeyringServer(t, recipientsFile)
+		url := server.URL + "/team.txt"
+		opts := KeyringOptions{RootCAs: serverPool(server), CacheDir: t.TempDir()}
+
+		if _, err := FetchRecipients(url, opts); err != nil {
+			t.Fatalf("Failed to fetch recipients: %v", err)
+		}
+
+		// A server the client doesn't trust is someone else's, not an outage
+		opts.RootCAs = x509.NewCertPool()
+		stale := false
+		opts.OnStaleCache = func(string, time.Duration, error) { stale = true }
+		if _, err := FetchRecipients(url, opts); err == nil || stale {
+			t.Errorf("Expected an untrusted certificate to fail without the cache, got %v (stale=%v)", err, stale)
+		}
+	})
+
+	t.Run("pin is part of the cache key", func(t *testing.T) {
+		server, _ := newKeyringServer(t, recipientsFile)
+		url := server.URL + "/team.txt"
+		sum := sha256.Sum256(server.Certificate().Raw)
+		opts := KeyringOptions{RootCAs: serverPool(server), CacheDir: t.TempDir(), PinSHA256: hex.EncodeToString(sum[:])}
+
+		if _, err := FetchRecipients(url, opts); err != nil {
+			t.Fatalf("Failed to fetch recipients: %v", err)
+		}
+		server.Close()
+
+		opts.PinSHA256 = strings.Repeat("00", sha256.Size)
+		if _, err := FetchRecipients(url, opts); err == nil {
+			t.Error("Expected a copy cached under another pin not to be used")
+		}
+	})
+
+	t.Run("no cache still fails", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		t.Cleanup(server.Close)
+
+		opts := KeyringOptions{RootCAs: serverPool(server), CacheDir: t.TempDir()}
+		if _, err := FetchRecipients(server.URL+"/team.txt", opts); err == nil {
+			t.Error("Expected an error without a cached copy")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package enc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+)
+
+var (
+	// ErrIdentityAsRecipient is returned by ParseRecipient for a private key,
+	// such as an AGE-SECRET-KEY-1... line pasted into a recipients file
+	ErrIdentityAsRecipient = errors.New("that looks like a private identity, not a public recipient (age-keygen -y prints its recipient)")
+
+	// ErrRecipientAsIdentity is returned by ParseIdentity for a public key,
+	// such as an age1... recipient given where an identity is expected
+	ErrRecipientAsIdentity = errors.New("that looks like a public recipient, not a private identity")
+)
+
+// looksLikeIdentity reports whether s has the form of a private key
+func looksLikeIdentity(s string) bool {
+	upper := strings.ToUpper(s)
+	return strings.HasPrefix(upper, "AGE-SECRET-KEY-") || strings.HasPrefix(upper, "AGE-PLUGIN-") ||
+		strings.Contains(s, "PRIVATE KEY-----")
+}
+
+// looksLikeRecipient reports whether s has the form of a public key
+func looksLikeRecipient(s string) bool {
+	return strings.HasPrefix(s, "age1") || strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-")
+}
+
+// ParseRecipient parses a recipient in any supported format: an X25519
+// "age1..." key, an ssh-ed25519 or ssh-rsa authorized_keys line, or a plugin
+// "age1<name>1..." recipient, tried in that order
+func ParseRecipient(s string) (age.Recipient, error) {
+	s = strings.TrimSpace(s)
+
+	if recipient, err := age.ParseX25519Recipient(s); err == nil {
+		return recipient, nil
+	}
+
+	if looksLikeIdentity(s) {
+		return nil, ErrIdentityAsRecipient
+	}
+
+	if strings.HasPrefix(s, "ssh-") {
+		recipient, err := agessh.ParseRecipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH recipient: %w", err)
+		}
+		return recipient, nil
+	}
+
+	if strings.HasPrefix(s, "age1") {
+		recipient, err := plugin.NewRecipient(s, pluginUI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient: %w", err)
+		}
+		return recipient, nil
+	}
+
+	return nil, fmt.Errorf("unknown recipient type: expected an age1... key, an ssh-ed25519/ssh-rsa public key, or a plugin recipient")
+}
+
+// ParseIdentity parses an identity in any supported format: an X25519
+// "AGE-SECRET-KEY-1..." key, an unencrypted or passphrase-protected SSH
+// private key, or a plugin "AGE-PLUGIN-<NAME>-1..." identity, tried in that
+// order. Passphrase-protected SSH keys fail to decrypt; use KeySources with
+// an SSHPassphraseProvider for those.
+func ParseIdentity(s string) (age.Identity, error) {
+	return parseIdentity(s, nil)
+}
+
+func parseIdentity(s string, sshPassphrase func() ([]byte, error)) (age.Identity, error) {
+	trimmed := strings.TrimSpace(s)
+
+	if identity, err := age.ParseX25519Identity(trimmed); err == nil {
+		return identity, nil
+	}
+
+	if isSSHPrivateKey([]byte(s)) {
+		return parseSSHIdentity([]byte(s), sshPassphrase)
+	}
+
+	if strings.HasPrefix(trimmed, "AGE-PLUGIN-") {
+		identity, err := plugin.NewIdentity(trimmed, pluginUI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin identity: %w", err)
+		}
+		return identity, nil
+	}
+
+	if strings.HasPrefix(trimmed, "AGE-SECRET-KEY-") {
+		return nil, fmt.Errorf("invalid age secret key")
+	}
+
+	if looksLikeRecipient(trimmed) {
+		return nil, ErrRecipientAsIdentity
+	}
+
+	return nil, fmt.Errorf("unknown identity type: expected an AGE-SECRET-KEY-1... key, an SSH private key, or a plugin identity")
+}
+
+// pluginUI lets plugins print messages to stderr. Plugins that need to prompt
+// for input are not supported, since viola may run non-interactively.
+var pluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		fmt.Fprintf(os.Stderr, "age-plugin-%s: %s\n", name, message)
+		return nil
+	},
+	RequestValue: func(name, prompt string, secret bool) (string, error) {
+		return "", fmt.Errorf("age-plugin-%s requested input (%q), which is not supported", name, prompt)
+	},
+	Confirm: func(name, prompt, yes, no string) (bool, error) {
+		return false, fmt.Errorf("age-plugin-%s requested confirmation (%q), which is not supported", name, prompt)
+	},
+}
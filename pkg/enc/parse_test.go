@@ -0,0 +1,140 @@
+package enc
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func TestParseRecipient(t *testing.T) {
+	_, sshPublicKey := writeSSHKey(t, "")
+
+	t.Run("X25519", func(t *testing.T) {
+		recipient, err := ParseRecipient("  " + testkeys.TestRecipient1 + "\n")
+		if err != nil {
+			t.Fatalf("ParseRecipient failed: %v", err)
+		}
+		if _, ok := recipient.(*age.X25519Recipient); !ok {
+			t.Errorf("Expected *age.X25519Recipient, got %T", recipient)
+		}
+	})
+
+	t.Run("SSH", func(t *testing.T) {
+		recipient, err := ParseRecipient(sshPublicKey)
+		if err != nil {
+			t.Fatalf("ParseRecipient failed: %v", err)
+		}
+		if _, ok := recipient.(*agessh.Ed25519Recipient); !ok {
+			t.Errorf("Expected *agessh.Ed25519Recipient, got %T", recipient)
+		}
+	})
+
+	t.Run("plugin", func(t *testing.T) {
+		recipient, err := ParseRecipient(plugin.EncodeRecipient("example", []byte("data")))
+		if err != nil {
+			t.Fatalf("ParseRecipient failed: %v", err)
+		}
+		if p, ok := recipient.(*plugin.Recipient); !ok || p.Name() != "example" {
+			t.Errorf("Expected plugin recipient named example, got %#v", recipient)
+		}
+	})
+
+	for _, invalid := range []string{"", "not-a-key", "age1invalid", "ssh-ed25519 AAAAinvalid"} {
+		if _, err := ParseRecipient(invalid); err == nil {
+			t.Errorf("ParseRecipient(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestParseIdentity(t *testing.T) {
+	sshKeyFile, _ := writeSSHKey(t, "")
+	sshKey, err := os.ReadFile(sshKeyFile)
+	if err != nil {
+		t.Fatalf("Failed to read SSH key: %v", err)
+	}
+
+	t.Run("X25519", func(t *testing.T) {
+		identity, err := ParseIdentity(testkeys.TestIdentity1)
+		if err != nil {
+			t.Fatalf("ParseIdentity failed: %v", err)
+		}
+		if _, ok := identity.(*age.X25519Identity); !ok {
+			t.Errorf("Expected *age.X25519Identity, got %T", identity)
+		}
+	})
+
+	t.Run("SSH", func(t *testing.T) {
+		identity, err := ParseIdentity(string(sshKey))
+		if err != nil {
+			t.Fatalf("ParseIdentity failed: %v", err)
+		}
+		if key, ok := PublicKeyString(identity); !ok || !strings.HasPrefix(key, "ssh-ed25519 ") {
+			t.Errorf("Expected an SSH identity, got %T (%q)", identity, key)
+		}
+	})
+
+	t.Run("plugin", func(t *testing.T) {
+		identity, err := ParseIdentity(plugin.EncodeIdentity("example", []byte("data")))
+		if err != nil {
+			t.Fatalf("ParseIdentity failed: %v", err)
+		}
+		if p, ok := identity.(*plugin.Identity); !ok || p.Name() != "example" {
+			t.Errorf("Expected plugin identity named example, got %#v", identity)
+		}
+	})
+
+	for _, invalid := range []string{"", "not-a-key", "AGE-SECRET-KEY-1INVALID", "AGE-PLUGIN-INVALID"} {
+		if _, err := ParseIdentity(invalid); err == nil {
+			t.Errorf("ParseIdentity(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestParseKeyMixups(t *testing.T) {
+	sshKeyFile, sshPublicKey := writeSSHKey(t, "")
+	sshKey, err := os.ReadFile(sshKeyFile)
+	if err != nil {
+		t.Fatalf("Failed to read SSH key: %v", err)
+	}
+
+	for _, identity := range []string{testkeys.TestIdentity1, strings.ToLower(testkeys.TestIdentity1), string(sshKey)} {
+		_, err := ParseRecipient(identity)
+		if !errors.Is(err, ErrIdentityAsRecipient) {
+			t.Errorf("Expected ErrIdentityAsRecipient for an identity, got %v", err)
+		}
+		if err != nil && strings.Contains(err.Error(), identity) {
+			t.Error("Error repeats the private key")
+		}
+	}
+
+	for _, recipient := range []string{testkeys.TestRecipient1, sshPublicKey} {
+		if _, err := ParseIdentity(recipient); !errors.Is(err, ErrRecipientAsIdentity) {
+			t.Errorf("Expected ErrRecipientAsIdentity for %q, got %v", recipient, err)
+		}
+	}
+
+	dir := t.TempDir()
+	recipientsFile := dir + "/recipients.txt"
+	if err := os.WriteFile(recipientsFile, []byte(testkeys.TestRecipient1+"\n"+testkeys.TestIdentity2+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write recipients file: %v", err)
+	}
+	_, err = KeySources{RecipientsFile: recipientsFile}.LoadRecipients()
+	if !errors.Is(err, ErrIdentityAsRecipient) || strings.Contains(err.Error(), testkeys.TestIdentity2) {
+		t.Errorf("Expected ErrIdentityAsRecipient without the key, got %v", err)
+	}
+	_, err = KeySources{Recipients: []string{testkeys.TestIdentity2}}.LoadRecipients()
+	if !errors.Is(err, ErrIdentityAsRecipient) || strings.Contains(err.Error(), testkeys.TestIdentity2) {
+		t.Errorf("Expected ErrIdentityAsRecipient without the key, got %v", err)
+	}
+	_, err = KeySources{IdentitiesData: []string{testkeys.TestRecipient1}}.LoadIdentities()
+	if !errors.Is(err, ErrRecipientAsIdentity) {
+		t.Errorf("Expected ErrRecipientAsIdentity, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package enc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+)
+
+// shortIDLength is the number of hex digits of the key hash in a short ID
+const shortIDLength = 8
+
+// ShortID returns a short, stable fingerprint of recipient for display, such
+// as "x25519:1f3a9c0e" (see ShortIDString). A passphrase is "passphrase".
+// age does not expose the public key of SSH recipients, so their ID comes
+// from the key hash age writes into the stanza tag, which is the same hash
+// ShortIDString uses. Plugin recipients are identified by name only; use
+// ShortIDString on the original key string to tell them apart.
+func ShortID(recipient age.Recipient) string {
+	switch r := recipient.(type) {
+	case *age.X25519Recipient:
+		return ShortIDString(r.String())
+	case *age.ScryptRecipient:
+		return "passphrase"
+	case *agessh.Ed25519Recipient:
+		return sshShortID("ssh-ed25519", r)
+	case *agessh.RSARecipient:
+		return sshShortID("ssh-rsa", r)
+	case *plugin.Recipient:
+		return "plugin-" + r.Name()
+	default:
+		return "unknown"
+	}
+}
+
+// sshShortID wraps a throwaway file key to recipient and reads the key hash
+// from the stanza tag: the first 4 bytes of the SHA-256 of the SSH wire-format
+// public key, which is exactly shortIDLength hex digits
+func sshShortID(kind string, recipient age.Recipient) string {
+	stanzas, err := recipient.Wrap(make([]byte, 16))
+	if err != nil || len(stanzas) == 0 || len(stanzas[0].Args) == 0 {
+		return kind
+	}
+	tag, err := base64.RawStdEncoding.DecodeString(stanzas[0].Args[0])
+	if err != nil {
+		return kind
+	}
+	return kind + ":" + hex.EncodeToString(tag)
+}
+
+// ShortIDString returns a short, stable fingerprint of a recipient string: its
+// type and the first 8 hex digits of the SHA-256 of the key, e.g.
+// "x25519:1f3a9c0e", "ssh-ed25519:7b02d4e1", or "plugin-yubikey:90c1aa3f".
+// SSH keys hash their wire-format key as age's stanza tag does, so comments
+// don't affect the ID and it matches ShortID. Strings that aren't keys get the
+// hash alone.
+func ShortIDString(recipient string) string {
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "passphrase" {
+		return recipient
+	}
+
+	kind, key := "", recipient
+	switch {
+	case strings.HasPrefix(recipient, "ssh-"):
+		fields := strings.Fields(recipient)
+		kind = fields[0]
+		key = strings.Join(fields[:min(len(fields), 2)], " ")
+		if len(fields) > 1 {
+			if blob, err := base64.StdEncoding.DecodeString(fields[1]); err == nil {
+				key = string(blob)
+			}
+		}
+	case strings.HasPrefix(recipient, "age1"):
+		// Bech32: the human-readable part ends at the last "1"
+		hrp := recipient[:strings.LastIndex(recipient, "1")]
+		if hrp == "age" {
+			kind = "x25519"
+		} else {
+			kind = "plugin-" + strings.TrimPrefix(hrp, "age1")
+		}
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	id := hex.EncodeToString(sum[:])[:shortIDLength]
+	if kind == "" {
+		return id
+	}
+	return kind + ":" + id
+}
@@ -0,0 +1,61 @@
+package enc
+
+import (
+	"regexp"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func TestShortID(t *testing.T) {
+	x25519, err := age.ParseX25519Recipient(testkeys.TestRecipient1)
+	if err != nil {
+		t.Fatalf("Failed to parse recipient: %v", err)
+	}
+
+	id := ShortID(x25519)
+	if !regexp.MustCompile(`^x25519:[0-9a-f]{8}$`).MatchString(id) {
+		t.Errorf("Unexpected short ID format: %q", id)
+	}
+	if id != ShortIDString(testkeys.TestRecipient1) {
+		t.Errorf("Expected ShortID and ShortIDString to agree, got %q and %q", id, ShortIDString(testkeys.TestRecipient1))
+	}
+	if id == ShortIDString(testkeys.TestRecipient2) {
+		t.Error("Expected different keys to get different short IDs")
+	}
+
+	scrypt, err := age.NewScryptRecipient(testkeys.TestPassphrase)
+	if err != nil {
+		t.Fatalf("Failed to create scrypt recipient: %v", err)
+	}
+	if got := ShortID(scrypt); got != "passphrase" {
+		t.Errorf("Expected passphrase, got %q", got)
+	}
+
+	_, sshKey := writeSSHKey(t, "")
+	sshRecipient, err := ParseRecipient(sshKey)
+	if err != nil {
+		t.Fatalf("Failed to parse SSH recipient: %v", err)
+	}
+	sshID := ShortIDString(sshKey)
+	if !regexp.MustCompile(`^ssh-ed25519:[0-9a-f]{8}$`).MatchString(sshID) {
+		t.Errorf("Unexpected SSH short ID format: %q", sshID)
+	}
+	if got := ShortID(sshRecipient); got != sshID {
+		t.Errorf("Expected ShortID to match ShortIDString for SSH, got %q and %q", got, sshID)
+	}
+
+	_, otherKey := writeSSHKey(t, "")
+	if ShortIDString(otherKey) == sshID {
+		t.Error("Expected different SSH keys to have different short IDs")
+	}
+	if ShortIDString(sshKey+" alice@laptop") != sshID {
+		t.Error("Expected the SSH comment not to affect the short ID")
+	}
+
+	if got := ShortIDString("age1yubikey1qwerty"); !regexp.MustCompile(`^plugin-yubikey:[0-9a-f]{8}$`).MatchString(got) {
+		t.Errorf("Unexpected plugin short ID format: %q", got)
+	}
+}
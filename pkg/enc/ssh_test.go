@@ -0,0 +1,128 @@
+package enc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeSSHKey writes a fresh ed25519 SSH private key (optionally passphrase-protected)
+// and returns its path and authorized_keys line
+func writeSSHKey(t *testing.T, passphrase string) (string, string) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	return keyFile, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func TestSSHIdentityFile(t *testing.T) {
+	t.Run("unencrypted key", func(t *testing.T) {
+		keyFile, publicKey := writeSSHKey(t, "")
+
+		identities, err := KeySources{IdentitiesFile: keyFile}.LoadIdentities()
+		if err != nil {
+			t.Fatalf("Failed to load SSH identity: %v", err)
+		}
+		if len(identities) != 1 {
+			t.Fatalf("Expected 1 identity, got %d", len(identities))
+		}
+
+		got, ok := PublicKeyString(identities[0])
+		if !ok || got != publicKey {
+			t.Errorf("Expected public key %s, got %s", publicKey, got)
+		}
+
+		// The identity should decrypt data encrypted to the SSH recipient
+		recipient, err := agessh.ParseRecipient(publicKey)
+		if err != nil {
+			t.Fatalf("Failed to parse SSH recipient: %v", err)
+		}
+		encrypted, err := Encrypt([]byte("secret"), []age.Recipient{recipient})
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		decrypted, err := Decrypt(encrypted, identities)
+		if err != nil {
+			t.Fatalf("Failed to decrypt with SSH identity: %v", err)
+		}
+		if string(decrypted) != "secret" {
+			t.Errorf("Expected secret, got %s", decrypted)
+		}
+	})
+
+	t.Run("passphrase-protected key", func(t *testing.T) {
+		keyFile, publicKey := writeSSHKey(t, "hunter2hunter2")
+
+		// The public key is available without the passphrase
+		identities, err := KeySources{IdentitiesFile: keyFile}.LoadIdentities()
+		if err != nil {
+			t.Fatalf("Failed to load SSH identity: %v", err)
+		}
+		got, ok := PublicKeyString(identities[0])
+		if !ok || got != publicKey {
+			t.Errorf("Expected public key %s, got %s", publicKey, got)
+		}
+
+		recipient, err := agessh.ParseRecipient(publicKey)
+		if err != nil {
+			t.Fatalf("Failed to parse SSH recipient: %v", err)
+		}
+		encrypted, err := Encrypt([]byte("secret"), []age.Recipient{recipient})
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+
+		if _, err := Decrypt(encrypted, identities); err == nil {
+			t.Error("Expected decryption without a passphrase to fail")
+		}
+
+		identities, err = KeySources{
+			IdentitiesFile: keyFile,
+			SSHPassphraseProvider: func() ([]byte, error) {
+				return []byte("hunter2hunter2"), nil
+			},
+		}.LoadIdentities()
+		if err != nil {
+			t.Fatalf("Failed to load SSH identity: %v", err)
+		}
+		decrypted, err := Decrypt(encrypted, identities)
+		if err != nil {
+			t.Fatalf("Failed to decrypt with passphrase: %v", err)
+		}
+		if string(decrypted) != "secret" {
+			t.Errorf("Expected secret, got %s", decrypted)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package enc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age/armor"
+)
+
+// armorColumns is the line width age's armor writer uses and its reader requires
+const armorColumns = 64
+
+// SingleLinePrefix starts a single-line encrypted value: the binary age file,
+// base64-encoded on one line (see ToSingleLine)
+const SingleLinePrefix = "viola:"
+
+// ageMagic starts every binary age file
+const ageMagic = "age-encryption.org/"
+
+// WrapArmor rewraps the base64 body of an armored age block to the given number
+// of columns. Zero leaves the block unchanged and a negative width puts the whole
+// body on one line. Data without armor markers is returned as-is.
+func WrapArmor(armoredData string, columns int) string {
+	if columns == 0 {
+		return armoredData
+	}
+
+	start := strings.Index(armoredData, armor.Header)
+	end := strings.LastIndex(armoredData, armor.Footer)
+	if start < 0 || end < start {
+		return armoredData
+	}
+
+	body := strings.Join(strings.Fields(armoredData[start+len(armor.Header):end]), "")
+
+	var b strings.Builder
+	b.WriteString(armor.Header + "\n")
+	for columns > 0 && len(body) > columns {
+		b.WriteString(body[:columns] + "\n")
+		body = body[columns:]
+	}
+	if body != "" {
+		b.WriteString(body + "\n")
+	}
+	b.WriteString(armor.Footer + "\n")
+
+	return b.String()
+}
+
+// IsArmored reports whether s is an encrypted age value: an armored block,
+// with the header at the start and the footer at the end (surrounding
+// whitespace aside) and a valid base64 body between them, or a single-line
+// value (see IsSingleLine). Text that merely quotes the markers is not armored.
+func IsArmored(s string) bool {
+	s = strings.TrimSpace(s)
+	if IsSingleLine(s) {
+		return true
+	}
+	if !strings.HasPrefix(s, armor.Header) || !strings.HasSuffix(s, armor.Footer) {
+		return false
+	}
+	if len(s) < len(armor.Header)+len(armor.Footer) {
+		return false // the markers overlap
+	}
+
+	body := strings.Join(strings.Fields(s[len(armor.Header):len(s)-len(armor.Footer)]), "")
+	if body == "" {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(body)
+	return err == nil
+}
+
+// IsSingleLine reports whether s is a single-line encrypted value:
+// SingleLinePrefix followed by the base64 of a binary age file. Other strings
+// that happen to start with the prefix are plaintext.
+func IsSingleLine(s string) bool {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), SingleLinePrefix)
+	if !ok {
+		return false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	return err == nil && bytes.HasPrefix(data, []byte(ageMagic))
+}
+
+// ToSingleLine converts an armored age block to a single-line value, so an
+// encrypted field takes one line in a file. Everything that reads armored
+// blocks in this package reads single-line values too.
+func ToSingleLine(armoredData string) (string, error) {
+	if IsSingleLine(armoredData) {
+		return strings.TrimSpace(armoredData), nil
+	}
+	data, err := io.ReadAll(newArmorReader(armoredData))
+	if err != nil {
+		return "", fmt.Errorf("failed to read armor: %w", err)
+	}
+	return SingleLinePrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// newArmorReader returns a reader for the binary age file in armoredData,
+// accepting any line width by rewrapping to the width age expects, or a
+// single-line value
+func newArmorReader(armoredData string) io.Reader {
+	if encoded, ok := strings.CutPrefix(strings.TrimSpace(armoredData), SingleLinePrefix); ok {
+		return base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded))
+	}
+	return armor.NewReader(strings.NewReader(WrapArmor(armoredData, armorColumns)))
+}
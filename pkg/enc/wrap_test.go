@@ -0,0 +1,157 @@
+package enc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func TestWrapArmor(t *testing.T) {
+	recipients, err := testkeys.GetTestRecipients()
+	if err != nil {
+		t.Fatalf("Failed to get test recipients: %v", err)
+	}
+	identities, err := testkeys.GetTestIdentities()
+	if err != nil {
+		t.Fatalf("Failed to get test identities: %v", err)
+	}
+
+	armored, err := Encrypt([]byte("secret"), recipients)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	if WrapArmor(armored, 0) != armored {
+		t.Error("Expected width 0 to leave the armor unchanged")
+	}
+	if WrapArmor(armored, 64) != armored {
+		t.Error("Expected width 64 to reproduce age's own wrapping")
+	}
+
+	tests := []struct {
+		name     string
+		columns  int
+		maxWidth int
+		lines    int
+	}{
+		{"narrow", 40, 40, 0},
+		{"wide", 76, 76, 0},
+		{"unwrapped", -1, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := WrapArmor(armored, tt.columns)
+			lines := strings.Split(strings.TrimSuffix(wrapped, "\n"), "\n")
+
+			if tt.lines > 0 && len(lines) != tt.lines {
+				t.Errorf("Expected %d lines, got %d:\n%s", tt.lines, len(lines), wrapped)
+			}
+			for _, line := range lines[1 : len(lines)-1] {
+				if tt.maxWidth > 0 && len(line) > tt.maxWidth {
+					t.Errorf("Line longer than %d columns: %q", tt.maxWidth, line)
+				}
+			}
+
+			decrypted, err := Decrypt(wrapped, identities)
+			if err != nil {
+				t.Fatalf("Failed to decrypt rewrapped armor: %v", err)
+			}
+			if string(decrypted) != "secret" {
+				t.Errorf("Expected secret, got %s", decrypted)
+			}
+
+			if _, err := ParseHeader(wrapped); err != nil {
+				t.Errorf("Failed to parse header of rewrapped armor: %v", err)
+			}
+		})
+	}
+
+	if WrapArmor("not armor", 10) != "not armor" {
+		t.Error("Expected data without armor markers to be returned as-is")
+	}
+}
+
+func TestIsArmored(t *testing.T) {
+	recipients, err := testkeys.GetTestRecipients()
+	if err != nil {
+		t.Fatalf("Failed to get test recipients: %v", err)
+	}
+
+	armored, err := Encrypt([]byte("secret"), recipients)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	singleLine, err := ToSingleLine(armored)
+	if err != nil {
+		t.Fatalf("Failed to convert to a single line: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{"armored block", armored, true},
+		{"surrounding whitespace", "\n  " + armored + "\n\n", true},
+		{"one-line body", WrapArmor(armored, -1), true},
+		{"single line", singleLine, true},
+		{"single-line prefix on plaintext", SingleLinePrefix + "hello", false},
+		{"single-line prefix on other base64", SingleLinePrefix + "aGVsbG8=", false},
+		{"quoted in prose", "Values look like -----BEGIN AGE ENCRYPTED FILE----- ... -----END AGE ENCRYPTED FILE-----", false},
+		{"text before header", "ciphertext: " + armored, false},
+		{"text after footer", armored + " (rotated 2024)", false},
+		{"markers only", "-----BEGIN AGE ENCRYPTED FILE-----\n-----END AGE ENCRYPTED FILE-----", false},
+		{"invalid body", "-----BEGIN AGE ENCRYPTED FILE-----\nnot base64!\n-----END AGE ENCRYPTED FILE-----", false},
+		{"plain", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsArmored(tt.value); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestToSingleLine(t *testing.T) {
+	recipients, err := testkeys.GetTestRecipients()
+	if err != nil {
+		t.Fatalf("Failed to get test recipients: %v", err)
+	}
+	identities, err := testkeys.GetTestIdentities()
+	if err != nil {
+		t.Fatalf("Failed to get test identities: %v", err)
+	}
+
+	armored, err := Encrypt([]byte("secret"), recipients)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	singleLine, err := ToSingleLine(armored)
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	if !strings.HasPrefix(singleLine, SingleLinePrefix) || strings.Contains(singleLine, "\n") {
+		t.Errorf("Expected one %q line, got %q", SingleLinePrefix, singleLine)
+	}
+
+	if again, err := ToSingleLine(singleLine); err != nil || again != singleLine {
+		t.Errorf("Expected a single-line value to be returned as is, got %q, %v", again, err)
+	}
+
+	decrypted, err := Decrypt(singleLine, identities)
+	if err != nil {
+		t.Fatalf("Failed to decrypt a single-line value: %v", err)
+	}
+	if string(decrypted) != "secret" {
+		t.Errorf("Expected secret, got %q", decrypted)
+	}
+
+	if _, err := ToSingleLine("not armor"); err == nil {
+		t.Error("Expected an error converting plaintext")
+	}
+}
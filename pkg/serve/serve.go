@@ -0,0 +1,168 @@
+// Package serve exposes a decrypted viola configuration over a Unix domain socket.
+//
+// The protocol is line-based: the client writes a dotted path (e.g.
+// "database.private_password") followed by a newline, and the server answers
+// with a single JSON object followed by a newline: {"found": true, "value": ...}
+// on success, where value may be false, 0, "" or null, or {"found": false,
+// "value": null, "error": "..."} on failure. A connection may carry any number
+// of requests.
+package serve
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// Response is the JSON reply for a single request
+type Response struct {
+	// Found reports whether the path resolved, so a false, zero, or empty
+	// Value can be told apart from a failed request
+	Found bool `json:"found"`
+
+	// Value is the value found at the requested path
+	Value any `json:"value"`
+
+	// Error describes why the request failed
+	Error string `json:"error,omitempty"`
+}
+
+// Server serves values from a decrypted tree over a Unix domain socket
+type Server struct {
+	tree     map[string]any
+	listener net.Listener
+	path     string
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// Listen creates a Unix domain socket at socketPath, restricted to the owner,
+// that serves values from tree. A stale socket file at the same path is replaced.
+func Listen(socketPath string, tree map[string]any) (*Server, error) {
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace non-socket file %s", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", socketPath, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	return &Server{
+		tree:     tree,
+		listener: listener,
+		path:     socketPath,
+		conns:    make(map[net.Conn]bool),
+	}, nil
+}
+
+// Serve accepts connections until the server is closed
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Close stops the server, closes open connections, and removes the socket file
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	os.Remove(s.path)
+	return err
+}
+
+// handle answers requests on a single connection
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if err := encoder.Encode(s.lookup(path)); err != nil {
+			return
+		}
+	}
+}
+
+// lookup resolves a dotted path against the served tree
+func (s *Server) lookup(path string) Response {
+	if path == "" {
+		return Response{Error: "empty path"}
+	}
+
+	value, found := walk.GetValue(s.tree, walk.ParsePath(path))
+	if !found {
+		return Response{Error: fmt.Sprintf("path not found: %s", path)}
+	}
+
+	return Response{Found: true, Value: value}
+}
+
+// Get requests a single path from the server listening at socketPath
+func Get(socketPath, path string) (any, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, path); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if !resp.Found {
+		return nil, fmt.Errorf("path not found: %s", path)
+	}
+
+	return resp.Value, nil
+}
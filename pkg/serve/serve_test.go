@@ -0,0 +1,139 @@
+package serve
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+	"github.com/andreweick/viola/pkg/viola"
+)
+
+func TestSocketRoundTrip(t *testing.T) {
+	testData := map[string]any{
+		"username": "alice",
+		"enabled":  false,
+		"retries":  int64(0),
+		"empty":    "",
+		"database": map[string]any{
+			"private_password": "secret123",
+		},
+		"servers": []any{
+			map[string]any{"name": "prod"},
+		},
+	}
+
+	opts := viola.Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	encrypted, _, err := viola.Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	result, err := viola.Load(encrypted, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	// Unix socket paths are length-limited, so avoid the long t.TempDir path
+	dir, err := os.MkdirTemp("", "viola")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socketPath := filepath.Join(dir, "viola.sock")
+	server, err := Listen(socketPath, result.Tree)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve() }()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected socket mode 0600, got %o", perm)
+	}
+
+	t.Run("decrypted value", func(t *testing.T) {
+		value, err := Get(socketPath, "database.private_password")
+		if err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+		if value != "secret123" {
+			t.Errorf("Expected secret123, got %v", value)
+		}
+	})
+
+	t.Run("array element", func(t *testing.T) {
+		value, err := Get(socketPath, "servers[0].name")
+		if err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+		if value != "prod" {
+			t.Errorf("Expected prod, got %v", value)
+		}
+	})
+
+	t.Run("false value", func(t *testing.T) {
+		for path, expected := range map[string]any{"enabled": false, "retries": float64(0), "empty": ""} {
+			value, err := Get(socketPath, path)
+			if err != nil {
+				t.Fatalf("Failed to get %s: %v", path, err)
+			}
+			if value != expected {
+				t.Errorf("Expected %s = %#v, got %#v", path, expected, value)
+			}
+		}
+
+		// The reply spells out the value rather than omitting it
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, "enabled")
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		if line != `{"found":true,"value":false}`+"\n" {
+			t.Errorf("Unexpected reply for a false value: %q", line)
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		_, err := Get(socketPath, "database.nonexistent")
+		if err == nil {
+			t.Fatal("Expected error for missing path")
+		}
+		if !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Expected 'not found' error, got: %v", err)
+		}
+	})
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Failed to close server: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned error: %v", err)
+	}
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Error("Expected socket file to be removed on close")
+	}
+}
@@ -0,0 +1,219 @@
+// Package sign creates and verifies detached SSH signatures over viola files.
+//
+// Signatures use the SSHSIG format produced by `ssh-keygen -Y sign`, so they
+// can also be checked with `ssh-keygen -Y verify` using the "viola" namespace.
+// age authenticates each encrypted value, but not the surrounding TOML; a
+// signature over the whole file detects reordering, removal, or substitution
+// of fields in transit.
+package sign
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Namespace is the SSHSIG namespace used for viola signatures
+const Namespace = "viola"
+
+const (
+	magicPreamble = "SSHSIG"
+	sigVersion    = 1
+	hashAlgorithm = "sha512"
+	armorBegin    = "-----BEGIN SSH SIGNATURE-----"
+	armorEnd      = "-----END SSH SIGNATURE-----"
+)
+
+// ErrUntrustedSigner is returned when a signature is valid but was made by a key
+// that is not among the allowed signers
+var ErrUntrustedSigner = errors.New("signature was made by an untrusted key")
+
+// Sign produces an armored detached signature over data
+func Sign(data []byte, signer ssh.Signer, namespace string) ([]byte, error) {
+	signed := signedData(namespace, data)
+
+	var sig *ssh.Signature
+	var err error
+	if algSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SSHSIG forbids SHA-1 RSA signatures
+		sig, err = algSigner.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	var blob bytes.Buffer
+	blob.WriteString(magicPreamble)
+	binary.Write(&blob, binary.BigEndian, uint32(sigVersion))
+	writeString(&blob, signer.PublicKey().Marshal())
+	writeString(&blob, []byte(namespace))
+	writeString(&blob, nil) // reserved
+	writeString(&blob, []byte(hashAlgorithm))
+	writeString(&blob, ssh.Marshal(sig))
+
+	return armor(blob.Bytes()), nil
+}
+
+// Verify checks an armored detached signature over data and returns the
+// signing key. The key must be one of allowed.
+func Verify(data, armoredSig []byte, allowed []ssh.PublicKey, namespace string) (ssh.PublicKey, error) {
+	blob, err := dearmor(armoredSig)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(blob, []byte(magicPreamble)) {
+		return nil, fmt.Errorf("not an SSH signature")
+	}
+	r := bytes.NewReader(blob[len(magicPreamble):])
+
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+	if version != sigVersion {
+		return nil, fmt.Errorf("unsupported signature version %d", version)
+	}
+
+	fields := make([][]byte, 5)
+	for i := range fields {
+		if fields[i], err = readString(r); err != nil {
+			return nil, fmt.Errorf("malformed signature: %w", err)
+		}
+	}
+	keyBytes, sigNamespace, sigHash, sigBytes := fields[0], string(fields[1]), string(fields[3]), fields[4]
+
+	if sigNamespace != namespace {
+		return nil, fmt.Errorf("signature namespace %q does not match %q", sigNamespace, namespace)
+	}
+	if sigHash != hashAlgorithm {
+		return nil, fmt.Errorf("unsupported signature hash algorithm %q", sigHash)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature key: %w", err)
+	}
+
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(sigBytes, sig); err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	if err := publicKey.Verify(signedData(namespace, data), sig); err != nil {
+		return nil, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	for _, key := range allowed {
+		if bytes.Equal(key.Marshal(), publicKey.Marshal()) {
+			return publicKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUntrustedSigner, ssh.FingerprintSHA256(publicKey))
+}
+
+// ParseSigners parses allowed signer public keys in authorized_keys format,
+// skipping blank lines and comments
+func ParseSigners(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse SSH public key: %w", lineNum, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading signers: %w", err)
+	}
+
+	return keys, nil
+}
+
+// signedData builds the blob that is actually signed: the namespace and a hash of the message
+func signedData(namespace string, data []byte) []byte {
+	hash := sha512.Sum512(data)
+
+	var buf bytes.Buffer
+	buf.WriteString(magicPreamble)
+	writeString(&buf, []byte(namespace))
+	writeString(&buf, nil) // reserved
+	writeString(&buf, []byte(hashAlgorithm))
+	writeString(&buf, hash[:])
+	return buf.Bytes()
+}
+
+// writeString writes an SSH wire-format string (uint32 length prefix)
+func writeString(buf *bytes.Buffer, s []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.Write(s)
+}
+
+// readString reads an SSH wire-format string
+func readString(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// armor encodes a signature blob in the PEM-like format used by ssh-keygen
+func armor(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var buf bytes.Buffer
+	buf.WriteString(armorBegin + "\n")
+	for len(encoded) > 70 {
+		buf.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	buf.WriteString(encoded + "\n")
+	buf.WriteString(armorEnd + "\n")
+	return buf.Bytes()
+}
+
+// dearmor decodes an armored signature
+func dearmor(armored []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(armored))
+	if !strings.HasPrefix(text, armorBegin) || !strings.HasSuffix(text, armorEnd) {
+		return nil, fmt.Errorf("not an armored SSH signature")
+	}
+
+	body := strings.TrimSuffix(strings.TrimPrefix(text, armorBegin), armorEnd)
+	body = strings.Join(strings.Fields(body), "")
+
+	blob, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature encoding: %w", err)
+	}
+	return blob, nil
+}
@@ -0,0 +1,178 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSigner generates a throwaway ed25519 SSH signer
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func TestSignVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	data := []byte("private_password = \"-----BEGIN AGE ENCRYPTED FILE-----...\"\n")
+
+	sig, err := Sign(data, signer, Namespace)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	allowed := []ssh.PublicKey{signer.PublicKey()}
+
+	t.Run("valid signature", func(t *testing.T) {
+		key, err := Verify(data, sig, allowed, Namespace)
+		if err != nil {
+			t.Fatalf("Failed to verify: %v", err)
+		}
+		if ssh.FingerprintSHA256(key) != ssh.FingerprintSHA256(signer.PublicKey()) {
+			t.Error("Expected the signing key to be returned")
+		}
+	})
+
+	t.Run("tampered file", func(t *testing.T) {
+		tampered := append([]byte("username = \"mallory\"\n"), data...)
+		if _, err := Verify(tampered, sig, allowed, Namespace); err == nil {
+			t.Error("Expected verification of tampered data to fail")
+		}
+	})
+
+	t.Run("untrusted signer", func(t *testing.T) {
+		other := newTestSigner(t)
+		_, err := Verify(data, sig, []ssh.PublicKey{other.PublicKey()}, Namespace)
+		if !errors.Is(err, ErrUntrustedSigner) {
+			t.Errorf("Expected ErrUntrustedSigner, got %v", err)
+		}
+	})
+
+	t.Run("wrong namespace", func(t *testing.T) {
+		if _, err := Verify(data, sig, allowed, "file"); err == nil {
+			t.Error("Expected namespace mismatch to fail")
+		}
+	})
+
+	t.Run("not a signature", func(t *testing.T) {
+		if _, err := Verify(data, []byte("hello"), allowed, Namespace); err == nil {
+			t.Error("Expected garbage signature to fail")
+		}
+	})
+}
+
+func TestParseSigners(t *testing.T) {
+	signer := newTestSigner(t)
+	line := ssh.MarshalAuthorizedKey(signer.PublicKey())
+
+	keys, err := ParseSigners(append([]byte("# team signers\n\n"), line...))
+	if err != nil {
+		t.Fatalf("Failed to parse signers: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(keys))
+	}
+
+	if _, err := ParseSigners([]byte("ssh-ed25519 notbase64\n")); err == nil {
+		t.Error("Expected error for malformed key")
+	}
+}
+
+func TestSSHKeygenCompatibility(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	signer := newTestSigner(t)
+	data := []byte("username = \"alice\"\n")
+
+	sig, err := Sign(data, signer, Namespace)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	signersFile := filepath.Join(tmpDir, "allowed_signers")
+	sigFile := filepath.Join(tmpDir, "config.toml.sig")
+	allowed := append([]byte("viola@example.com "), ssh.MarshalAuthorizedKey(signer.PublicKey())...)
+	if err := os.WriteFile(signersFile, allowed, 0644); err != nil {
+		t.Fatalf("Failed to write allowed signers: %v", err)
+	}
+	if err := os.WriteFile(sigFile, sig, 0644); err != nil {
+		t.Fatalf("Failed to write signature: %v", err)
+	}
+
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", signersFile, "-I", "viola@example.com", "-n", Namespace, "-s", sigFile)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Failed to open stdin: %v", err)
+	}
+	go func() {
+		stdin.Write(data)
+		stdin.Close()
+	}()
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("ssh-keygen rejected signature: %v\n%s", err, output)
+	}
+}
+
+func TestVerifySSHKeygenSignature(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	keyFile := filepath.Join(tmpDir, "id_ed25519")
+	dataFile := filepath.Join(tmpDir, "config.toml")
+	data := []byte("username = \"alice\"\n")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if err := os.WriteFile(dataFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	if output, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", keyFile, "-n", Namespace, dataFile).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen failed to sign: %v\n%s", err, output)
+	}
+
+	sig, err := os.ReadFile(dataFile + ".sig")
+	if err != nil {
+		t.Fatalf("Failed to read signature: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	if _, err := Verify(data, sig, []ssh.PublicKey{signer.PublicKey()}, Namespace); err != nil {
+		t.Errorf("Failed to verify ssh-keygen signature: %v", err)
+	}
+}
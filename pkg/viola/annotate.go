@@ -0,0 +1,216 @@
+package viola
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+// recipientCommentTag starts each recipient annotation comment
+const recipientCommentTag = "recipient: "
+
+// armoredValueMarker is how an encrypted string value starts on a TOML key line
+const armoredValueMarker = ` = "-----BEGIN AGE ENCRYPTED FILE-----`
+
+// singleLineValueMarker is how a single-line encrypted value starts on a TOML key line
+const singleLineValueMarker = ` = "` + enc.SingleLinePrefix
+
+// RecipientMeta is annotational metadata about a recipient: why it is on the
+// file and when it should be reviewed. It does not affect encryption.
+type RecipientMeta struct {
+	// Label describes the recipient (e.g., "alice laptop")
+	Label string `toml:"label"`
+
+	// Expires is the date after which the recipient should be reviewed (zero: never)
+	Expires time.Time `toml:"expires"`
+}
+
+// Expired reports whether the recipient's review date has passed at now
+func (m RecipientMeta) Expired(now time.Time) bool {
+	return !m.Expires.IsZero() && now.After(m.Expires)
+}
+
+// RecipientNote is a recipient annotation read back from the comments above an encrypted field
+type RecipientNote struct {
+	Recipient string
+	RecipientMeta
+}
+
+// ParseRecipientMeta parses a sidecar file mapping recipients to metadata.
+// Each top-level table is named after a recipient:
+//
+//	["age1..."]
+//	label = "alice laptop"
+//	expires = 2025-12-31
+func ParseRecipientMeta(data []byte) (map[string]RecipientMeta, error) {
+	var meta map[string]RecipientMeta
+	md, err := toml.Decode(string(data), &meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recipient metadata: %w", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown recipient metadata key %q", undecoded[0].String())
+	}
+	return meta, nil
+}
+
+// formatRecipientComment renders one recipient annotation, without the comment prefix
+func formatRecipientComment(recipient string, meta RecipientMeta) string {
+	comment := recipientCommentTag + recipient
+	if meta.Label != "" {
+		comment += " " + strconv.Quote(meta.Label)
+	}
+	if !meta.Expires.IsZero() {
+		comment += " expires " + meta.Expires.Format(time.DateOnly)
+	}
+	return comment
+}
+
+// parseRecipientComment parses a comment written by formatRecipientComment
+func parseRecipientComment(comment string) (RecipientNote, bool) {
+	rest, ok := strings.CutPrefix(comment, recipientCommentTag)
+	if !ok {
+		return RecipientNote{}, false
+	}
+
+	recipient, rest, _ := strings.Cut(rest, " ")
+	if recipient == "" {
+		return RecipientNote{}, false
+	}
+	note := RecipientNote{Recipient: recipient}
+
+	if strings.HasPrefix(rest, `"`) {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return RecipientNote{}, false
+		}
+		note.Label, _ = strconv.Unquote(quoted)
+		rest = strings.TrimPrefix(rest[len(quoted):], " ")
+	}
+
+	if date, ok := strings.CutPrefix(rest, "expires "); ok {
+		expires, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return RecipientNote{}, false
+		}
+		note.Expires = expires
+	} else if rest != "" {
+		return RecipientNote{}, false
+	}
+
+	return note, true
+}
+
+// annotateRecipients inserts recipient comments above each encrypted field in
+// tomlData. Fields are located by their armored value, so the TOML layout
+// chosen by the encoder doesn't matter.
+func annotateRecipients(tomlData []byte, fields []FieldMeta, meta map[string]RecipientMeta, commentPrefix string) []byte {
+	recipientsByArmor := make(map[string][]string, len(fields))
+	for _, field := range fields {
+		recipientsByArmor[field.Armored] = field.UsedRecipients
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(tomlData))
+	scanner.Buffer(nil, len(tomlData)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if armored, ok := armoredValue(line); ok {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			for _, recipient := range recipientsByArmor[armored] {
+				out.WriteString(indent + commentPrefix + formatRecipientComment(recipient, meta[recipient]) + "\n")
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+
+	return out.Bytes()
+}
+
+// readRecipientNotes collects the recipient comments directly above each
+// encrypted field in data, keyed by the field's armored value
+func readRecipientNotes(data []byte, commentPrefix string) map[string][]RecipientNote {
+	notes := make(map[string][]RecipientNote)
+
+	var pending []RecipientNote
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if comment, ok := strings.CutPrefix(trimmed, commentPrefix); ok {
+			if note, ok := parseRecipientComment(comment); ok {
+				pending = append(pending, note)
+				continue
+			}
+		}
+
+		if armored, ok := armoredValue(line); ok && len(pending) > 0 {
+			notes[armored] = pending
+		}
+		pending = nil
+	}
+
+	return notes
+}
+
+// headerComment renders text as the comment block Save writes at the top of a
+// file, ending in a blank line that sets it apart from any field's comments
+func headerComment(text, commentPrefix string) []byte {
+	var out bytes.Buffer
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		out.WriteString(strings.TrimRight(commentPrefix+line, " \t") + "\n")
+	}
+	out.WriteString("\n")
+	return out.Bytes()
+}
+
+// readHeaderComment returns the text of the comment block at the top of data.
+// Only comments followed by a blank line count, so the recipient comments of
+// a first field are not mistaken for a header.
+func readHeaderComment(data []byte, commentPrefix string) string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		if !strings.HasPrefix(line, "#") {
+			return ""
+		}
+		if comment, ok := strings.CutPrefix(line, strings.TrimRight(commentPrefix, " \t")); ok {
+			line = strings.TrimPrefix(comment, " ")
+		} else {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ")
+		}
+		lines = append(lines, line)
+	}
+	return ""
+}
+
+// armoredValue returns the encrypted string assigned on a TOML key line
+func armoredValue(line string) (string, bool) {
+	i := strings.Index(line, armoredValueMarker)
+	if i < 0 {
+		i = strings.Index(line, singleLineValueMarker)
+	}
+	if i < 0 {
+		return "", false
+	}
+
+	var doc struct{ V string }
+	if _, err := toml.Decode("V"+line[i:], &doc); err != nil {
+		return "", false
+	}
+	return doc.V, isArmoredData(doc.V)
+}
@@ -0,0 +1,158 @@
+package viola
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestParseRecipientMeta(t *testing.T) {
+	data := []byte(`
+["` + testkeys.TestRecipient1 + `"]
+label = "alice laptop"
+expires = 2025-12-31
+
+["` + testkeys.TestRecipient2 + `"]
+label = "ci"
+`)
+
+	meta, err := ParseRecipientMeta(data)
+	if err != nil {
+		t.Fatalf("Failed to parse metadata: %v", err)
+	}
+
+	alice := meta[testkeys.TestRecipient1]
+	if alice.Label != "alice laptop" || alice.Expires.Format(time.DateOnly) != "2025-12-31" {
+		t.Errorf("Unexpected metadata for recipient 1: %+v", alice)
+	}
+	if ci := meta[testkeys.TestRecipient2]; ci.Label != "ci" || !ci.Expires.IsZero() {
+		t.Errorf("Unexpected metadata for recipient 2: %+v", ci)
+	}
+
+	if _, err := ParseRecipientMeta([]byte("[\"age1x\"]\nowner = \"bob\"\n")); err == nil {
+		t.Error("Expected error for unknown metadata key")
+	}
+}
+
+func TestRecipientComment(t *testing.T) {
+	expires := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+	tests := []RecipientNote{
+		{Recipient: "age1abc"},
+		{Recipient: "age1abc", RecipientMeta: RecipientMeta{Label: `bob's "work" key`}},
+		{Recipient: "age1abc", RecipientMeta: RecipientMeta{Expires: expires}},
+		{Recipient: "age1abc", RecipientMeta: RecipientMeta{Label: "alice", Expires: expires}},
+	}
+
+	for _, note := range tests {
+		comment := formatRecipientComment(note.Recipient, note.RecipientMeta)
+		parsed, ok := parseRecipientComment(comment)
+		if !ok {
+			t.Errorf("Failed to parse %q", comment)
+			continue
+		}
+		if !reflect.DeepEqual(parsed, note) {
+			t.Errorf("Round trip of %q: expected %+v, got %+v", comment, note, parsed)
+		}
+	}
+
+	for _, comment := range []string{"a regular comment", "recipient: ", "recipient: age1abc expires soon", "recipient: age1abc extra"} {
+		if _, ok := parseRecipientComment(comment); ok {
+			t.Errorf("Expected %q not to parse as a recipient comment", comment)
+		}
+	}
+}
+
+func TestSaveRecipientAnnotations(t *testing.T) {
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients: []string{testkeys.TestRecipient1, testkeys.TestRecipient2},
+		},
+		RecipientMeta: map[string]RecipientMeta{
+			testkeys.TestRecipient1: {Label: "alice", Expires: time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	tomlData, _, err := Save(map[string]any{
+		"private_token": "abc",
+		"database":      map[string]any{"host": "localhost", "private_password": "secret"},
+	}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	output := string(tomlData)
+	if count := strings.Count(output, "# recipient: "+testkeys.TestRecipient1+` "alice" expires 2025-12-31`); count != 2 {
+		t.Errorf("Expected 2 annotations for recipient 1, got %d:\n%s", count, output)
+	}
+	if count := strings.Count(output, "# recipient: "+testkeys.TestRecipient2+"\n"); count != 2 {
+		t.Errorf("Expected 2 bare annotations for recipient 2, got %d:\n%s", count, output)
+	}
+
+	result, err := Load(tomlData, Options{})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(result.Fields) != 2 {
+		t.Fatalf("Expected 2 fields, got %d", len(result.Fields))
+	}
+	for _, field := range result.Fields {
+		if len(field.RecipientNotes) != 2 {
+			t.Fatalf("Expected 2 notes on %v, got %+v", field.Path, field.RecipientNotes)
+		}
+		alice := field.RecipientNotes[0]
+		if alice.Recipient != testkeys.TestRecipient1 || alice.Label != "alice" {
+			t.Errorf("Unexpected first note on %v: %+v", field.Path, alice)
+		}
+		if !alice.Expired(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) || alice.Expired(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("Unexpected expiry for %+v", alice)
+		}
+	}
+}
+
+func TestSaveHeaderComment(t *testing.T) {
+	opts := Options{
+		Keys:          enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+		HeaderComment: "rotated db creds\n\nEncrypted with viola",
+	}
+
+	tomlData, _, err := Save(map[string]any{"private_token": "abc", "host": "localhost"}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if !strings.HasPrefix(string(tomlData), "# rotated db creds\n#\n# Encrypted with viola\n\n") {
+		t.Errorf("Expected the header comment at the top, got:\n%s", tomlData)
+	}
+
+	result, err := Load(tomlData, Options{})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if result.HeaderComment != opts.HeaderComment {
+		t.Errorf("HeaderComment = %q, want %q", result.HeaderComment, opts.HeaderComment)
+	}
+	if result.Tree["host"] != "localhost" {
+		t.Errorf("Unexpected tree: %v", result.Tree)
+	}
+
+	// Transform keeps the header it loaded
+	transformed, _, err := Transform(tomlData, Options{Keys: opts.Keys}, func(tree any) error {
+		tree.(map[string]any)["host"] = "db.internal"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if !strings.HasPrefix(string(transformed), "# rotated db creds\n") {
+		t.Errorf("Expected Transform to keep the header comment, got:\n%s", transformed)
+	}
+
+	// Recipient comments above a first field are not a header
+	annotated := "# recipient: " + testkeys.TestRecipient1 + "\nprivate_token = \"abc\"\n"
+	if result, err := Load([]byte(annotated), Options{}); err != nil || result.HeaderComment != "" {
+		t.Errorf("Expected no header comment, got %q, %v", result.HeaderComment, err)
+	}
+}
@@ -0,0 +1,73 @@
+package viola
+
+import "sync"
+
+// DecryptCache holds decrypted plaintext keyed by the exact armored block it
+// came from, so Load can skip age for ciphertext it has already decrypted. A
+// re-encrypted (e.g. rotated) secret has a new armored block, so it misses.
+//
+// A hit bypasses the identities entirely: share a cache only between Loads
+// that use the same keys.
+type DecryptCache interface {
+	// Get returns the plaintext cached for armored, if any
+	Get(armored string) ([]byte, bool)
+
+	// Set caches the plaintext of armored
+	Set(armored string, plaintext []byte)
+}
+
+// MemoryDecryptCache is an in-memory DecryptCache, safe for concurrent use.
+// Plaintext lives only in the process's memory, until Clear or until the
+// cache is garbage collected. The zero value is ready to use.
+type MemoryDecryptCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+// NewMemoryDecryptCache returns an empty MemoryDecryptCache
+func NewMemoryDecryptCache() *MemoryDecryptCache {
+	return &MemoryDecryptCache{}
+}
+
+// Get returns a copy of the plaintext cached for armored
+func (c *MemoryDecryptCache) Get(armored string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	plaintext, ok := c.entries[armored]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), plaintext...), true
+}
+
+// Set caches a copy of plaintext for armored
+func (c *MemoryDecryptCache) Set(armored string, plaintext []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string][]byte)
+	}
+	c.entries[armored] = append([]byte(nil), plaintext...)
+}
+
+// Len returns the number of cached entries
+func (c *MemoryDecryptCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Clear zeroes and drops every cached plaintext
+func (c *MemoryDecryptCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for armored, plaintext := range c.entries {
+		for i := range plaintext {
+			plaintext[i] = 0
+		}
+		delete(c.entries, armored)
+	}
+}
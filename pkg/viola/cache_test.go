@@ -0,0 +1,65 @@
+package viola
+
+import (
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestDecryptCache(t *testing.T) {
+	keys := enc.KeySources{
+		Recipients:     []string{testkeys.TestRecipient1},
+		IdentitiesData: []string{testkeys.TestIdentity1},
+	}
+	tree := map[string]any{
+		"private_password": "hunter2",
+		"private_db":       map[string]any{"user": "admin"},
+	}
+	data, _, err := Save(tree, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	cache := NewMemoryDecryptCache()
+	first, err := Load(data, Options{Keys: keys, DecryptCache: cache})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("Expected 2 cached blocks, got %d", cache.Len())
+	}
+
+	// Changing a loaded table must not reach the cache
+	first.Tree["private_db"].(map[string]any)["user"] = "changed"
+
+	// With no identities, only the cache can supply the plaintext
+	second, err := Load(data, Options{DecryptCache: cache})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if second.Tree["private_password"] != "hunter2" {
+		t.Errorf("Expected a cache hit for private_password, got %v", second.Tree["private_password"])
+	}
+	if db, _ := second.Tree["private_db"].(map[string]any); db["user"] != "admin" {
+		t.Errorf("Expected the cached table unchanged, got %v", second.Tree["private_db"])
+	}
+
+	// Re-encrypting produces new armor, which misses
+	rotated, _, err := Save(tree, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	third, err := Load(rotated, Options{DecryptCache: cache})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if summary := third.Summary(); summary.Undecryptable != 2 {
+		t.Errorf("Expected rotated ciphertext to miss the cache, got %+v", summary)
+	}
+
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Errorf("Expected Clear to empty the cache, got %d entries", cache.Len())
+	}
+}
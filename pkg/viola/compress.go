@@ -0,0 +1,64 @@
+package viola
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Header bytes marking a plaintext envelope written with Options.Compress.
+// Neither byte can start valid UTF-8, so they never collide with the
+// unenveloped plaintext of older files, which is always a string or JSON.
+const (
+	envelopeStored byte = 0xFE
+	envelopeGzip   byte = 0xFF
+)
+
+// sealEnvelope gzips plaintext if that makes it smaller, and prefixes the
+// header byte recording which form was kept
+func sealEnvelope(plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(envelopeGzip)
+
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() < len(plaintext)+1 {
+		return buf.Bytes(), nil
+	}
+	return append([]byte{envelopeStored}, plaintext...), nil
+}
+
+// openEnvelope returns the plaintext inside decrypted, which is returned
+// unchanged if it has no envelope header
+func openEnvelope(decrypted []byte) ([]byte, error) {
+	if len(decrypted) == 0 {
+		return decrypted, nil
+	}
+
+	switch decrypted[0] {
+	case envelopeStored:
+		return decrypted[1:], nil
+	case envelopeGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(decrypted[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		plaintext, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		return plaintext, nil
+	default:
+		return decrypted, nil
+	}
+}
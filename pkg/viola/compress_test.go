@@ -0,0 +1,109 @@
+package viola
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		header byte
+	}{
+		{"compressible", []byte(strings.Repeat(`{"key":"value"},`, 100)), envelopeGzip},
+		{"small", []byte("pw"), envelopeStored},
+		{"empty", []byte{}, envelopeStored},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := sealEnvelope(tt.data)
+			if err != nil {
+				t.Fatalf("sealEnvelope failed: %v", err)
+			}
+			if sealed[0] != tt.header {
+				t.Errorf("Expected header %#x, got %#x", tt.header, sealed[0])
+			}
+			if tt.header == envelopeGzip && len(sealed) >= len(tt.data) {
+				t.Errorf("Expected compression to shrink %d bytes, got %d", len(tt.data), len(sealed))
+			}
+
+			opened, err := openEnvelope(sealed)
+			if err != nil {
+				t.Fatalf("openEnvelope failed: %v", err)
+			}
+			if !bytes.Equal(opened, tt.data) {
+				t.Errorf("Expected %q, got %q", tt.data, opened)
+			}
+		})
+	}
+
+	// Plaintext from before envelopes existed is returned unchanged
+	legacy := []byte(`{"a":1}`)
+	if opened, err := openEnvelope(legacy); err != nil || !bytes.Equal(opened, legacy) {
+		t.Errorf("Expected legacy plaintext unchanged, got %q (%v)", opened, err)
+	}
+
+	if _, err := openEnvelope([]byte{envelopeGzip, 'x'}); err == nil {
+		t.Error("Expected an error for corrupt compressed data")
+	}
+}
+
+func TestSaveCompress(t *testing.T) {
+	blob := strings.Repeat(`{"id":1,"name":"example","enabled":true},`, 200)
+	tree := map[string]any{
+		"private_blob":     blob,
+		"private_password": "hunter2",
+	}
+	keys := enc.KeySources{
+		Recipients:     []string{testkeys.TestRecipient1},
+		IdentitiesData: []string{testkeys.TestIdentity1},
+	}
+
+	plain, plainFields, err := Save(tree, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	compressed, compressedFields, err := Save(tree, Options{Keys: keys, Compress: true})
+	if err != nil {
+		t.Fatalf("Save with Compress failed: %v", err)
+	}
+
+	if len(compressed) >= len(plain)/2 {
+		t.Errorf("Expected compressed output to be much smaller: %d vs %d bytes", len(compressed), len(plain))
+	}
+	if len(compressedFields) != len(plainFields) {
+		t.Errorf("Expected %d fields, got %d", len(plainFields), len(compressedFields))
+	}
+
+	result, err := Load(compressed, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if result.Tree["private_blob"] != blob {
+		t.Error("Expected the compressed blob to round-trip")
+	}
+	if result.Tree["private_password"] != "hunter2" {
+		t.Errorf("Expected the small value to round-trip, got %v", result.Tree["private_password"])
+	}
+
+	// Unchanged values are reused from a compressed previous file
+	previous, err := Load(compressed, Options{})
+	if err != nil {
+		t.Fatalf("Load without keys failed: %v", err)
+	}
+	_, reusedFields, err := Save(tree, Options{Keys: keys, Compress: true, PreviousTree: previous.Tree})
+	if err != nil {
+		t.Fatalf("Save with PreviousTree failed: %v", err)
+	}
+	for _, field := range reusedFields {
+		if field.Armored != previous.Tree[field.Path[0]] {
+			t.Errorf("Expected %v to reuse its previous ciphertext", field.Path)
+		}
+	}
+}
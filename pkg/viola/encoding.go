@@ -0,0 +1,131 @@
+package viola
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FieldEncoding selects how Save serializes non-string values before
+// encryption. Strings, datetimes, and []byte are encoded the same way with
+// every FieldEncoding.
+type FieldEncoding string
+
+const (
+	// FieldEncodingJSON serializes values as JSON behind a tag that keeps
+	// integers and floats apart, so Load returns int64 and float64 as TOML
+	// does. This is the default.
+	FieldEncodingJSON FieldEncoding = "json"
+
+	// FieldEncodingGob serializes values with encoding/gob, which keeps Go
+	// types: integers come back as int64 (or whatever integer type was saved).
+	// Files written this way need a viola that knows the codec to load.
+	FieldEncodingGob FieldEncoding = "gob"
+)
+
+// gobTag starts the plaintext of a value encoded with FieldEncodingGob. Like
+// bytesTag, it can't start valid UTF-8, so it never collides with string or
+// JSON plaintext.
+const gobTag byte = 0xFC
+
+// gobValue wraps a value so gob records its concrete type
+type gobValue struct {
+	V any
+}
+
+// gobTable stands in for a table inside gob plaintext. Its keys are sorted,
+// so the same table always encodes to the same bytes (which PreviousTree
+// relies on); a map's order would vary from run to run.
+type gobTable struct {
+	Keys   []string
+	Values []any
+}
+
+func init() {
+	gob.RegisterName("viola.table", gobTable{})
+	gob.RegisterName("viola.array", []any{})
+	gob.RegisterName("time.Time", time.Time{})
+}
+
+// validFieldEncoding reports an error for an unknown FieldEncoding
+func validFieldEncoding(encoding FieldEncoding) error {
+	switch encoding {
+	case "", FieldEncodingJSON, FieldEncodingGob:
+		return nil
+	default:
+		return fmt.Errorf("unknown field encoding %q (expected %q or %q)", encoding, FieldEncodingJSON, FieldEncodingGob)
+	}
+}
+
+// encodeGob serializes value with gob, behind gobTag
+func encodeGob(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(gobTag)
+	if err := gob.NewEncoder(&buf).Encode(gobValue{V: toGob(value)}); err != nil {
+		return nil, fmt.Errorf("failed to gob-encode value: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeGob deserializes plaintext written by encodeGob, without the tag
+func decodeGob(data []byte) (any, error) {
+	var wrapped gobValue
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&wrapped); err != nil {
+		return nil, fmt.Errorf("failed to gob-decode value: %w", err)
+	}
+	return fromGob(wrapped.V), nil
+}
+
+// toGob replaces the tables in value with gobTable, and arrays of tables with
+// []any, so gob can encode them through interface fields
+func toGob(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		table := gobTable{Keys: make([]string, 0, len(v))}
+		for key := range v {
+			table.Keys = append(table.Keys, key)
+		}
+		sort.Strings(table.Keys)
+		for _, key := range table.Keys {
+			table.Values = append(table.Values, toGob(v[key]))
+		}
+		return table
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = toGob(item)
+		}
+		return items
+	case []map[string]any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = toGob(item)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// fromGob turns the gobTable values in value back into tables
+func fromGob(value any) any {
+	switch v := value.(type) {
+	case gobTable:
+		table := make(map[string]any, len(v.Keys))
+		for i, key := range v.Keys {
+			if i < len(v.Values) {
+				table[key] = fromGob(v.Values[i])
+			}
+		}
+		return table
+	case []any:
+		for i, item := range v {
+			v[i] = fromGob(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
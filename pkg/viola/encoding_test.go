@@ -0,0 +1,136 @@
+package viola
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestFieldEncodingGob(t *testing.T) {
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		FieldEncoding: FieldEncodingGob,
+	}
+
+	tree := map[string]any{
+		"private_port":  int64(8080),
+		"private_ratio": 0.5,
+		"private_flag":  true,
+		"private_name":  "hunter2",
+		"private_limits": map[string]any{
+			"max":   int64(100),
+			"hosts": []any{"a", "b"},
+			"nested": []map[string]any{
+				{"id": int64(1)},
+			},
+		},
+	}
+
+	data, _, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	// Load needs no FieldEncoding: the codec is recorded in the ciphertext
+	result, err := Load(data, Options{Keys: opts.Keys})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	expected := map[string]any{
+		"private_port":  int64(8080),
+		"private_ratio": 0.5,
+		"private_flag":  true,
+		"private_name":  "hunter2",
+		"private_limits": map[string]any{
+			"max":    int64(100),
+			"hosts":  []any{"a", "b"},
+			"nested": []any{map[string]any{"id": int64(1)}},
+		},
+	}
+	if !reflect.DeepEqual(result.Tree, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, result.Tree)
+	}
+
+	// Tables encode to the same bytes every time, whatever the map order
+	first, err := encodeValue(tree["private_limits"], FieldEncodingGob)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := encodeValue(tree["private_limits"], FieldEncodingGob)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatal("Expected gob encoding of a table to be deterministic")
+		}
+	}
+
+	opts.FieldEncoding = "xml"
+	if _, _, err := Save(tree, opts); err == nil {
+		t.Error("Expected an unknown field encoding to be rejected")
+	}
+}
+
+func TestFieldEncodingDefaultJSON(t *testing.T) {
+	// Without FieldEncoding, values go through JSON, and a tag keeps integers
+	// and floats apart, even inside a table and for whole-number floats
+	opts := Options{Keys: enc.KeySources{
+		Recipients:     []string{testkeys.TestRecipient1},
+		IdentitiesData: []string{testkeys.TestIdentity1},
+	}}
+	data, _, err := Save(map[string]any{
+		"private_port":   int64(8080),
+		"private_ratio":  1.0,
+		"private_limits": map[string]any{"max": int64(10), "scale": 2.5, "sizes": []any{int64(1), 1e21}},
+	}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	result, err := Load(data, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if port, ok := result.Tree["private_port"].(int64); !ok || port != 8080 {
+		t.Errorf("Expected int64 8080 from the JSON encoding, got %#v", result.Tree["private_port"])
+	}
+	if ratio, ok := result.Tree["private_ratio"].(float64); !ok || ratio != 1 {
+		t.Errorf("Expected float64 1 from the JSON encoding, got %#v", result.Tree["private_ratio"])
+	}
+	want := map[string]any{"max": int64(10), "scale": 2.5, "sizes": []any{int64(1), 1e21}}
+	if !reflect.DeepEqual(result.Tree["private_limits"], want) {
+		t.Errorf("Expected %#v inside the table, got %#v", want, result.Tree["private_limits"])
+	}
+	for _, field := range result.Fields {
+		if strings.Join(field.Path, ".") == "private_port" && field.Type != "int64" {
+			t.Errorf("Expected FieldMeta.Type int64, got %q", field.Type)
+		}
+		if field.TypeGuessed {
+			t.Errorf("Expected no guessed types for tagged plaintext, got one for %v", field.Path)
+		}
+	}
+
+	// Untagged JSON, as written before the tag, still decodes numbers as float64
+	if port, ok := decodeValue([]byte("8080")).(float64); !ok || port != 8080 {
+		t.Errorf("Expected untagged JSON to decode as float64, got %#v", decodeValue([]byte("8080")))
+	}
+	if !typeGuessed([]byte("8080"), decodeValue([]byte("8080"))) {
+		t.Error("Expected the type of untagged JSON to be a guess")
+	}
+	if typeGuessed([]byte("secret"), decodeValue([]byte("secret"))) {
+		t.Error("Expected an untagged string not to be a guess")
+	}
+
+	if _, err := encodeValue(math.NaN(), FieldEncodingJSON); err == nil {
+		t.Error("Expected NaN to be rejected by the JSON encoding")
+	}
+}
@@ -0,0 +1,116 @@
+package viola
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// LoadWithEnvOverrides loads and decrypts a configuration like Load, then
+// overlays values from environment variables.
+//
+// Each scalar field has an environment variable name formed from the prefix
+// and its path: segments are upper-cased and joined with underscores, and
+// array indices contribute their number. With prefix "APP", the field
+// db.private_password is overridden by APP_DB_PRIVATE_PASSWORD and
+// servers[0].host by APP_SERVERS_0_HOST. With an empty prefix the name is
+// just the path (DB_PRIVATE_PASSWORD).
+//
+// Only fields that already exist can be overridden, which keeps the mapping
+// unambiguous even though keys may contain underscores. The override is
+// coerced to the type of the value it replaces (int, float, bool, datetime,
+// or string) and is always taken as plaintext, never decrypted.
+func LoadWithEnvOverrides(data []byte, opts Options, prefix string) (*Result, error) {
+	// Variable names follow the original keys, so rename only after overriding
+	keyTransform := opts.KeyTransform
+	opts.KeyTransform = nil
+
+	result, err := Load(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyEnvOverrides(result.Tree, prefix, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if keyTransform != nil {
+		result.Tree, err = TransformKeys(result.Tree, keyTransform)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// EnvName returns the environment variable name that overrides the field at path
+func EnvName(prefix string, path []string) string {
+	parts := make([]string, 0, len(path)+1)
+	if prefix != "" {
+		parts = append(parts, strings.ToUpper(prefix))
+	}
+	for _, segment := range path {
+		segment = strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]")
+		parts = append(parts, strings.ToUpper(segment))
+	}
+	return strings.Join(parts, "_")
+}
+
+// applyEnvOverrides replaces scalar values in tree with matching environment values
+func applyEnvOverrides(tree map[string]any, prefix string, lookup func(string) (string, bool)) error {
+	// Collect scalar leaves first; the tree is modified afterwards
+	var leaves [][]string
+	walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+		if key != "" && walk.IsScalarValue(value) {
+			leaves = append(leaves, append(append([]string{}, path...), key))
+		}
+		return value, true
+	})
+
+	claimed := make(map[string][]string)
+	for _, leaf := range leaves {
+		name := EnvName(prefix, leaf)
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		if other, exists := claimed[name]; exists {
+			return fmt.Errorf("environment variable %s matches both %s and %s", name, strings.Join(other, "."), strings.Join(leaf, "."))
+		}
+		claimed[name] = leaf
+
+		current, _ := walk.GetValue(tree, leaf)
+		value, err := coerceEnvValue(raw, current)
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		walk.SetValue(tree, leaf, value)
+	}
+
+	return nil
+}
+
+// coerceEnvValue converts an environment value to the type of the value it replaces
+func coerceEnvValue(raw string, current any) (any, error) {
+	switch current.(type) {
+	case int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case int:
+		v, err := strconv.Atoi(raw)
+		return v, err
+	case float64:
+		return strconv.ParseFloat(raw, 64)
+	case bool:
+		return strconv.ParseBool(raw)
+	case time.Time:
+		return time.Parse(time.RFC3339, raw)
+	default:
+		return raw, nil
+	}
+}
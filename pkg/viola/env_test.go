@@ -0,0 +1,117 @@
+package viola
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestLoadWithEnvOverrides(t *testing.T) {
+	testData := map[string]any{
+		"username": "alice",
+		"db": map[string]any{
+			"port":             5432,
+			"ssl":              false,
+			"private_password": "secret123",
+		},
+		"servers": []any{
+			map[string]any{"host": "prod.example.com"},
+		},
+	}
+
+	encryptedTOML, _, err := Save(testData, Options{
+		Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save test data: %v", err)
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity1}},
+	}
+
+	t.Run("overrides nested values with coercion", func(t *testing.T) {
+		t.Setenv("APP_DB_PRIVATE_PASSWORD", "from-env")
+		t.Setenv("APP_DB_PORT", "6543")
+		t.Setenv("APP_DB_SSL", "true")
+		t.Setenv("APP_SERVERS_0_HOST", "staging.example.com")
+		t.Setenv("APP_DB_UNKNOWN", "ignored")
+
+		result, err := LoadWithEnvOverrides(encryptedTOML, opts, "APP")
+		if err != nil {
+			t.Fatalf("Failed to load with overrides: %v", err)
+		}
+
+		db := result.Tree["db"].(map[string]any)
+		if db["private_password"] != "from-env" {
+			t.Errorf("Expected private_password=from-env, got %v", db["private_password"])
+		}
+		if db["port"] != int64(6543) {
+			t.Errorf("Expected port=6543 (int64), got %#v", db["port"])
+		}
+		if db["ssl"] != true {
+			t.Errorf("Expected ssl=true, got %#v", db["ssl"])
+		}
+		if _, exists := db["unknown"]; exists {
+			t.Error("Expected unknown env var not to add a field")
+		}
+
+		server := result.Tree["servers"].([]any)[0].(map[string]any)
+		if server["host"] != "staging.example.com" {
+			t.Errorf("Expected servers[0].host override, got %v", server["host"])
+		}
+
+		if result.Tree["username"] != "alice" {
+			t.Errorf("Expected username to be untouched, got %v", result.Tree["username"])
+		}
+	})
+
+	t.Run("armored override is kept as plaintext", func(t *testing.T) {
+		armored, err := testkeys.EncryptTestData([]byte("nope"))
+		if err != nil {
+			t.Fatalf("Failed to encrypt test data: %v", err)
+		}
+		t.Setenv("DB_PRIVATE_PASSWORD", armored)
+
+		result, err := LoadWithEnvOverrides(encryptedTOML, opts, "")
+		if err != nil {
+			t.Fatalf("Failed to load with overrides: %v", err)
+		}
+
+		if result.Tree["db"].(map[string]any)["private_password"] != armored {
+			t.Error("Expected armored override to be used verbatim")
+		}
+	})
+
+	t.Run("invalid coercion", func(t *testing.T) {
+		t.Setenv("APP_DB_PORT", "not-a-number")
+
+		_, err := LoadWithEnvOverrides(encryptedTOML, opts, "APP")
+		if err == nil {
+			t.Fatal("Expected error for non-numeric port override")
+		}
+		if !strings.Contains(err.Error(), "APP_DB_PORT") {
+			t.Errorf("Expected error to name the variable, got: %v", err)
+		}
+	})
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		path     []string
+		expected string
+	}{
+		{"APP", []string{"db", "private_password"}, "APP_DB_PRIVATE_PASSWORD"},
+		{"app", []string{"servers", "[0]", "host"}, "APP_SERVERS_0_HOST"},
+		{"", []string{"db", "private_password"}, "DB_PRIVATE_PASSWORD"},
+	}
+
+	for _, tt := range tests {
+		if got := EnvName(tt.prefix, tt.path); got != tt.expected {
+			t.Errorf("EnvName(%q, %v) = %s, expected %s", tt.prefix, tt.path, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package viola
+
+import (
+	"math"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// Get returns the value at a dotted path in the decrypted tree, such as
+// "database.private_password" or "servers[0].name"
+func (r *Result) Get(path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	return walk.GetValue(r.Tree, walk.ParsePath(path))
+}
+
+// GetString returns the string at path. It reports false if the path is
+// missing or holds another type.
+func (r *Result) GetString(path string) (string, bool) {
+	value, ok := r.Get(path)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+// GetInt returns the integer at path. Whole-number floats are accepted,
+// since numbers in fields encrypted before jsonTag come back as float64.
+func (r *Result) GetInt(path string) (int64, bool) {
+	value, ok := r.Get(path)
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+// GetBool returns the boolean at path. It reports false if the path is
+// missing or holds another type.
+func (r *Result) GetBool(path string) (bool, bool) {
+	value, ok := r.Get(path)
+	if !ok {
+		return false, false
+	}
+	b, ok := value.(bool)
+	return b, ok
+}
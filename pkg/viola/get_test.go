@@ -0,0 +1,86 @@
+package viola
+
+import (
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestResultGet(t *testing.T) {
+	input := []byte(`
+name = "myapp"
+port = 8080
+private_debug = true
+
+[database]
+private_password = "hunter2"
+
+[private_limits]
+max_connections = 100
+
+[[servers]]
+name = "prod"
+
+[[servers]]
+name = "staging"
+`)
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	plain, err := Load(input, Options{})
+	if err != nil {
+		t.Fatalf("Failed to load plaintext: %v", err)
+	}
+	data, _, err := Save(plain.Tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	result, err := Load(data, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if s, ok := result.GetString("database.private_password"); !ok || s != "hunter2" {
+		t.Errorf("GetString: expected hunter2, got %q, %v", s, ok)
+	}
+	if s, ok := result.GetString("servers[1].name"); !ok || s != "staging" {
+		t.Errorf("GetString: expected staging, got %q, %v", s, ok)
+	}
+	if n, ok := result.GetInt("port"); !ok || n != 8080 {
+		t.Errorf("GetInt: expected 8080, got %d, %v", n, ok)
+	}
+	if n, ok := result.GetInt("private_limits.max_connections"); !ok || n != 100 {
+		t.Errorf("GetInt: expected 100 from a decrypted table, got %d, %v", n, ok)
+	}
+	if b, ok := result.GetBool("private_debug"); !ok || !b {
+		t.Errorf("GetBool: expected true, got %v, %v", b, ok)
+	}
+	if value, ok := result.Get("database"); !ok {
+		t.Error("Get: expected database table")
+	} else if _, isMap := value.(map[string]any); !isMap {
+		t.Errorf("Get: expected a table, got %T", value)
+	}
+
+	misses := []struct {
+		name string
+		get  func() bool
+	}{
+		{"missing path", func() bool { _, ok := result.Get("database.missing"); return ok }},
+		{"empty path", func() bool { _, ok := result.Get(""); return ok }},
+		{"index out of range", func() bool { _, ok := result.GetString("servers[5].name"); return ok }},
+		{"string as int", func() bool { _, ok := result.GetInt("name"); return ok }},
+		{"int as string", func() bool { _, ok := result.GetString("port"); return ok }},
+		{"table as bool", func() bool { _, ok := result.GetBool("database"); return ok }},
+	}
+	for _, miss := range misses {
+		if miss.get() {
+			t.Errorf("%s: expected not found", miss.name)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package viola
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// FindInlineTables returns the paths of the tables written inline ({ a = 1 })
+// in the TOML document data, in the string form used by walk (array elements
+// as "[0]"), e.g. [["servers", "[0]"], ["database", "pool"]]. Tables nested in
+// an inline table are inline too and are not listed separately. data is
+// assumed to be valid TOML; parse it first.
+func FindInlineTables(data []byte) [][]string {
+	s := &inlineScanner{src: data, arrays: make(map[string]int)}
+	s.scan()
+	return s.paths
+}
+
+// inlineTable is a table Save writes inline. It implements toml.Marshaler, so
+// the encoder writes it as a value instead of a [table] block.
+type inlineTable map[string]any
+
+// MarshalTOML renders the table as {key = value, ...} with sorted keys, the
+// way the encoder writes tables inside arrays
+func (t inlineTable) MarshalTOML() ([]byte, error) {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		if t[key] != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		keyText, err := tomlKey(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := inlineValue(t[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(keyText + " = ")
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// inlineValue renders a value inside an inline table, where nested tables
+// must be inline as well
+func inlineValue(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case inlineTable:
+		return v.MarshalTOML()
+	case map[string]any:
+		return inlineTable(v).MarshalTOML()
+	case []map[string]any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return inlineValue(items)
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			part, err := inlineValue(item)
+			if err != nil {
+				return nil, err
+			}
+			parts[i] = string(part)
+		}
+		return []byte("[" + strings.Join(parts, ", ") + "]"), nil
+	}
+
+	data, err := tomlMarshal(map[string]any{"v": value})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(bytes.TrimPrefix(data, []byte("v = "))), nil
+}
+
+// tomlKey returns key as the encoder writes it, quoted if it isn't bare
+func tomlKey(key string) (string, error) {
+	data, err := tomlMarshal(map[string]any{key: 0})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSpace(string(data)), " = 0"), nil
+}
+
+// markInlineTables replaces the tables at paths in tree with inlineTable, so
+// tomlMarshal writes them inline. Paths that no longer hold a table (e.g.
+// because the table was encrypted as a whole) are skipped. tree is modified.
+func markInlineTables(tree map[string]any, paths [][]string) {
+	// Innermost first, so the outer tables are still plain maps to walk through
+	sorted := append([][]string(nil), paths...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, path := range sorted {
+		if len(path) == 0 {
+			continue
+		}
+		if table, ok := walk.GetValue(tree, path); ok {
+			if m, isMap := table.(map[string]any); isMap {
+				walk.SetValue(tree, path, inlineTable(m))
+			}
+		}
+	}
+}
+
+// inlineScanner finds inline tables in a TOML document. It only tracks what
+// it needs for that: table headers, keys, and where values start and end.
+type inlineScanner struct {
+	src    []byte
+	pos    int
+	paths  [][]string
+	arrays map[string]int // number of elements seen per [[array]] path
+}
+
+func (s *inlineScanner) scan() {
+	var context []string
+	for {
+		s.skipSpace(true)
+		if s.pos >= len(s.src) {
+			return
+		}
+		start := s.pos
+
+		if s.src[s.pos] == '[' {
+			if s.peek(1) == '[' {
+				s.pos += 2
+				key := s.key()
+				if len(key) == 0 {
+					return
+				}
+				path := append(s.resolve(key[:len(key)-1]), key[len(key)-1])
+				s.skipSpace(false)
+				s.pos += 2 // ]]
+				count := s.arrays[strings.Join(path, "\x00")]
+				s.arrays[strings.Join(path, "\x00")] = count + 1
+				context = append(path, fmt.Sprintf("[%d]", count))
+			} else {
+				s.pos++
+				context = s.resolve(s.key())
+				s.skipSpace(false)
+				s.pos++ // ]
+			}
+		} else {
+			key := s.key()
+			s.skipSpace(false)
+			if s.pos < len(s.src) && s.src[s.pos] == '=' {
+				s.pos++
+				s.skipSpace(false)
+				s.value(append(append([]string(nil), context...), key...))
+			}
+		}
+
+		s.skipLine()
+		if s.pos == start {
+			// Not valid TOML; give up rather than loop
+			return
+		}
+	}
+}
+
+// resolve turns a header key into a tree path, addressing the last element
+// of any array of tables along the way
+func (s *inlineScanner) resolve(key []string) []string {
+	var path []string
+	for _, part := range key {
+		path = append(path, part)
+		if count, ok := s.arrays[strings.Join(path, "\x00")]; ok && count > 0 {
+			path = append(path, fmt.Sprintf("[%d]", count-1))
+		}
+	}
+	return path
+}
+
+// key reads a possibly dotted key made of bare and quoted parts
+func (s *inlineScanner) key() []string {
+	var parts []string
+	for {
+		s.skipSpace(false)
+		if s.pos >= len(s.src) {
+			return parts
+		}
+		switch s.src[s.pos] {
+		case '"':
+			start := s.pos
+			s.skipString()
+			part, err := strconv.Unquote(string(s.src[start:s.pos]))
+			if err != nil {
+				part = string(s.src[start+1 : s.pos-1])
+			}
+			parts = append(parts, part)
+		case '\'':
+			start := s.pos
+			s.skipString()
+			parts = append(parts, string(s.src[start+1:s.pos-1]))
+		default:
+			start := s.pos
+			for s.pos < len(s.src) && isBareKeyChar(s.src[s.pos]) {
+				s.pos++
+			}
+			if s.pos == start {
+				return parts
+			}
+			parts = append(parts, string(s.src[start:s.pos]))
+		}
+		s.skipSpace(false)
+		if s.pos >= len(s.src) || s.src[s.pos] != '.' {
+			return parts
+		}
+		s.pos++
+	}
+}
+
+// value skips the value at the current position, recording the paths of the
+// inline tables in it
+func (s *inlineScanner) value(path []string) {
+	if s.pos >= len(s.src) {
+		return
+	}
+	switch s.src[s.pos] {
+	case '{':
+		s.paths = append(s.paths, path)
+		s.pos++
+		for {
+			s.skipSpace(true)
+			if s.pos >= len(s.src) {
+				return
+			}
+			if s.src[s.pos] == '}' {
+				s.pos++
+				return
+			}
+			start := s.pos
+			key := s.key()
+			s.skipSpace(false)
+			if s.pos < len(s.src) && s.src[s.pos] == '=' {
+				s.pos++
+				s.skipSpace(false)
+				s.skipValue(append(append([]string(nil), path...), key...))
+			}
+			s.skipSpace(true)
+			if s.pos < len(s.src) && s.src[s.pos] == ',' {
+				s.pos++
+			} else if s.pos == start {
+				return
+			}
+		}
+	case '[':
+		s.pos++
+		for i := 0; ; i++ {
+			s.skipSpace(true)
+			if s.pos >= len(s.src) {
+				return
+			}
+			if s.src[s.pos] == ']' {
+				s.pos++
+				return
+			}
+			start := s.pos
+			s.value(append(append([]string(nil), path...), fmt.Sprintf("[%d]", i)))
+			s.skipSpace(true)
+			if s.pos < len(s.src) && s.src[s.pos] == ',' {
+				s.pos++
+			} else if s.pos == start {
+				return
+			}
+		}
+	case '"', '\'':
+		s.skipString()
+	default:
+		for s.pos < len(s.src) && !strings.ContainsRune(",]}\r\n#", rune(s.src[s.pos])) {
+			s.pos++
+		}
+	}
+}
+
+// skipValue skips a value nested in an inline table. Its tables are inline
+// too, but are covered by the enclosing table's path.
+func (s *inlineScanner) skipValue(path []string) {
+	recorded := len(s.paths)
+	s.value(path)
+	s.paths = s.paths[:recorded]
+}
+
+// skipString skips a basic, literal, or multi-line string
+func (s *inlineScanner) skipString() {
+	quote := s.src[s.pos]
+	delim := []byte{quote}
+	if s.peek(1) == quote && s.peek(2) == quote {
+		delim = []byte{quote, quote, quote}
+	}
+	s.pos += len(delim)
+	for s.pos < len(s.src) {
+		if quote == '"' && s.src[s.pos] == '\\' {
+			s.pos += 2
+			continue
+		}
+		if bytes.HasPrefix(s.src[s.pos:], delim) {
+			s.pos += len(delim)
+			// A multi-line string may end with up to two extra quotes
+			for len(delim) == 3 && s.pos < len(s.src) && s.src[s.pos] == quote {
+				s.pos++
+			}
+			return
+		}
+		s.pos++
+	}
+}
+
+// skipSpace skips whitespace and comments, and newlines too if multiline is set
+func (s *inlineScanner) skipSpace(multiline bool) {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case c == ' ' || c == '\t':
+			s.pos++
+		case multiline && (c == '\r' || c == '\n'):
+			s.pos++
+		case multiline && c == '#':
+			s.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine moves past the end of the current line
+func (s *inlineScanner) skipLine() {
+	for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+		s.pos++
+	}
+	if s.pos < len(s.src) {
+		s.pos++
+	}
+}
+
+// peek returns the byte n past the current position, or 0 at the end
+func (s *inlineScanner) peek(n int) byte {
+	if s.pos+n < len(s.src) {
+		return s.src[s.pos+n]
+	}
+	return 0
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
@@ -0,0 +1,131 @@
+package viola
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestFindInlineTables(t *testing.T) {
+	input := []byte(`
+name = "x" # { not a table }
+point = { x = 1, y = { z = 2 } }
+"quoted key" = {a = "}"}
+points = [
+  { x = 1 },  # first
+  { x = 2, tags = ["a,b", '{'] },
+]
+text = """
+a = { b = 1 }
+"""
+
+[database]
+pool = {size = 5}
+a.b = { c = 1 }
+
+[[servers]]
+name = "prod"
+limits = { cpu = 2 }
+
+[[servers]]
+name = "staging"
+
+[servers.meta]
+owner = { team = "ops" }
+
+[[servers.ports]]
+range = { from = 1, to = 2 }
+`)
+
+	var tree map[string]any
+	if _, err := toml.Decode(string(input), &tree); err != nil {
+		t.Fatalf("Test input is not valid TOML: %v", err)
+	}
+
+	expected := [][]string{
+		{"point"},
+		{"quoted key"},
+		{"points", "[0]"},
+		{"points", "[1]"},
+		{"database", "pool"},
+		{"database", "a", "b"},
+		{"servers", "[0]", "limits"},
+		{"servers", "[1]", "meta", "owner"},
+		{"servers", "[1]", "ports", "[0]", "range"},
+	}
+	if got := FindInlineTables(input); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestSaveInlineTables(t *testing.T) {
+	input := []byte(`name = "myapp"
+point = {x = 1, y = 2}
+points = [{x = 1}, {private_token = "abc", x = 2}]
+
+[database]
+host = "localhost"
+pool = {max = 10, min = 1}
+`)
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	// Without InlineTables, Save writes every table as a block
+	plain, err := Load(input, Options{})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	blocks, _, err := Save(plain.Tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if strings.Contains(string(blocks), "{") {
+		t.Errorf("Expected block tables without InlineTables:\n%s", blocks)
+	}
+
+	opts.InlineTables = plain.InlineTables
+	encrypted, fields, err := Save(plain.Tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if len(fields) != 1 {
+		t.Fatalf("Expected the field inside the inline table to be encrypted, got %d fields", len(fields))
+	}
+	for _, line := range []string{"point = {x = 1, y = 2}", "pool = {max = 10, min = 1}", "points = [{x = 1}, {private_token = \"-----BEGIN AGE ENCRYPTED FILE-----"} {
+		if !strings.Contains(string(encrypted), line) {
+			t.Errorf("Expected output to contain %q:\n%s", line, encrypted)
+		}
+	}
+	if strings.Contains(string(encrypted), "[[points]]") || strings.Contains(string(encrypted), "[database.pool]") {
+		t.Errorf("Inline tables were written as blocks:\n%s", encrypted)
+	}
+
+	// Transform keeps the layout without being told
+	transformed, _, err := Transform(encrypted, Options{Keys: opts.Keys}, func(tree any) error {
+		tree.(map[string]any)["name"] = "renamed"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	result, err := Load(transformed, opts)
+	if err != nil {
+		t.Fatalf("Failed to load transformed output: %v\n%s", err, transformed)
+	}
+	if !reflect.DeepEqual(result.InlineTables, plain.InlineTables) {
+		t.Errorf("Expected inline tables %v after Transform, got %v\n%s", plain.InlineTables, result.InlineTables, transformed)
+	}
+	if token, ok := result.GetString("points[1].private_token"); !ok || token != "abc" {
+		t.Errorf("Expected the encrypted field in the inline table to decrypt, got %q, %v", token, ok)
+	}
+}
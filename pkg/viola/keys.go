@@ -0,0 +1,89 @@
+package viola
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TransformKeys returns a copy of tree with every table key replaced by
+// transform(path, key), where path holds the original keys leading to the
+// table ("[0]", "[1]", ... for array elements, as in walk.Walk). Values are
+// not changed. It is an error for two keys in one table to map to the same
+// name, or for a key to map to "".
+func TransformKeys(tree map[string]any, transform func(path []string, key string) string) (map[string]any, error) {
+	result, err := transformKeys(nil, tree, transform)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]any), nil
+}
+
+func transformKeys(path []string, value any, transform func(path []string, key string) string) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		// Visit keys in order so collision errors are deterministic
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		result := make(map[string]any, len(v))
+		sources := make(map[string]string, len(v))
+		for _, key := range keys {
+			newKey := transform(path, key)
+			if newKey == "" {
+				return nil, fmt.Errorf("key transform produced an empty name for %s", dottedPath(path, key))
+			}
+			if other, exists := sources[newKey]; exists {
+				return nil, fmt.Errorf("key transform maps both %s and %s to %q", dottedPath(path, other), dottedPath(path, key), newKey)
+			}
+			sources[newKey] = key
+
+			child, err := transformKeys(append(path[:len(path):len(path)], key), v[key], transform)
+			if err != nil {
+				return nil, err
+			}
+			result[newKey] = child
+		}
+		return result, nil
+
+	case []map[string]any:
+		elements := make([]any, len(v))
+		for i, table := range v {
+			elements[i] = table
+		}
+		return transformKeys(path, elements, transform)
+
+	case []any:
+		result := make([]any, len(v))
+		for i, element := range v {
+			child, err := transformKeys(append(path[:len(path):len(path)], fmt.Sprintf("[%d]", i)), element, transform)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = child
+		}
+		return result, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// StripKeyPrefix returns a key transform that removes prefix from keys that
+// start with it, e.g. for rendering private_db_password as db_password
+func StripKeyPrefix(prefix string) func(path []string, key string) string {
+	return func(path []string, key string) string {
+		if stripped := strings.TrimPrefix(key, prefix); stripped != "" {
+			return stripped
+		}
+		return key
+	}
+}
+
+// dottedPath joins path and key for error messages
+func dottedPath(path []string, key string) string {
+	return strings.Join(append(path[:len(path):len(path)], key), ".")
+}
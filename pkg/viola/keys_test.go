@@ -0,0 +1,117 @@
+package viola
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestTransformKeys(t *testing.T) {
+	tree := map[string]any{
+		"private_token": "abc",
+		"database": map[string]any{
+			"private_password": "secret",
+			"host":             "localhost",
+		},
+		"servers": []map[string]any{
+			{"name": "prod", "private_api_key": "key"},
+		},
+	}
+
+	var paths []string
+	result, err := TransformKeys(tree, func(path []string, key string) string {
+		paths = append(paths, strings.Join(append(path, key), "."))
+		return StripKeyPrefix("private_")(path, key)
+	})
+	if err != nil {
+		t.Fatalf("Failed to transform keys: %v", err)
+	}
+
+	expected := map[string]any{
+		"token": "abc",
+		"database": map[string]any{
+			"password": "secret",
+			"host":     "localhost",
+		},
+		"servers": []any{
+			map[string]any{"name": "prod", "api_key": "key"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	// The transform sees original keys in paths
+	found := false
+	for _, path := range paths {
+		if path == "servers.[0].private_api_key" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected transform to be called with servers.[0].private_api_key, got %v", paths)
+	}
+
+	// The input is left untouched
+	if _, ok := tree["private_token"]; !ok {
+		t.Error("Expected the original tree to keep its keys")
+	}
+
+	t.Run("collision", func(t *testing.T) {
+		_, err := TransformKeys(map[string]any{"password": "a", "private_password": "b"}, StripKeyPrefix("private_"))
+		if err == nil || !strings.Contains(err.Error(), `"password"`) {
+			t.Errorf("Expected collision error, got %v", err)
+		}
+	})
+
+	t.Run("empty key", func(t *testing.T) {
+		if got := StripKeyPrefix("private_")(nil, "private_"); got != "private_" {
+			t.Errorf("Expected a bare prefix to be kept, got %q", got)
+		}
+		_, err := TransformKeys(map[string]any{"a": 1}, func(path []string, key string) string { return "" })
+		if err == nil {
+			t.Error("Expected error for an empty key")
+		}
+	})
+}
+
+func TestLoadKeyTransform(t *testing.T) {
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		KeyTransform: StripKeyPrefix("private_"),
+	}
+
+	tomlData, _, err := Save(map[string]any{"private_db_password": "secret"}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if !strings.Contains(string(tomlData), "private_db_password") {
+		t.Error("Expected Save to ignore KeyTransform")
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if result.Tree["db_password"] != "secret" {
+		t.Errorf("Expected db_password=secret, got %v", result.Tree)
+	}
+	if got := strings.Join(result.Fields[0].Path, "."); got != "private_db_password" {
+		t.Errorf("Expected field metadata to keep the original path, got %s", got)
+	}
+
+	// Transform must save the original keys back, still encrypted
+	output, fields, err := Transform(tomlData, opts, func(tree any) error { return nil })
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if len(fields) != 1 || !strings.Contains(string(output), "private_db_password") {
+		t.Errorf("Expected Transform to keep private_db_password encrypted, got:\n%s", output)
+	}
+}
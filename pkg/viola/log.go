@@ -0,0 +1,29 @@
+package viola
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+// logField records a per-field event on opts.Logger, if set. Events carry the
+// field's dotted path and the given attributes, never its value.
+func (o Options) logField(level slog.Level, msg string, path []string, attrs ...slog.Attr) {
+	if o.Logger == nil {
+		return
+	}
+	attrs = append([]slog.Attr{slog.String("path", strings.Join(path, "."))}, attrs...)
+	o.Logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// armorRecipientCount returns the number of recipient stanzas in an armored
+// block's header, or -1 if the header can't be parsed
+func armorRecipientCount(armored string) int {
+	header, err := enc.ParseHeader(armored)
+	if err != nil {
+		return -1
+	}
+	return len(header.Stanzas)
+}
@@ -0,0 +1,91 @@
+package viola
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1, testkeys.TestRecipient2},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		Logger: logger,
+	}
+
+	data, _, err := Save(map[string]any{
+		"name":     "myapp",
+		"database": map[string]any{"private_password": "hunter2"},
+	}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if _, err := Load(data, opts); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	// A key that can't decrypt the field is logged as a warning
+	if _, err := Load(data, Options{
+		Keys:   enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity3}},
+		Logger: logger,
+	}); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("Log contains a secret value:\n%s", buf.String())
+	}
+
+	type event struct {
+		Level      string
+		Msg        string
+		Path       string
+		Recipients int
+		Error      string
+	}
+	var events []event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record struct {
+			Level      string `json:"level"`
+			Msg        string `json:"msg"`
+			Path       string `json:"path"`
+			Recipients int    `json:"recipients"`
+			Error      string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", line, err)
+		}
+		events = append(events, event(record))
+	}
+
+	expected := []event{
+		{Level: "DEBUG", Msg: "field encrypted", Path: "database.private_password", Recipients: 2},
+		{Level: "DEBUG", Msg: "field decrypted", Path: "database.private_password", Recipients: 2},
+		{Level: "WARN", Msg: "field not decrypted", Path: "database.private_password"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, want := range expected {
+		got := events[i]
+		if want.Level == "WARN" {
+			if got.Error == "" {
+				t.Errorf("Event %d: expected an error attribute", i)
+			}
+			got.Error = ""
+		}
+		if got != want {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package viola
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+// fieldRandom is a deterministic stream for one field: SHA-256 of the seed,
+// the field path, and a counter. Deriving it per field keeps Save's output
+// independent of the order the walk visits fields in.
+type fieldRandom struct {
+	seed    []byte
+	path    string
+	counter uint64
+	buf     []byte
+}
+
+func (r *fieldRandom) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			h := sha256.New()
+			h.Write(r.seed)
+			h.Write([]byte(r.path))
+			binary.Write(h, binary.BigEndian, r.counter)
+			r.counter++
+			r.buf = h.Sum(nil)
+		}
+		copied := copy(p[n:], r.buf)
+		r.buf = r.buf[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+// useFieldRandom makes Save's ciphertext reproducible for the rest of the
+// test: each field is encrypted with crypto/rand.Reader replaced by its
+// fieldRandom stream. age takes no randomness parameter, so the replacement
+// is process-wide; tests using it must not run in parallel.
+func useFieldRandom(t *testing.T, seed []byte) {
+	t.Helper()
+
+	saved := encryptField
+	t.Cleanup(func() { encryptField = saved })
+	encryptField = func(data []byte, recipients []age.Recipient, path []string) (string, error) {
+		reader := rand.Reader
+		rand.Reader = &fieldRandom{seed: seed, path: strings.Join(path, "\x00")}
+		defer func() { rand.Reader = reader }()
+		return enc.Encrypt(data, recipients)
+	}
+}
+
+func TestSaveReproducible(t *testing.T) {
+	tree := map[string]any{
+		"private_password": "secret",
+		"db":               map[string]any{"private_token": "tok", "port": int64(5432)},
+		"private_hosts":    []any{"a", "b"},
+	}
+	save := func(seed byte) []byte {
+		useFieldRandom(t, bytes.Repeat([]byte{seed}, 32))
+		encrypted, _, err := Save(tree, Options{
+			Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1, testkeys.TestRecipient2}},
+		})
+		if err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		return encrypted
+	}
+
+	golden := save(1)
+	for i := 0; i < 5; i++ {
+		if !bytes.Equal(save(1), golden) {
+			t.Fatal("Expected byte-identical output from the same Rand")
+		}
+	}
+	if bytes.Equal(save(2), golden) {
+		t.Error("Expected a different seed to change the output")
+	}
+
+	result, err := Load(golden, Options{Keys: enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity1}}})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if result.Tree["private_password"] != "secret" {
+		t.Errorf("Expected the reproducible output to decrypt, got %v", result.Tree)
+	}
+}
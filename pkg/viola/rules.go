@@ -0,0 +1,289 @@
+package viola
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	pathpkg "path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// The constructors below build predicates for Options.ShouldEncrypt. Keys of
+// array elements are reported as "[0]", "[1]", and so on, as in walk.Walk.
+
+// EncryptByPrefix matches fields whose key starts with prefix
+func EncryptByPrefix(prefix string) func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		return strings.HasPrefix(key, prefix)
+	}
+}
+
+// EncryptBySuffix matches fields whose key ends with suffix
+func EncryptBySuffix(suffix string) func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		return strings.HasSuffix(key, suffix)
+	}
+}
+
+// EncryptByMinSize matches values of at least n bytes: the bytes of a string
+// or []byte, the TOML literal of a datetime, and the JSON of other leaves.
+// Tables and arrays never match, so a size rule encrypts large leaves rather
+// than whole subtrees.
+func EncryptByMinSize(n int) func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		var size int
+		switch v := value.(type) {
+		case map[string]any, []any, []map[string]any:
+			return false
+		case string:
+			size = len(v)
+		case []byte:
+			size = len(v)
+		case time.Time:
+			literal, err := formatTOMLDatetime(v)
+			if err != nil {
+				return false
+			}
+			size = len(literal)
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return false
+			}
+			size = len(data)
+		}
+		return size >= n
+	}
+}
+
+// EncryptByKeyRegex matches fields whose key matches re
+func EncryptByKeyRegex(re *regexp.Regexp) func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		return re.MatchString(key)
+	}
+}
+
+// EncryptByPath matches fields at exactly the given dotted paths. Array
+// indices may be written either way: "servers[0].api_key" or "servers.[0].api_key".
+func EncryptByPath(paths ...string) func(path []string, key string, value any) bool {
+	normalized := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		normalized[strings.Join(walk.ParsePath(p), ".")] = true
+	}
+
+	return func(path []string, key string, value any) bool {
+		fullPath := make([]string, 0, len(path)+1)
+		fullPath = append(append(fullPath, path...), key)
+		return normalized[strings.Join(fullPath, ".")]
+	}
+}
+
+// EncryptByPathGlob matches fields whose dotted path matches one of the
+// patterns. Within a segment, * and ? work as in path.Match ("api_*"); a
+// segment of just * or [*] matches any one key or array index, and ** matches
+// any number of segments, so "services.*.token" and "**.password" both work.
+func EncryptByPathGlob(patterns ...string) (func(path []string, key string, value any) bool, error) {
+	parsed := make([][]string, len(patterns))
+	for i, p := range patterns {
+		parsed[i] = walk.ParsePath(p)
+		for _, segment := range parsed[i] {
+			if _, err := pathpkg.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid path glob %q: %w", p, err)
+			}
+		}
+	}
+
+	return func(path []string, key string, value any) bool {
+		fullPath := make([]string, 0, len(path)+1)
+		fullPath = append(append(fullPath, path...), key)
+		for _, pattern := range parsed {
+			if matchPathGlob(pattern, fullPath) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// matchPathGlob reports whether the segments of path match pattern
+func matchPathGlob(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPathGlob(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 || !matchSegment(pattern[0], path[0]) {
+		return false
+	}
+	return matchPathGlob(pattern[1:], path[1:])
+}
+
+// matchSegment matches one path segment against one glob segment. Literal
+// array indices like "[0]" are compared as is, not as character classes.
+func matchSegment(pattern, segment string) bool {
+	if pattern == segment || pattern == "*" || pattern == "[*]" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "[") && strings.HasSuffix(pattern, "]") {
+		return false
+	}
+	matched, _ := pathpkg.Match(pattern, segment)
+	return matched
+}
+
+// EncryptAny matches fields matched by any of fns
+func EncryptAny(fns ...func(path []string, key string, value any) bool) func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		for _, fn := range fns {
+			if fn(path, key, value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// EncryptAll matches every field
+func EncryptAll() func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		return true
+	}
+}
+
+// EncryptNone matches no field
+func EncryptNone() func(path []string, key string, value any) bool {
+	return func(path []string, key string, value any) bool {
+		return false
+	}
+}
+
+// EncryptRule applies Match to the fields under PathPrefix
+type EncryptRule struct {
+	// PathPrefix is the dotted path of the table or array the rule covers, e.g.
+	// "vault" or "servers[0]". Only fields below it are covered, not the table
+	// itself; "" covers every field.
+	PathPrefix string
+
+	// Match decides whether a covered field is encrypted
+	Match func(path []string, key string, value any) bool
+}
+
+// EncryptByRules matches fields using the first rule whose PathPrefix covers
+// them, so more specific prefixes should come first. Fields no rule covers are
+// decided by fallback, or left plaintext if it is nil.
+func EncryptByRules(rules []EncryptRule, fallback func(path []string, key string, value any) bool) func(path []string, key string, value any) bool {
+	prefixes := make([][]string, len(rules))
+	for i, rule := range rules {
+		if rule.PathPrefix != "" {
+			prefixes[i] = walk.ParsePath(rule.PathPrefix)
+		}
+	}
+
+	return func(path []string, key string, value any) bool {
+		for i, rule := range rules {
+			if hasPathPrefix(path, prefixes[i]) {
+				return rule.Match(path, key, value)
+			}
+		}
+		if fallback == nil {
+			return false
+		}
+		return fallback(path, key, value)
+	}
+}
+
+// hasPathPrefix reports whether path starts with prefix
+func hasPathPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseEncryptRules reads a rules file with one "<path-prefix> <match>" rule
+// per line, in priority order. The prefix is a dotted path ("vault", which may
+// also be written "vault.*") or "*" for every field. The match is one of:
+//
+//	all              encrypt every field
+//	none             encrypt no field
+//	prefix:<prefix>  encrypt fields whose key starts with <prefix>
+//	regex:<pattern>  encrypt fields whose key matches <pattern>
+//
+// Blank lines and lines starting with "#" are ignored.
+func ParseEncryptRules(r io.Reader) ([]EncryptRule, error) {
+	var rules []EncryptRule
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<path-prefix> <match>\", got %q", lineNum, line)
+		}
+
+		prefix := fields[0]
+		if prefix == "*" {
+			prefix = ""
+		} else {
+			prefix = strings.TrimSuffix(prefix, ".*")
+		}
+
+		match, err := parseRuleMatch(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		rules = append(rules, EncryptRule{PathPrefix: prefix, Match: match})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// parseRuleMatch parses the match column of a rules file
+func parseRuleMatch(s string) (func(path []string, key string, value any) bool, error) {
+	switch {
+	case s == "all":
+		return EncryptAll(), nil
+	case s == "none":
+		return EncryptNone(), nil
+	case strings.HasPrefix(s, "prefix:"):
+		prefix := strings.TrimPrefix(s, "prefix:")
+		if prefix == "" {
+			return nil, fmt.Errorf("empty key prefix")
+		}
+		return EncryptByPrefix(prefix), nil
+	case strings.HasPrefix(s, "regex:"):
+		re, err := regexp.Compile(strings.TrimPrefix(s, "regex:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		return EncryptByKeyRegex(re), nil
+	default:
+		return nil, fmt.Errorf("unknown match %q (want all, none, prefix:<prefix>, or regex:<pattern>)", s)
+	}
+}
@@ -0,0 +1,269 @@
+package viola
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestEncryptionRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     func(path []string, key string, value any) bool
+		path     []string
+		key      string
+		expected bool
+	}{
+		{"prefix match", EncryptByPrefix("private_"), nil, "private_key", true},
+		{"prefix miss", EncryptByPrefix("private_"), nil, "public_key", false},
+		{"suffix match", EncryptBySuffix("_secret"), []string{"db"}, "password_secret", true},
+		{"suffix miss", EncryptBySuffix("_secret"), []string{"db"}, "secret_password", false},
+		{"bang suffix", EncryptBySuffix("!"), nil, "token!", true},
+		{"regex match", EncryptByKeyRegex(regexp.MustCompile(`(?i)(password|token)$`)), []string{"db"}, "admin_PASSWORD", true},
+		{"regex miss", EncryptByKeyRegex(regexp.MustCompile(`(?i)(password|token)$`)), []string{"db"}, "host", false},
+		{"path match", EncryptByPath("database.host"), []string{"database"}, "host", true},
+		{"path with index", EncryptByPath("servers[0].api_key"), []string{"servers", "[0]"}, "api_key", true},
+		{"path other index", EncryptByPath("servers[0].api_key"), []string{"servers", "[1]"}, "api_key", false},
+		{"any match", EncryptAny(EncryptByPrefix("secret_"), EncryptByPath("token")), nil, "token", true},
+		{"any miss", EncryptAny(EncryptByPrefix("secret_"), EncryptByPath("token")), nil, "name", false},
+		{"any empty", EncryptAny(), nil, "private_key", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule(tt.path, tt.key, "value"); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEncryptByMinSize(t *testing.T) {
+	rule := EncryptByMinSize(8)
+	tests := []struct {
+		value    any
+		expected bool
+	}{
+		{"short", false},
+		{"12345678", true},
+		{"-----BEGIN CERTIFICATE-----", true},
+		{int64(42), false},
+		{int64(123456789), true},
+		{[]byte("0123456789"), true},
+		{map[string]any{"a": "a long value indeed"}, false},
+		{[]any{"a long value indeed"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := rule(nil, "key", tt.value); got != tt.expected {
+			t.Errorf("EncryptByMinSize(8)(%#v): expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestEncryptByPathGlob(t *testing.T) {
+	rule, err := EncryptByPathGlob("services.*.token", "**.password", "servers[*].api_*", "vault.[0]")
+	if err != nil {
+		t.Fatalf("Failed to compile globs: %v", err)
+	}
+
+	tests := []struct {
+		path     []string
+		key      string
+		expected bool
+	}{
+		{[]string{"services", "web"}, "token", true},
+		{[]string{"services", "web", "extra"}, "token", false},
+		{[]string{"services"}, "token", false},
+		{nil, "password", true},
+		{[]string{"a", "b", "c"}, "password", true},
+		{[]string{"servers", "[3]"}, "api_key", true},
+		{[]string{"servers", "[3]"}, "host", false},
+		{[]string{"vault"}, "[0]", true},
+		{[]string{"vault"}, "0", false},
+	}
+
+	for _, tt := range tests {
+		if got := rule(tt.path, tt.key, "value"); got != tt.expected {
+			t.Errorf("%v.%s: expected %v, got %v", tt.path, tt.key, tt.expected, got)
+		}
+	}
+
+	if _, err := EncryptByPathGlob("db.[unclosed"); err == nil {
+		t.Error("Expected an error for a malformed glob")
+	}
+}
+
+func TestSaveWithComposedRules(t *testing.T) {
+	testData := map[string]any{
+		"private_token": "abc",
+		"database": map[string]any{
+			"admin_password": "secret123",
+			"host":           "localhost",
+		},
+		"servers": []any{
+			map[string]any{"name": "prod", "api_key": "key123"},
+		},
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+		ShouldEncrypt: EncryptAny(
+			EncryptByPrefix("private_"),
+			EncryptByKeyRegex(regexp.MustCompile(`password$`)),
+			EncryptByPath("servers[0].api_key"),
+		),
+	}
+
+	_, fields, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	encrypted := make(map[string]bool)
+	for _, field := range fields {
+		if field.WasEncrypted {
+			encrypted[strings.Join(field.Path, ".")] = true
+		}
+	}
+
+	for _, path := range []string{"private_token", "database.admin_password", "servers.[0].api_key"} {
+		if !encrypted[path] {
+			t.Errorf("Expected %s to be encrypted", path)
+		}
+	}
+	if len(encrypted) != 3 {
+		t.Errorf("Expected exactly 3 encrypted fields, got %v", encrypted)
+	}
+}
+
+func TestSaveWithSubtreeRules(t *testing.T) {
+	testData := map[string]any{
+		"private_token": "abc",
+		"name":          "myapp",
+		"vault": map[string]any{
+			"db_password": "secret123",
+			"api_key":     "key123",
+			"public": map[string]any{
+				"region": "us-east-1",
+			},
+		},
+		"legacy": map[string]any{
+			"private_unused": "old",
+		},
+	}
+
+	rules, err := ParseEncryptRules(strings.NewReader(`
+# every key under vault, nothing under legacy, private_ elsewhere
+vault.*   all
+legacy    none
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	opts := Options{
+		Keys:  enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+		Rules: rules,
+	}
+
+	_, fields, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	encrypted := make(map[string]bool)
+	for _, field := range fields {
+		if field.WasEncrypted {
+			encrypted[strings.Join(field.Path, ".")] = true
+		}
+	}
+
+	for _, path := range []string{"private_token", "vault.db_password", "vault.api_key", "vault.public"} {
+		if !encrypted[path] {
+			t.Errorf("Expected %s to be encrypted", path)
+		}
+	}
+	if len(encrypted) != 4 {
+		t.Errorf("Expected exactly 4 encrypted fields, got %v", encrypted)
+	}
+}
+
+func TestSaveWithPrivateSuffix(t *testing.T) {
+	testData := map[string]any{
+		"private_token":   "abc",
+		"password_secret": "hunter2",
+		"api_key!":        "key123",
+		"secret_name":     "not a secret",
+		"database": map[string]any{
+			"dsn_secret": "postgres://",
+		},
+	}
+
+	opts := Options{
+		Keys:          enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+		PrivateSuffix: "_secret",
+	}
+
+	_, fields, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	encrypted := make(map[string]bool)
+	for _, field := range fields {
+		encrypted[strings.Join(field.Path, ".")] = true
+	}
+	expected := map[string]bool{"private_token": true, "password_secret": true, "database.dsn_secret": true}
+	if !reflect.DeepEqual(encrypted, expected) {
+		t.Errorf("Expected %v to be encrypted, got %v", expected, encrypted)
+	}
+
+	// EncryptPaths replaces both naming rules
+	opts.EncryptPaths = []string{"api_key!"}
+	_, fields, err = Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if len(fields) != 1 || strings.Join(fields[0].Path, ".") != "api_key!" {
+		t.Errorf("Expected only api_key! with EncryptPaths, got %+v", fields)
+	}
+}
+
+func TestParseEncryptRules(t *testing.T) {
+	rules, err := ParseEncryptRules(strings.NewReader("servers[0] regex:(?i)key$\n*  none\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	match := EncryptByRules(rules, EncryptAll())
+
+	if !match([]string{"servers", "[0]"}, "API_KEY", "v") {
+		t.Error("Expected servers[0].API_KEY to match the regex rule")
+	}
+	if match([]string{"servers", "[1]"}, "API_KEY", "v") {
+		t.Error("Expected servers[1].API_KEY to fall through to the catch-all none rule")
+	}
+	if match(nil, "private_token", "v") {
+		t.Error("Expected the catch-all none rule to win over the fallback")
+	}
+	if !EncryptByRules(nil, EncryptAll())(nil, "name", "v") {
+		t.Error("Expected uncovered fields to use the fallback")
+	}
+
+	invalid := []string{
+		"vault",
+		"vault all extra",
+		"vault everything",
+		"vault prefix:",
+		"vault regex:(",
+	}
+	for _, line := range invalid {
+		if _, err := ParseEncryptRules(strings.NewReader(line)); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package viola
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+// Environment variables read by OptionsFromEnv
+const (
+	// EnvIdentity is the path of an age identity file
+	EnvIdentity = "VIOLA_IDENTITY"
+
+	// EnvKey is an age identity itself (AGE-SECRET-KEY-1...), for environments
+	// that inject secrets as variables rather than files
+	EnvKey = "VIOLA_KEY"
+
+	// EnvRecipients is the path of a recipients file
+	EnvRecipients = "VIOLA_RECIPIENTS"
+)
+
+// OptionsFromFiles returns Options with defaults applied whose Keys decrypt
+// with identityFile and encrypt to the recipients in recipientsFile. Either
+// may be "" when only Load or only Save is needed, but not both. The files
+// must exist; their contents are parsed by Load and Save.
+func OptionsFromFiles(identityFile, recipientsFile string) (Options, error) {
+	if identityFile == "" && recipientsFile == "" {
+		return Options{}, fmt.Errorf("no identity or recipients file given")
+	}
+
+	for _, file := range []string{identityFile, recipientsFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return Options{}, fmt.Errorf("key file not accessible: %w", err)
+		}
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			IdentitiesFile: identityFile,
+			RecipientsFile: recipientsFile,
+		},
+	}
+	opts.setDefaults()
+	return opts, nil
+}
+
+// OptionsFromEnv is like OptionsFromFiles, taking the files from
+// VIOLA_IDENTITY and VIOLA_RECIPIENTS. VIOLA_KEY adds an identity given
+// inline. At least one of them must be set.
+func OptionsFromEnv() (Options, error) {
+	identityFile, recipientsFile, key := os.Getenv(EnvIdentity), os.Getenv(EnvRecipients), os.Getenv(EnvKey)
+	if key == "" {
+		if identityFile == "" && recipientsFile == "" {
+			return Options{}, fmt.Errorf("none of %s, %s, or %s is set", EnvIdentity, EnvRecipients, EnvKey)
+		}
+		return OptionsFromFiles(identityFile, recipientsFile)
+	}
+
+	opts := Options{Keys: enc.KeySources{IdentitiesData: []string{key}}}
+	if identityFile != "" || recipientsFile != "" {
+		var err error
+		if opts, err = OptionsFromFiles(identityFile, recipientsFile); err != nil {
+			return Options{}, err
+		}
+		opts.Keys.IdentitiesData = []string{key}
+	}
+	opts.setDefaults()
+	return opts, nil
+}
@@ -0,0 +1,80 @@
+package viola
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+)
+
+func TestOptionsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	identityFile := filepath.Join(dir, "key.txt")
+	recipientsFile := filepath.Join(dir, "recipients.txt")
+	if err := os.WriteFile(identityFile, []byte(testkeys.TestIdentity1+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write identity file: %v", err)
+	}
+	if err := os.WriteFile(recipientsFile, []byte(testkeys.TestRecipient1+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write recipients file: %v", err)
+	}
+
+	opts, err := OptionsFromFiles(identityFile, recipientsFile)
+	if err != nil {
+		t.Fatalf("OptionsFromFiles failed: %v", err)
+	}
+	if opts.PrivatePrefix != "private_" {
+		t.Errorf("Expected defaults applied, got PrivatePrefix %q", opts.PrivatePrefix)
+	}
+
+	encrypted, _, err := Save(map[string]any{"private_password": "secret"}, opts)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	result, err := Load(encrypted, opts)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if result.Tree["private_password"] != "secret" {
+		t.Errorf("Expected round trip, got %v", result.Tree)
+	}
+
+	if _, err := OptionsFromFiles("", ""); err == nil {
+		t.Error("Expected an error without any file")
+	}
+	if _, err := OptionsFromFiles(filepath.Join(dir, "missing.txt"), ""); err == nil {
+		t.Error("Expected an error for a missing identity file")
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv(EnvIdentity, "")
+	t.Setenv(EnvRecipients, "")
+	t.Setenv(EnvKey, "")
+	if _, err := OptionsFromEnv(); err == nil {
+		t.Error("Expected an error with no variables set")
+	}
+
+	recipientsFile := filepath.Join(t.TempDir(), "recipients.txt")
+	if err := os.WriteFile(recipientsFile, []byte(testkeys.TestRecipient1+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write recipients file: %v", err)
+	}
+	t.Setenv(EnvRecipients, recipientsFile)
+	t.Setenv(EnvKey, testkeys.TestIdentity1)
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OptionsFromEnv failed: %v", err)
+	}
+	encrypted, _, err := Save(map[string]any{"private_password": "secret"}, opts)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	result, err := Load(encrypted, opts)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if result.Tree["private_password"] != "secret" {
+		t.Errorf("Expected round trip, got %v", result.Tree)
+	}
+}
@@ -0,0 +1,32 @@
+package viola
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/andreweick/viola/internal/walk"
+)
+
+// Stats counts the fields of a parsed (not decrypted) tree. total is the
+// number of table keys at any depth, including tables and arrays themselves
+// and the keys of tables inside arrays; array elements are not counted on
+// their own. encrypted is the number of armored values, and paths lists
+// their dotted paths (e.g. "servers.[0].private_key") in sorted order.
+func Stats(tree map[string]any) (total, encrypted int, paths []string) {
+	walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+		if key == "" {
+			return value, true
+		}
+		if !strings.HasPrefix(key, "[") {
+			total++
+		}
+		if strValue, ok := value.(string); ok && isArmoredData(strValue) {
+			encrypted++
+			paths = append(paths, strings.Join(append(path[:len(path):len(path)], key), "."))
+		}
+		return value, true
+	})
+
+	sort.Strings(paths)
+	return total, encrypted, paths
+}
@@ -0,0 +1,50 @@
+package viola
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/pkg/enc"
+)
+
+func TestStats(t *testing.T) {
+	tree := map[string]any{
+		"app_name":      "demo",
+		"private_token": "abc",
+		"database": map[string]any{
+			"host":             "localhost",
+			"private_password": "secret",
+		},
+		"servers": []map[string]any{
+			{"name": "prod", "private_api_key": "key"},
+		},
+	}
+
+	data, _, err := Save(tree, Options{Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}}})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	result, err := Load(data, Options{})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	total, encrypted, paths := Stats(result.Tree)
+
+	// app_name, private_token, database, host, private_password, servers, name, private_api_key
+	if total != 8 {
+		t.Errorf("Expected 8 fields, got %d", total)
+	}
+	if encrypted != 3 {
+		t.Errorf("Expected 3 encrypted fields, got %d", encrypted)
+	}
+	expected := []string{"database.private_password", "private_token", "servers.[0].private_api_key"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, paths)
+	}
+
+	if total, encrypted, paths := Stats(map[string]any{}); total != 0 || encrypted != 0 || paths != nil {
+		t.Errorf("Expected zero stats for an empty tree, got %d, %d, %v", total, encrypted, paths)
+	}
+}
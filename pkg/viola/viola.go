@@ -2,16 +2,41 @@
 package viola
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"filippo.io/age"
+	"filippo.io/age/armor"
 	"github.com/BurntSushi/toml"
 
 	"github.com/andreweick/viola/internal/walk"
 	"github.com/andreweick/viola/pkg/enc"
 )
 
+// ErrMalformedArmor is the DecryptErr Load records for a string that starts
+// with an age armor BEGIN marker or ends with an END marker but is not a valid
+// block: the other marker is missing or the body is not base64
+var ErrMalformedArmor = errors.New("malformed armor block: marker missing or body not base64")
+
+// MaxDepth is the deepest nesting of tables and arrays that Load and Save will
+// traverse. Deeper trees (including ones that contain themselves) are rejected.
+const MaxDepth = 256
+
+// ErrMaxDepth is wrapped by the errors of Load, Save, and the other functions
+// that walk a tree nested deeper than MaxDepth. It is the same error as the
+// internal walker's, for callers outside this module to match with errors.Is.
+var ErrMaxDepth = walk.ErrMaxDepth
+
 // Options configures viola behavior
 type Options struct {
 	// Keys specifies sources for age identities and recipients
@@ -20,9 +45,25 @@ type Options struct {
 	// PrivatePrefix is the key prefix that triggers encryption (default: "private_")
 	PrivatePrefix string
 
+	// PrivateSuffix, if set, also triggers encryption for keys ending with it
+	// (e.g. "_secret" or "!"), for configs whose key names can't change prefix.
+	// Either match is enough.
+	PrivateSuffix string
+
 	// ShouldEncrypt overrides the default prefix-based encryption detection
 	ShouldEncrypt func(path []string, key string, value any) bool
 
+	// EncryptPaths lists the exact dotted paths to encrypt (e.g. "servers[0].api_key").
+	// When set, only these fields are encrypted and PrivatePrefix and
+	// PrivateSuffix are ignored.
+	EncryptPaths []string
+
+	// Rules picks a predicate per subtree, e.g. every key under "vault" but only
+	// PrivatePrefix keys elsewhere. The first rule covering a field decides it;
+	// fields no rule covers fall back to EncryptPaths or PrivatePrefix and
+	// PrivateSuffix.
+	Rules []EncryptRule
+
 	// EmitASCIIQR controls whether QR codes are generated (default: true)
 	EmitASCIIQR bool
 
@@ -31,6 +72,116 @@ type Options struct {
 
 	// Indent is the TOML indentation (default: "  ")
 	Indent string
+
+	// RecipientMeta maps recipients to labels and review dates. When set, Save
+	// writes a comment (with QRCommentPrefix) above each encrypted field for
+	// every recipient it was encrypted to; Load reads them into FieldMeta.RecipientNotes.
+	RecipientMeta map[string]RecipientMeta
+
+	// VerifyDecryptable makes Save check that the identities in Keys can decrypt
+	// what it wrote, failing if none can (i.e., it was encrypted to the wrong audience)
+	VerifyDecryptable bool
+
+	// KeyTransform, if set, renames the keys of the tree Load returns (see
+	// TransformKeys), e.g. StripKeyPrefix("private_"). It only affects that
+	// rendered tree: FieldMeta paths keep the original keys, Save ignores it,
+	// and Transform loads without it.
+	KeyTransform func(path []string, key string) string
+
+	// Compress gzips each value before encryption when that makes it smaller,
+	// for large values such as JSON blobs. A header byte inside the ciphertext
+	// records whether it was compressed; Load handles both forms either way.
+	Compress bool
+
+	// DecryptCache, if set, lets Load reuse the plaintext of armored blocks it
+	// has decrypted before instead of running age again, e.g. across reloads
+	// in a long-running service. Failed decryptions are not cached.
+	DecryptCache DecryptCache
+
+	// FieldEncoding selects the serialization of non-string values before
+	// encryption (default: FieldEncodingJSON). The codec is recorded inside the
+	// ciphertext, so Load decodes either without being told.
+	FieldEncoding FieldEncoding
+
+	// ArmorColumns is the line width of the base64 body in armored blocks
+	// (0 = age's default of 64, negative = no wrapping). Load accepts any width.
+	ArmorColumns int
+
+	// PreviousTree is the previously saved (still encrypted) tree, e.g. the parsed
+	// existing output file. When set, Save reuses a field's prior armored block
+	// verbatim if it decrypts (with Keys) to the same value, instead of producing
+	// fresh ciphertext. A block is only reused when its header matches the
+	// current recipients: the same SSH keys, passphrase or not, and the same
+	// number of X25519 keys. X25519 stanzas don't say whose they are, so each
+	// X25519 identity in Keys is also tried on its own: a block it opens
+	// although its recipient is no longer current, or can't open although its
+	// recipient is, gets fresh ciphertext. Replacing an X25519 recipient whose
+	// identity isn't in Keys with another still can't be seen; leave this
+	// unset when rotating such keys one for one.
+	PreviousTree map[string]any
+
+	// SortKeys makes Save fully deterministic for reproducible output: keys are
+	// written in sorted order at every level (plain values before tables, as
+	// TOML requires), and the returned FieldMeta are sorted by path instead of
+	// following map iteration order. Combined with PreviousTree, re-saving an
+	// unchanged tree reproduces the file byte for byte.
+	SortKeys bool
+
+	// OnField, if set, is called by Save before it processes each matched field,
+	// with index running from 1 to total, e.g. to report progress on large files
+	OnField func(path []string, index, total int)
+
+	// Logger, if set, receives a structured event for each field Load decrypts
+	// and Save encrypts (Transform does both), with its path and recipient
+	// count but never its value. Routine events are logged at debug level and
+	// fields left undecrypted or unencrypted at warn. nil means silent.
+	Logger *slog.Logger
+
+	// OnDecryptError, if set, decides what Load does with a field it can't
+	// decrypt (including damaged armor). Returning keep puts replacement in the
+	// tree in place of the field, e.g. a placeholder, or armored itself to leave
+	// the field as it was; returning !keep makes Load fail with err. The field's
+	// FieldMeta records the error either way. When nil, the field is left
+	// armored and Load continues.
+	OnDecryptError func(path []string, armored string, err error) (replacement any, keep bool)
+
+	// HeaderComment, if set, is written by Save as a comment block (one
+	// QRCommentPrefix line per line of text) at the top of the file, followed
+	// by a blank line, e.g. to record how the file was produced. Load returns
+	// it in Result.HeaderComment, and Transform keeps it when unset.
+	HeaderComment string
+
+	// InlineTables lists the paths of tables Save writes inline ({ a = 1 })
+	// rather than as [table] blocks, in the string form of Result.InlineTables.
+	// Transform fills it from the loaded file when unset.
+	InlineTables [][]string
+
+	// RecordAllFields makes Load add a FieldMeta to Result.Fields for every
+	// plaintext leaf too (array elements included, with "[i]" path segments),
+	// with WasEncrypted false, e.g. for audit tooling. Callers that only want
+	// the encrypted fields can filter on WasEncrypted.
+	RecordAllFields bool
+
+	// SortRecipients makes Save encrypt to the recipients in a canonical order
+	// (see enc.SortRecipients), so reordering a recipients file doesn't change
+	// the stanza order of new ciphertext. Useful with SortKeys and PreviousTree
+	// to keep diffs down to fields whose value or audience really changed.
+	SortRecipients bool
+
+	// SingleLine makes Save write each encrypted field on one line, as
+	// enc.SingleLinePrefix followed by the base64 of the binary ciphertext
+	// (private_x = "viola:YWdl..."), instead of an armored block. ArmorColumns
+	// is ignored. Load reads either form.
+	SingleLine bool
+
+	// SkipEmpty makes Save leave fields whose value is an empty string or nil
+	// as they are instead of encrypting them, whatever ShouldEncrypt, Rules,
+	// or the prefix say (see IsEmptyValue). An empty field then reads as
+	// private_x = "" rather than an armored block of nothing; nil fields are
+	// omitted, as TOML has no null. Load returns such fields unchanged and
+	// without a FieldMeta, as it does any plaintext, so re-saving with
+	// SkipEmpty keeps them plaintext and re-saving without it encrypts them.
+	SkipEmpty bool
 }
 
 // setDefaults applies default values to options
@@ -50,10 +201,60 @@ func (o *Options) setDefaults() {
 
 // shouldEncryptField determines if a field should be encrypted
 func (o Options) shouldEncryptField(path []string, key string, value any) bool {
+	if o.SkipEmpty && IsEmptyValue(value) {
+		return false
+	}
 	if o.ShouldEncrypt != nil {
 		return o.ShouldEncrypt(path, key, value)
 	}
-	return strings.HasPrefix(key, o.PrivatePrefix)
+	fallback := EncryptByPrefix(o.PrivatePrefix)
+	if o.PrivateSuffix != "" {
+		fallback = EncryptAny(fallback, EncryptBySuffix(o.PrivateSuffix))
+	}
+	if len(o.EncryptPaths) > 0 {
+		fallback = EncryptByPath(o.EncryptPaths...)
+	}
+	if len(o.Rules) > 0 {
+		return EncryptByRules(o.Rules, fallback)(path, key, value)
+	}
+	return fallback(path, key, value)
+}
+
+// IsEmptyValue reports whether value is an empty string or nil, the values
+// Options.SkipEmpty leaves unencrypted
+func IsEmptyValue(value any) bool {
+	return value == nil || value == ""
+}
+
+// ParseFieldManifest reads a manifest of dotted field paths, one per line.
+// Blank lines and lines starting with "#" are ignored.
+func ParseFieldManifest(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+
+	return paths, nil
+}
+
+// MissingPaths returns the dotted paths that do not exist in tree
+func MissingPaths(tree any, paths []string) []string {
+	var missing []string
+	for _, path := range paths {
+		if _, found := walk.GetValue(tree, walk.ParsePath(path)); !found {
+			missing = append(missing, path)
+		}
+	}
+	return missing
 }
 
 // FieldMeta contains metadata about an encrypted field
@@ -64,9 +265,28 @@ type FieldMeta struct {
 	// WasEncrypted indicates if this field was encrypted
 	WasEncrypted bool
 
+	// Type is the Go type Load decoded the value to (e.g. "string", "int64",
+	// "time.Time", "map[string]any"), or "" for a field it couldn't decrypt
+	Type string
+
+	// TypeGuessed is set by Load when the plaintext carried no type tag yet
+	// decoded to something other than a string, as in files written before
+	// the tags: Type is then a guess, e.g. float64 for what was an integer,
+	// or a datetime for what was a string
+	TypeGuessed bool
+
 	// Armored is the ASCII-armored ciphertext
 	Armored string
 
+	// ArmoredBytes is the length of Armored, e.g. to spot values that bloat
+	// the file
+	ArmoredBytes int
+
+	// PlaintextBytes is the length of the serialized value inside the
+	// ciphertext, before compression. It is 0 when the value isn't known:
+	// a field Load couldn't decrypt, or one Save found already encrypted.
+	PlaintextBytes int
+
 	// ASCIIQR is the QR code as ASCII art (if enabled)
 	ASCIIQR string
 
@@ -75,6 +295,14 @@ type FieldMeta struct {
 
 	// UsedPassphrase indicates if a passphrase was used
 	UsedPassphrase bool
+
+	// DecryptErr is set by Load when an encrypted field could not be decrypted,
+	// in which case the field is left armored in the tree. It is
+	// ErrMalformedArmor for a block missing its BEGIN or END marker.
+	DecryptErr error
+
+	// RecipientNotes are the recipient annotations Load found above the field
+	RecipientNotes []RecipientNote
 }
 
 // Result contains the decrypted configuration and metadata
@@ -84,9 +312,55 @@ type Result struct {
 
 	// Fields contains metadata for each field that was processed
 	Fields []FieldMeta
+
+	// InlineTables are the paths of the tables written inline in the loaded
+	// file (see FindInlineTables), with the original keys even when
+	// KeyTransform renames them. Pass them as Options.InlineTables to keep
+	// that layout on Save.
+	InlineTables [][]string
+
+	// HeaderComment is the text of the comment block at the top of the file,
+	// as written with Options.HeaderComment, or "" if there is none
+	HeaderComment string
 }
 
-// Load parses and decrypts a TOML configuration
+// Summary counts the encrypted fields of a Result by outcome
+type Summary struct {
+	// Encrypted is the number of encrypted fields, including malformed ones
+	Encrypted int
+
+	// Decrypted is the number of encrypted fields that were decrypted
+	Decrypted int
+
+	// Undecryptable is the number of well-formed blocks that could not be decrypted
+	Undecryptable int
+
+	// Malformed is the number of damaged armor blocks (see ErrMalformedArmor)
+	Malformed int
+}
+
+// Summary counts the encrypted fields in r by outcome
+func (r *Result) Summary() Summary {
+	var summary Summary
+	for _, field := range r.Fields {
+		if !field.WasEncrypted {
+			continue
+		}
+		summary.Encrypted++
+		switch {
+		case errors.Is(field.DecryptErr, ErrMalformedArmor):
+			summary.Malformed++
+		case field.DecryptErr != nil:
+			summary.Undecryptable++
+		default:
+			summary.Decrypted++
+		}
+	}
+	return summary
+}
+
+// Load parses and decrypts a TOML configuration. It doesn't modify data, so
+// concurrent Loads of the same bytes are safe.
 func Load(data []byte, opts Options) (*Result, error) {
 	opts.setDefaults()
 
@@ -103,50 +377,196 @@ func Load(data []byte, opts Options) (*Result, error) {
 	}
 
 	var fields []FieldMeta
+	var abortErr error
 
 	// Walk the tree and decrypt encrypted fields
-	decryptedTree := walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+	decryptedTree, err := walk.WalkWithLimit(tree, MaxDepth, func(path []string, key string, value any) (any, bool) {
+		if abortErr != nil {
+			return value, false
+		}
+
+		// A string with only one armor marker is a damaged block (e.g., a
+		// truncated paste), not plaintext
+		if strValue, ok := value.(string); ok && isMalformedArmor(strValue) {
+			opts.logField(slog.LevelWarn, "field not decrypted", append(path, key),
+				slog.String("error", ErrMalformedArmor.Error()))
+			fields = append(fields, FieldMeta{
+				Path:         append(path, key),
+				WasEncrypted: true,
+				Armored:      strValue,
+				ArmoredBytes: len(strValue),
+				DecryptErr:   ErrMalformedArmor,
+			})
+			replacement, keep := opts.decryptFailed(append(path, key), strValue, ErrMalformedArmor)
+			if !keep {
+				abortErr = fmt.Errorf("failed to decrypt %s: %w", strings.Join(append(path, key), "."), ErrMalformedArmor)
+			}
+			return replacement, false
+		}
+
 		// Check if this looks like an encrypted field
 		if strValue, ok := value.(string); ok && isArmoredData(strValue) {
 			// This is encrypted data, decrypt it
-			decrypted, err := enc.Decrypt(strValue, identities)
+			decrypted, err := opts.decrypt(strValue, identities)
 			if err != nil {
 				// If we can't decrypt, leave as-is and record the error
 				// This allows for partial decryption or mixed files
+				opts.logField(slog.LevelWarn, "field not decrypted", append(path, key),
+					slog.String("error", err.Error()))
 				fields = append(fields, FieldMeta{
 					Path:         append(path, key),
 					WasEncrypted: true,
 					Armored:      strValue,
+					ArmoredBytes: len(strValue),
+					DecryptErr:   err,
 				})
-				return value, true
+				replacement, keep := opts.decryptFailed(append(path, key), strValue, err)
+				if !keep {
+					abortErr = fmt.Errorf("failed to decrypt %s: %w", strings.Join(append(path, key), "."), err)
+				}
+				return replacement, false
 			}
 
-			// Try to decode as JSON (for non-string values)
-			var jsonValue any
-			if err := json.Unmarshal(decrypted, &jsonValue); err != nil {
-				// Not JSON, treat as string
-				jsonValue = string(decrypted)
+			// A decrypted table or array is spliced back in whole; its
+			// contents were plaintext inside the blob, so don't descend
+			decoded := decodeValue(decrypted)
+			fields = append(fields, FieldMeta{
+				Path:           append(path, key),
+				WasEncrypted:   true,
+				Type:           valueTypeName(decoded),
+				TypeGuessed:    typeGuessed(decrypted, decoded),
+				Armored:        strValue,
+				ArmoredBytes:   len(strValue),
+				PlaintextBytes: len(decrypted),
+			})
+			if opts.Logger != nil {
+				opts.logField(slog.LevelDebug, "field decrypted", append(path, key),
+					slog.Int("recipients", armorRecipientCount(strValue)))
 			}
 
+			return decoded, false
+		}
+
+		if opts.RecordAllFields && !isContainer(value) {
 			fields = append(fields, FieldMeta{
-				Path:         append(path, key),
-				WasEncrypted: true,
-				Armored:      strValue,
+				Path: append(path, key),
+				Type: valueTypeName(value),
 			})
-
-			return jsonValue, true
 		}
 
 		return value, true
 	})
+	if err != nil {
+		return nil, err
+	}
+	if abortErr != nil {
+		return nil, abortErr
+	}
+
+	if len(fields) > 0 {
+		notes := readRecipientNotes(data, opts.QRCommentPrefix)
+		for i := range fields {
+			if !fields[i].WasEncrypted {
+				continue
+			}
+			fields[i].RecipientNotes = notes[fields[i].Armored]
+		}
+	}
+
+	resultTree := decryptedTree.(map[string]any)
+	if opts.KeyTransform != nil {
+		resultTree, err = TransformKeys(resultTree, opts.KeyTransform)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &Result{
-		Tree:   decryptedTree.(map[string]any),
-		Fields: fields,
+		Tree:          resultTree,
+		Fields:        fields,
+		InlineTables:  FindInlineTables(data),
+		HeaderComment: readHeaderComment(data, opts.QRCommentPrefix),
 	}, nil
 }
 
-// Save encrypts and serializes a configuration to TOML
+// isContainer reports whether the walk descends into value rather than
+// treating it as a leaf
+func isContainer(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any, []map[string]any:
+		return true
+	}
+	return false
+}
+
+// valueTypeName names the Go type of a decoded value, spelling the generic
+// containers the way Go code does (map[string]any rather than map[string]interface {})
+func valueTypeName(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "map[string]any"
+	case []any:
+		return "[]any"
+	case []map[string]any:
+		return "[]map[string]any"
+	case nil:
+		return "nil"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// formatArmor returns an armored block as Save writes it: on a single line
+// with SingleLine, otherwise wrapped to ArmorColumns
+func (o Options) formatArmor(armored string) (string, error) {
+	if o.SingleLine {
+		return enc.ToSingleLine(armored)
+	}
+	return enc.WrapArmor(armored, o.ArmorColumns), nil
+}
+
+// decryptFailed returns what Load puts in the tree for a field it couldn't
+// decrypt, and whether to go on: the armored block itself unless
+// OnDecryptError says otherwise
+func (o Options) decryptFailed(path []string, armored string, err error) (any, bool) {
+	if o.OnDecryptError == nil {
+		return armored, true
+	}
+	return o.OnDecryptError(append([]string(nil), path...), armored, err)
+}
+
+// decrypt returns the plaintext of an armored block, from DecryptCache if it
+// holds the block
+func (o Options) decrypt(armored string, identities []age.Identity) ([]byte, error) {
+	if o.DecryptCache != nil {
+		if plaintext, ok := o.DecryptCache.Get(armored); ok {
+			return plaintext, nil
+		}
+	}
+
+	decrypted, err := enc.Decrypt(armored, identities)
+	if err == nil {
+		decrypted, err = openEnvelope(decrypted)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.DecryptCache != nil {
+		o.DecryptCache.Set(armored, decrypted)
+	}
+	return decrypted, nil
+}
+
+// encryptField encrypts the plaintext of the field at path. It is a variable
+// only so tests can make the ciphertext reproducible.
+var encryptField = func(data []byte, recipients []age.Recipient, path []string) (string, error) {
+	return enc.Encrypt(data, recipients)
+}
+
+// Save encrypts and serializes a configuration to TOML. tree is not modified
+// (Save works on the copy walk.Walk makes), so concurrent Saves of the same
+// tree are safe as long as nothing else modifies it.
 func Save(tree any, opts Options) ([]byte, []FieldMeta, error) {
 	opts.setDefaults()
 
@@ -157,21 +577,69 @@ func Save(tree any, opts Options) ([]byte, []FieldMeta, error) {
 	}
 
 	if len(recipients) == 0 {
-		return nil, nil, fmt.Errorf("no recipients available for encryption")
+		return nil, nil, fmt.Errorf("cannot encrypt: %w", enc.ErrNoRecipients)
+	}
+	if opts.SortRecipients {
+		recipients = enc.SortRecipients(recipients)
+	}
+
+	if err := validFieldEncoding(opts.FieldEncoding); err != nil {
+		return nil, nil, err
+	}
+
+	// Identities are only needed to compare against previously saved ciphertext
+	// or to verify the result
+	var identities []age.Identity
+	if opts.PreviousTree != nil || opts.VerifyDecryptable {
+		identities, err = opts.Keys.LoadIdentities()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load identities: %w", err)
+		}
 	}
 
+	// Previous ciphertext is only reused for the same audience
+	var audience []string
+	var own []ownKey
+	if opts.PreviousTree != nil {
+		audience, err = enc.AudienceTags(recipients)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read recipient tags: %w", err)
+		}
+		own = ownKeys(identities, recipients)
+	}
+
+	// Progress reporting needs the number of matched fields up front
+	total := 0
+	if opts.OnField != nil {
+		total, err = countMatchedFields(tree, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The walk visits fields one at a time on this goroutine; if that ever
+	// changes, fields and index need a lock
 	var fields []FieldMeta
+	index := 0
+	firstEncrypted := -1 // Index in fields of the first field encrypted afresh
 
 	// Walk the tree and encrypt fields that should be encrypted
-	encryptedTree := walk.Walk(tree, func(path []string, key string, value any) (any, bool) {
+	encryptedTree, err := walk.WalkWithLimit(tree, MaxDepth, func(path []string, key string, value any) (any, bool) {
 		if opts.shouldEncryptField(path, key, value) {
+			if opts.OnField != nil {
+				index++
+				opts.OnField(append(append([]string(nil), path...), key), index, total)
+			}
+
 			// Skip if already encrypted
 			if strValue, ok := value.(string); ok && isArmoredData(strValue) {
 				// Already encrypted, record metadata and leave as-is
+				opts.logField(slog.LevelDebug, "field already encrypted", append(path, key))
 				fields = append(fields, FieldMeta{
 					Path:           append(path, key),
 					WasEncrypted:   true,
 					Armored:        strValue,
+					ArmoredBytes:   len(strValue),
 					UsedRecipients: enc.GetRecipientStrings(recipients),
 					UsedPassphrase: enc.HasPassphraseRecipient(recipients),
 				})
@@ -179,39 +647,104 @@ func Save(tree any, opts Options) ([]byte, []FieldMeta, error) {
 			}
 
 			// Encrypt the value
-			var dataToEncrypt []byte
-			if strValue, ok := value.(string); ok {
-				// String value, encrypt directly
-				dataToEncrypt = []byte(strValue)
-			} else {
-				// Non-string value, serialize to JSON first
-				jsonData, err := json.Marshal(value)
+			dataToEncrypt, err := encodeValue(value, opts.FieldEncoding)
+			if err != nil {
+				// If we can't serialize, leave as-is
+				opts.logField(slog.LevelWarn, "field not encrypted", append(path, key),
+					slog.String("error", err.Error()))
+				return value, true
+			}
+
+			// Reuse the previous ciphertext if the value hasn't changed
+			if armored, ok := previousArmor(opts.PreviousTree, append(path, key), dataToEncrypt, identities, audience, own); ok {
+				if armored, err = opts.formatArmor(armored); err != nil {
+					opts.logField(slog.LevelWarn, "field not encrypted", append(path, key),
+						slog.String("error", err.Error()))
+					return value, true
+				}
+				opts.logField(slog.LevelDebug, "field ciphertext reused", append(path, key))
+				fields = append(fields, FieldMeta{
+					Path:           append(path, key),
+					WasEncrypted:   true,
+					Armored:        armored,
+					ArmoredBytes:   len(armored),
+					PlaintextBytes: len(dataToEncrypt),
+					UsedRecipients: enc.GetRecipientStrings(recipients),
+					UsedPassphrase: enc.HasPassphraseRecipient(recipients),
+				})
+				return armored, false
+			}
+
+			plaintextBytes := len(dataToEncrypt)
+			if opts.Compress {
+				dataToEncrypt, err = sealEnvelope(dataToEncrypt)
 				if err != nil {
-					// If we can't serialize, leave as-is
+					opts.logField(slog.LevelWarn, "field not encrypted", append(path, key),
+						slog.String("error", err.Error()))
 					return value, true
 				}
-				dataToEncrypt = jsonData
 			}
 
-			encrypted, err := enc.Encrypt(dataToEncrypt, recipients)
+			encrypted, err := encryptField(dataToEncrypt, recipients, append(path, key))
 			if err != nil {
 				// If we can't encrypt, leave as-is
+				opts.logField(slog.LevelWarn, "field not encrypted", append(path, key),
+					slog.String("error", err.Error()))
 				return value, true
 			}
+			if encrypted, err = opts.formatArmor(encrypted); err != nil {
+				opts.logField(slog.LevelWarn, "field not encrypted", append(path, key),
+					slog.String("error", err.Error()))
+				return value, true
+			}
+			opts.logField(slog.LevelDebug, "field encrypted", append(path, key),
+				slog.Int("recipients", len(recipients)))
 
+			if firstEncrypted < 0 {
+				firstEncrypted = len(fields)
+			}
 			fields = append(fields, FieldMeta{
 				Path:           append(path, key),
 				WasEncrypted:   true,
 				Armored:        encrypted,
+				ArmoredBytes:   len(encrypted),
+				PlaintextBytes: plaintextBytes,
 				UsedRecipients: enc.GetRecipientStrings(recipients),
 				UsedPassphrase: enc.HasPassphraseRecipient(recipients),
 			})
 
-			return encrypted, true
+			// A matched table or array is encrypted as one blob, so stop here
+			// rather than walking into it and encrypting its leaves again
+			return encrypted, false
 		}
 
 		return value, true
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every new block has the same recipients, so one proves them all;
+	// pre-encrypted fields aren't this Save's, and reused ones were decrypted
+	// with the identities to be reused
+	if opts.VerifyDecryptable && firstEncrypted >= 0 {
+		if err := verifyDecryptable(fields[firstEncrypted], identities); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if opts.SortKeys {
+		sort.SliceStable(fields, func(i, j int) bool {
+			return strings.Join(fields[i].Path, ".") < strings.Join(fields[j].Path, ".")
+		})
+	}
+
+	// Walk returned a copy of the tables, so they can be marked in place
+	if len(opts.InlineTables) > 0 {
+		if root, ok := encryptedTree.(map[string]any); ok {
+			markInlineTables(root, opts.InlineTables)
+		}
+	}
 
 	// Serialize back to TOML
 	tomlData, err := tomlMarshal(encryptedTree)
@@ -219,33 +752,411 @@ func Save(tree any, opts Options) ([]byte, []FieldMeta, error) {
 		return nil, nil, fmt.Errorf("failed to marshal TOML: %w", err)
 	}
 
+	if opts.RecipientMeta != nil {
+		tomlData = annotateRecipients(tomlData, fields, opts.RecipientMeta, opts.QRCommentPrefix)
+	}
+	if opts.HeaderComment != "" {
+		tomlData = append(headerComment(opts.HeaderComment, opts.QRCommentPrefix), tomlData...)
+	}
+
 	return tomlData, fields, nil
 }
 
+// Format serializes tree to TOML the way Save does, without encrypting
+// anything, so already-encrypted values are kept verbatim. It needs no keys,
+// making it usable as a formatter that normalizes key order and layout.
+func Format(tree any) ([]byte, error) {
+	return FormatWithInlineTables(tree, nil)
+}
+
+// FormatWithInlineTables is like Format, but writes the tables at inlineTables
+// inline, as Save does with Options.InlineTables
+func FormatWithInlineTables(tree any, inlineTables [][]string) ([]byte, error) {
+	// Reject trees Save would reject, including ones that contain themselves.
+	// The walk also copies the tables, so they can be marked inline in place.
+	copied, err := walk.WalkWithLimit(tree, MaxDepth, func(path []string, key string, value any) (any, bool) {
+		return value, true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root, ok := copied.(map[string]any); ok && len(inlineTables) > 0 {
+		markInlineTables(root, inlineTables)
+	}
+
+	data, err := tomlMarshal(copied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TOML: %w", err)
+	}
+	return data, nil
+}
+
+// countMatchedFields counts the fields Save will encrypt (or find already
+// encrypted), without descending into matched tables and arrays
+func countMatchedFields(tree any, opts Options) (int, error) {
+	count := 0
+	_, err := walk.WalkWithLimit(tree, MaxDepth, func(path []string, key string, value any) (any, bool) {
+		if opts.shouldEncryptField(path, key, value) {
+			count++
+			return value, false
+		}
+		return value, true
+	})
+	return count, err
+}
+
 // Transform loads a configuration, applies a transformation function, and saves it back
 func Transform(data []byte, opts Options, transform func(tree any) error) ([]byte, []FieldMeta, error) {
-	// Load the configuration
-	result, err := Load(data, opts)
+	return TransformWithMeta(data, opts, func(tree map[string]any, fields []FieldMeta) error {
+		return transform(tree)
+	})
+}
+
+// TransformWithMeta is like Transform, but also passes the transformation the
+// metadata Load recorded for the fields that were encrypted in data, so it can
+// act on prior encryption state (e.g., only touch fields that were secret)
+func TransformWithMeta(data []byte, opts Options, transform func(tree map[string]any, fields []FieldMeta) error) ([]byte, []FieldMeta, error) {
+	// Load the configuration; renamed keys must not be saved back
+	loadOpts := opts
+	loadOpts.KeyTransform = nil
+	result, err := Load(data, loadOpts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	// Apply the transformation
-	if err := transform(result.Tree); err != nil {
+	if err := transform(result.Tree, result.Fields); err != nil {
 		return nil, nil, fmt.Errorf("transformation failed: %w", err)
 	}
 
-	// Save the modified configuration
+	// Save the modified configuration, keeping inline tables inline and the
+	// header comment
+	if opts.InlineTables == nil {
+		opts.InlineTables = result.InlineTables
+	}
+	if opts.HeaderComment == "" {
+		opts.HeaderComment = result.HeaderComment
+	}
 	return Save(result.Tree, opts)
 }
 
+// bytesTag starts the plaintext of a []byte value, which is stored as a base64
+// JSON string. Like the envelope header bytes in compress.go, it can't start
+// valid UTF-8, so it never collides with string or JSON plaintext.
+const bytesTag byte = 0xFD
+
+// datetimeTag starts the plaintext of a datetime, followed by its TOML
+// literal, and stringTag that of a string that would otherwise read back as
+// JSON (e.g. "42" or "true"). Load never has to guess the type of tagged
+// plaintext; untagged plaintext is JSON or a string.
+const (
+	datetimeTag byte = 0xFB
+	stringTag   byte = 0xFA
+)
+
+// jsonTag starts the plaintext of a JSON value whose numbers keep their kind:
+// floats are always written with a decimal point or exponent, so Load decodes
+// integers back to int64 and floats to float64. Untagged JSON, written before
+// jsonTag, decodes every number to float64.
+const jsonTag byte = 0xF9
+
+// encodeValue converts a field value to the plaintext bytes that get encrypted.
+// Strings are used directly (behind stringTag if they look like another type),
+// datetimes as datetimeTag and their TOML literal (so local dates and times
+// stay local), []byte as bytesTag and base64, and other values are
+// serialized to JSON behind jsonTag, or to gob behind gobTag with
+// FieldEncodingGob.
+func encodeValue(value any, encoding FieldEncoding) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		if decoded, ok := decodeUntagged([]byte(v)).(string); !ok || decoded != v {
+			return append([]byte{stringTag}, v...), nil
+		}
+		return []byte(v), nil
+	case time.Time:
+		literal, err := formatTOMLDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{datetimeTag}, literal...), nil
+	case []byte:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{bytesTag}, data...), nil
+	}
+	if encoding == FieldEncodingGob {
+		return encodeGob(value)
+	}
+	data, err := json.Marshal(markFloats(value))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{jsonTag}, data...), nil
+}
+
+// markFloats returns a copy of value with every float replaced by a
+// json.Number that has a decimal point or exponent, so 1.0 isn't written as
+// the integer 1
+func markFloats(value any) any {
+	switch v := value.(type) {
+	case float64:
+		return floatNumber(v)
+	case float32:
+		return floatNumber(float64(v))
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[key] = markFloats(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = markFloats(item)
+		}
+		return out
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = markFloats(item)
+		}
+		return out
+	}
+	return value
+}
+
+// floatNumber formats f as a JSON number that reads back as a float. NaN and
+// the infinities are left as invalid numbers, which json.Marshal rejects just
+// as it does the float64 values.
+func floatNumber(f float64) json.Number {
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eE") {
+		text += ".0"
+	}
+	return json.Number(text)
+}
+
+// decodeJSONNumbers decodes tagged JSON plaintext, turning numbers without a
+// decimal point or exponent into int64 (or float64 if they overflow it)
+func decodeJSONNumbers(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+// convertNumbers replaces the json.Numbers in value by int64 or float64
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if n, err := v.Int64(); err == nil {
+				return n
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	}
+	return value
+}
+
+// decodeValue converts decrypted plaintext back into a field value
+func decodeValue(decrypted []byte) any {
+	if len(decrypted) > 0 && decrypted[0] == gobTag {
+		if value, err := decodeGob(decrypted[1:]); err == nil {
+			return value
+		}
+	}
+	if len(decrypted) > 0 && decrypted[0] == bytesTag {
+		var data []byte
+		if err := json.Unmarshal(decrypted[1:], &data); err == nil {
+			return data
+		}
+	}
+	if len(decrypted) > 0 && decrypted[0] == stringTag {
+		return string(decrypted[1:])
+	}
+	if len(decrypted) > 0 && decrypted[0] == datetimeTag {
+		if t, ok := parseTOMLDatetime(decrypted[1:]); ok {
+			return t
+		}
+	}
+	if len(decrypted) > 0 && decrypted[0] == jsonTag {
+		if value, err := decodeJSONNumbers(decrypted[1:]); err == nil {
+			return value
+		}
+	}
+	return decodeUntagged(decrypted)
+}
+
+// typeGuessed reports whether decodeValue had to guess the type of decoded
+// from untagged plaintext. Untagged strings are exact, since encodeValue tags
+// every string that would read back as anything else.
+func typeGuessed(decrypted []byte, decoded any) bool {
+	if len(decrypted) > 0 {
+		switch decrypted[0] {
+		case gobTag, bytesTag, stringTag, datetimeTag, jsonTag:
+			return false
+		}
+	}
+	_, isString := decoded.(string)
+	return !isString
+}
+
+// decodeUntagged decodes plaintext without a type tag: JSON for non-string
+// values, or a string
+func decodeUntagged(decrypted []byte) any {
+	var jsonValue any
+	if err := json.Unmarshal(decrypted, &jsonValue); err != nil {
+		// Not JSON, treat as string
+		return string(decrypted)
+	}
+	return jsonValue
+}
+
+// formatTOMLDatetime renders t the way it appears on the right of a TOML key
+func formatTOMLDatetime(t time.Time) ([]byte, error) {
+	data, err := tomlMarshal(map[string]any{"v": t})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(bytes.TrimPrefix(data, []byte("v = "))), nil
+}
+
+// parseTOMLDatetime parses a TOML datetime literal as written by
+// formatTOMLDatetime. Anything that doesn't format back to exactly the same
+// text is rejected, so ordinary strings are left alone.
+func parseTOMLDatetime(data []byte) (time.Time, bool) {
+	if len(data) == 0 || bytes.ContainsAny(data, "\n\"'#=") {
+		return time.Time{}, false
+	}
+
+	var doc map[string]any
+	if _, err := toml.Decode("v = "+string(data), &doc); err != nil {
+		return time.Time{}, false
+	}
+	t, ok := doc["v"].(time.Time)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	formatted, err := formatTOMLDatetime(t)
+	if err != nil || !bytes.Equal(formatted, data) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// verifyDecryptable checks that identities can decrypt field
+func verifyDecryptable(field FieldMeta, identities []age.Identity) error {
+	path := strings.Join(field.Path, ".")
+	if len(identities) == 0 {
+		return fmt.Errorf("cannot verify %s is decryptable: %w", path, enc.ErrNoIdentities)
+	}
+	if _, err := enc.Decrypt(field.Armored, identities); err != nil {
+		return fmt.Errorf("none of the identities can decrypt %s (encrypted to the wrong recipients?): %w", path, err)
+	}
+	return nil
+}
+
+// ownKey is an X25519 identity Save holds, and whether its recipient is one
+// of the current recipients
+type ownKey struct {
+	identity age.Identity
+	current  bool
+}
+
+// ownKeys returns the X25519 identities among identities, which can tell
+// whether a previous block was encrypted to their recipient
+func ownKeys(identities []age.Identity, recipients []age.Recipient) []ownKey {
+	current := make(map[string]bool)
+	for _, recipient := range enc.GetRecipientStrings(recipients) {
+		current[recipient] = true
+	}
+
+	var own []ownKey
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			own = append(own, ownKey{identity: identity, current: current[x25519.Recipient().String()]})
+		}
+	}
+	return own
+}
+
+// previousArmor returns the armored block stored at path in the previous tree
+// if it decrypts to exactly the given plaintext (compressed or not), its
+// header has the audience tags of the current recipients (see
+// enc.AudienceTags), and each of own opens it exactly when its recipient is
+// current
+func previousArmor(previous map[string]any, path []string, plaintext []byte, identities []age.Identity, audience []string, own []ownKey) (string, bool) {
+	if previous == nil || len(identities) == 0 {
+		return "", false
+	}
+
+	value, found := walk.GetValue(previous, path)
+	if !found {
+		return "", false
+	}
+
+	armored, ok := value.(string)
+	if !ok || !isArmoredData(armored) {
+		return "", false
+	}
+
+	// Ciphertext for another audience would keep a removed recipient reading
+	// the field, or leave an added one out
+	header, err := enc.ParseHeader(armored)
+	if err != nil || !slices.Equal(header.RecipientTags(), audience) {
+		return "", false
+	}
+
+	decrypted, err := enc.Decrypt(armored, identities)
+	if err == nil {
+		decrypted, err = openEnvelope(decrypted)
+	}
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		return "", false
+	}
+
+	// Same number of X25519 stanzas, but maybe not the same keys
+	for _, key := range own {
+		if _, err := enc.Decrypt(armored, []age.Identity{key.identity}); (err == nil) != key.current {
+			return "", false
+		}
+	}
+
+	return armored, true
+}
+
 // isArmoredData checks if a string looks like ASCII-armored age data
 func isArmoredData(s string) bool {
-	return strings.Contains(s, "-----BEGIN AGE ENCRYPTED FILE-----") &&
-		strings.Contains(s, "-----END AGE ENCRYPTED FILE-----")
+	return enc.IsArmored(s)
+}
+
+// isMalformedArmor reports whether s starts or ends like an armored block but
+// is not one, e.g. a truncated paste or a corrupted body. Strings that only
+// mention the markers in passing are plaintext.
+func isMalformedArmor(s string) bool {
+	s = strings.TrimSpace(s)
+	return (strings.HasPrefix(s, armor.Header) || strings.HasSuffix(s, armor.Footer)) && !enc.IsArmored(s)
 }
 
-// tomlMarshal marshals a value to TOML bytes
+// tomlMarshal encodes v as TOML. The encoder visits map keys in sorted order
+// at every level, writing a table's plain values before its sub-tables, so
+// equal trees always encode to the same bytes.
 func tomlMarshal(v any) ([]byte, error) {
 	var buf strings.Builder
 	encoder := toml.NewEncoder(&buf)
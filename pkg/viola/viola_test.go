@@ -1,11 +1,21 @@
 package viola
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/BurntSushi/toml"
 
 	"github.com/andreweick/viola/internal/testkeys"
+	"github.com/andreweick/viola/internal/walk"
 	"github.com/andreweick/viola/pkg/enc"
 )
 
@@ -226,7 +236,7 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("Config private_api_token mismatch: expected %v, got %v", origConfig["private_api_token"], resultConfig["private_api_token"])
 	}
 
-	// Check numbers (JSON marshaling may change int to float64 for encrypted fields)
+	// Check numbers (encrypted integers come back as int64)
 	origNumbers := originalData["numbers"].(map[string]any)
 	resultNumbers := result.Tree["numbers"].(map[string]any)
 
@@ -239,13 +249,11 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("Numbers port mismatch: expected %v, got %v", origNumbers["port"], resultNumbers["port"])
 	}
 
-	// Encrypted field might be converted to float64
-	if resultNumbers["private_secret_number"] != float64(42) {
-		t.Errorf("Numbers private_secret_number mismatch: expected %v, got %v", float64(42), resultNumbers["private_secret_number"])
+	if resultNumbers["private_secret_number"] != int64(42) {
+		t.Errorf("Numbers private_secret_number mismatch: expected %v, got %#v", int64(42), resultNumbers["private_secret_number"])
 	}
 
 	// Check that complex types (arrays and objects) are preserved
-	// Note: JSON marshaling/unmarshaling may change number types (int -> float64)
 	origArray := originalData["private_array"].([]any)
 	resultArray := result.Tree["private_array"].([]any)
 	if len(origArray) != len(resultArray) {
@@ -258,7 +266,7 @@ func TestRoundTrip(t *testing.T) {
 		}
 	}
 
-	// For complex objects, JSON marshaling converts int to float64
+	// Numbers inside an encrypted table keep their kind too
 	origComplex := originalData["private_complex"].(map[string]any)
 	resultComplex := result.Tree["private_complex"].(map[string]any)
 
@@ -266,10 +274,522 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("Complex nested mismatch: expected %v, got %v", origComplex["nested"], resultComplex["nested"])
 	}
 
-	// JSON marshaling converts int 123 to float64 123.0
-	if resultComplex["count"] != float64(123) {
-		t.Errorf("Complex count mismatch: expected %v, got %v", float64(123), resultComplex["count"])
+	if resultComplex["count"] != int64(123) {
+		t.Errorf("Complex count mismatch: expected %v, got %#v", int64(123), resultComplex["count"])
+	}
+}
+
+func TestEncryptWholeTable(t *testing.T) {
+	input := []byte(`
+[private_credentials]
+username = "admin"
+password = "hunter2"
+private_token = "abc"
+
+[[private_servers]]
+name = "prod"
+api_key = "key123"
+
+[[private_servers]]
+name = "staging"
+api_key = "key456"
+`)
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	var tree map[string]any
+	if err := toml.Unmarshal(input, &tree); err != nil {
+		t.Fatalf("Failed to parse input: %v", err)
+	}
+
+	tomlData, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	// Each table is one encrypted field, not one per leaf
+	if len(fields) != 2 {
+		t.Fatalf("Expected 2 encrypted fields, got %d: %v", len(fields), fields)
+	}
+
+	var saved map[string]any
+	if err := toml.Unmarshal(tomlData, &saved); err != nil {
+		t.Fatalf("Failed to parse saved TOML: %v", err)
+	}
+	for _, key := range []string{"private_credentials", "private_servers"} {
+		armored, ok := saved[key].(string)
+		if !ok || !isArmoredData(armored) {
+			t.Errorf("Expected %s to be a single armored string, got %T", key, saved[key])
+		}
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	expectedCredentials := map[string]any{
+		"username":      "admin",
+		"password":      "hunter2",
+		"private_token": "abc",
+	}
+	if !reflect.DeepEqual(result.Tree["private_credentials"], expectedCredentials) {
+		t.Errorf("Expected credentials %v, got %v", expectedCredentials, result.Tree["private_credentials"])
+	}
+
+	expectedServers := []any{
+		map[string]any{"name": "prod", "api_key": "key123"},
+		map[string]any{"name": "staging", "api_key": "key456"},
+	}
+	if !reflect.DeepEqual(result.Tree["private_servers"], expectedServers) {
+		t.Errorf("Expected servers %v, got %v", expectedServers, result.Tree["private_servers"])
+	}
+
+	if len(result.Fields) != 2 {
+		t.Errorf("Expected 2 decrypted fields, got %d", len(result.Fields))
+	}
+}
+
+func TestArrayOfTablesRoundTrip(t *testing.T) {
+	input := []byte(`
+title = "fleet"
+
+[[servers]]
+name = "prod"
+private_api_key = "key123"
+
+[[servers]]
+name = "staging"
+private_api_key = "key456"
+
+[servers.settings]
+private_token = "token789"
+public = true
+
+[[servers.replicas]]
+host = "replica-1"
+private_password = "hunter2"
+
+[[servers.replicas]]
+host = "replica-2"
+private_password = "hunter3"
+`)
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	plain, err := Load(input, Options{})
+	if err != nil {
+		t.Fatalf("Failed to load plaintext: %v", err)
+	}
+
+	tomlData, fields, err := Save(plain.Tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	if len(fields) != 5 {
+		t.Errorf("Expected 5 encrypted fields, got %d", len(fields))
+	}
+	if !strings.Contains(string(tomlData), "[[servers]]") || !strings.Contains(string(tomlData), "[[servers.replicas]]") {
+		t.Errorf("Expected arrays of tables to be kept, got:\n%s", tomlData)
+	}
+	for _, secret := range []string{"key123", "key456", "token789", "hunter2", "hunter3"} {
+		if strings.Contains(string(tomlData), secret) {
+			t.Errorf("Saved TOML contains plaintext %q", secret)
+		}
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Tree, plain.Tree) {
+		t.Errorf("Round trip changed the tree:\nexpected %#v\ngot      %#v", plain.Tree, result.Tree)
+	}
+}
+
+func TestDatetimeRoundTrip(t *testing.T) {
+	input := []byte(`
+created = 1979-05-27T07:32:00-07:00
+private_expires = 2030-01-02T03:04:05Z
+private_local = 1979-05-27T07:32:00
+private_date = 1979-05-27
+private_time = 07:32:00
+private_label = "not a date"
+`)
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	var tree map[string]any
+	if _, err := toml.Decode(string(input), &tree); err != nil {
+		t.Fatalf("Failed to parse input: %v", err)
+	}
+
+	tomlData, _, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	for key, original := range tree {
+		if !reflect.DeepEqual(result.Tree[key], original) {
+			t.Errorf("%s: expected %#v, got %#v", key, original, result.Tree[key])
+		}
+	}
+
+	// Re-serializing keeps the TOML datetime kinds
+	plain, err := tomlMarshal(result.Tree)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	for _, line := range []string{
+		"created = 1979-05-27T07:32:00-07:00",
+		"private_expires = 2030-01-02T03:04:05Z",
+		"private_local = 1979-05-27T07:32:00",
+		"private_date = 1979-05-27",
+		"private_time = 07:32:00",
+	} {
+		if !strings.Contains(string(plain), line) {
+			t.Errorf("Expected %q in output:\n%s", line, plain)
+		}
+	}
+}
+
+func TestDatetimeLikeStringsStayStrings(t *testing.T) {
+	tree := map[string]any{
+		"private_date":     "2024-01-01",
+		"private_time":     "07:32:00",
+		"private_datetime": "1979-05-27T07:32:00Z",
+		"private_number":   "42",
+		"private_bool":     "true",
+		"private_null":     "null",
+		"private_quoted":   `"quoted"`,
+		"private_json":     `{"a": 1}`,
+		"private_plain":    "hunter2",
+		"private_when":     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	tomlData, _, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	for key, original := range tree {
+		if !reflect.DeepEqual(result.Tree[key], original) {
+			t.Errorf("%s: expected %#v, got %#v", key, original, result.Tree[key])
+		}
+	}
+
+	// Plain strings stay untagged, readable with age alone
+	if plaintext, err := encodeValue("hunter2", FieldEncodingJSON); err != nil || string(plaintext) != "hunter2" {
+		t.Errorf("Expected an ordinary string to be stored as is, got %q (err %v)", plaintext, err)
+	}
+
+	// Strings that merely look like datetimes don't need the tag
+	if plaintext, err := encodeValue("1979-05-27", FieldEncodingJSON); err != nil || string(plaintext) != "1979-05-27" {
+		t.Errorf("Expected a date-like string to be stored as is, got %q (err %v)", plaintext, err)
+	}
+}
+
+func TestLoadBaselineDateLikeStrings(t *testing.T) {
+	// Releases before the type tags encrypted strings as their raw bytes
+	recipient, err := age.ParseX25519Recipient(testkeys.TestRecipient1)
+	if err != nil {
+		t.Fatalf("Failed to parse recipient: %v", err)
+	}
+	doc := ""
+	secrets := map[string]string{"private_day": "2024-01-01", "private_time": "07:32:00"}
+	for key, secret := range secrets {
+		armored, err := enc.Encrypt([]byte(secret), []age.Recipient{recipient})
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		doc += fmt.Sprintf("%s = \"\"\"\n%s\"\"\"\n", key, armored)
+	}
+
+	result, err := Load([]byte(doc), Options{Keys: enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity1}}})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	for key, secret := range secrets {
+		if value, ok := result.Tree[key].(string); !ok || value != secret {
+			t.Errorf("%s: expected string %q, got %#v", key, secret, result.Tree[key])
+		}
+	}
+	for _, field := range result.Fields {
+		if field.TypeGuessed {
+			t.Errorf("Expected %v to decode as a string without guessing", field.Path)
+		}
+	}
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	key := []byte{0x00, 0x01, 0xfd, 0xfe, 0xff, 'k', 'e', 'y'}
+
+	for _, compress := range []bool{false, true} {
+		tree := map[string]any{
+			"private_key":   key,
+			"private_empty": []byte{},
+			"private_text":  string(key[5:]),
+			"database": map[string]any{
+				"private_hmac": bytes.Repeat([]byte{0xab}, 64),
+			},
+		}
+
+		opts := Options{
+			Keys: enc.KeySources{
+				Recipients:     []string{testkeys.TestRecipient1},
+				IdentitiesData: []string{testkeys.TestIdentity1},
+			},
+			Compress: compress,
+		}
+
+		tomlData, fields, err := Save(tree, opts)
+		if err != nil {
+			t.Fatalf("Failed to save (compress=%v): %v", compress, err)
+		}
+		if len(fields) != 4 {
+			t.Errorf("Expected 4 encrypted fields, got %d", len(fields))
+		}
+
+		result, err := Load(tomlData, opts)
+		if err != nil {
+			t.Fatalf("Failed to load (compress=%v): %v", compress, err)
+		}
+
+		if !reflect.DeepEqual(result.Tree, tree) {
+			t.Errorf("Round trip changed the tree (compress=%v):\nexpected %#v\ngot      %#v", compress, tree, result.Tree)
+		}
+	}
+}
+
+func TestSaveArmorColumns(t *testing.T) {
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		ArmorColumns: -1,
+	}
+
+	tomlData, fields, err := Save(map[string]any{"private_token": "abc123"}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	if lines := strings.Count(fields[0].Armored, "\n"); lines != 3 {
+		t.Errorf("Expected an unwrapped block of 3 lines, got %d:\n%s", lines, fields[0].Armored)
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if result.Tree["private_token"] != "abc123" {
+		t.Errorf("Expected abc123, got %v", result.Tree["private_token"])
+	}
+}
+
+func TestSaveSingleLine(t *testing.T) {
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		SingleLine: true,
+	}
+
+	tree := map[string]any{"private_token": "abc123", "name": "app"}
+	tomlData, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	if !strings.Contains(string(tomlData), `private_token = "`+enc.SingleLinePrefix) {
+		t.Errorf("Expected a single-line value in the output:\n%s", tomlData)
+	}
+	if strings.Contains(string(tomlData), "BEGIN AGE") {
+		t.Errorf("Expected no armored blocks in the output:\n%s", tomlData)
+	}
+	if len(fields) != 1 || !enc.IsSingleLine(fields[0].Armored) {
+		t.Errorf("Expected FieldMeta to record the single-line value, got %+v", fields)
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
 	}
+	if !reflect.DeepEqual(result.Tree, tree) {
+		t.Errorf("Round trip changed the tree:\nexpected %#v\ngot      %#v", tree, result.Tree)
+	}
+
+	// Re-saving keeps the value, already encrypted, as it is
+	again, _, err := Save(map[string]any{"private_token": fields[0].Armored}, opts)
+	if err != nil {
+		t.Fatalf("Failed to re-save: %v", err)
+	}
+	if !strings.Contains(string(again), fields[0].Armored) {
+		t.Errorf("Expected the single-line value to be kept:\n%s", again)
+	}
+}
+
+func TestSaveSkipEmpty(t *testing.T) {
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		SkipEmpty: true,
+	}
+
+	tree := map[string]any{"private_empty": "", "private_nil": nil, "private_token": "abc123"}
+	tomlData, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if len(fields) != 1 || strings.Join(fields[0].Path, ".") != "private_token" {
+		t.Errorf("Expected only private_token to be encrypted, got %+v", fields)
+	}
+	if !strings.Contains(string(tomlData), `private_empty = ""`) {
+		t.Errorf("Expected the empty field to stay plaintext:\n%s", tomlData)
+	}
+	if strings.Contains(string(tomlData), "private_nil") {
+		t.Errorf("Expected the nil field to be omitted:\n%s", tomlData)
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if value := result.Tree["private_empty"]; value != "" {
+		t.Errorf("Expected Load to return the empty field as is, got %#v", value)
+	}
+	if len(result.Fields) != 1 {
+		t.Errorf("Expected FieldMeta for the encrypted field only, got %+v", result.Fields)
+	}
+
+	// SkipEmpty wins over an explicit rule
+	opts.ShouldEncrypt = EncryptByPath("private_empty")
+	if _, fields, err := Save(map[string]any{"private_empty": ""}, opts); err != nil || len(fields) != 0 {
+		t.Errorf("Expected SkipEmpty to override ShouldEncrypt, got %+v (err %v)", fields, err)
+	}
+
+	// Without SkipEmpty, the empty string is encrypted like any value
+	opts.SkipEmpty = false
+	if _, fields, err := Save(map[string]any{"private_empty": ""}, opts); err != nil || len(fields) != 1 {
+		t.Errorf("Expected the empty field to be encrypted without SkipEmpty, got %+v (err %v)", fields, err)
+	}
+}
+
+func TestSaveRejectsCyclicTree(t *testing.T) {
+	tree := map[string]any{"private_token": "abc"}
+	tree["self"] = tree
+
+	opts := Options{
+		Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+	}
+
+	if _, _, err := Save(tree, opts); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expected ErrMaxDepth for a cyclic tree, got %v", err)
+	}
+}
+
+func TestSaveVerifyDecryptable(t *testing.T) {
+	tree := map[string]any{"private_token": "abc"}
+
+	tests := []struct {
+		name       string
+		identities []string
+		wantErr    bool
+	}{
+		{"matching identity", []string{testkeys.TestIdentity2, testkeys.TestIdentity1}, false},
+		{"wrong identity", []string{testkeys.TestIdentity2}, true},
+		{"no identities", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{
+				Keys: enc.KeySources{
+					Recipients:     []string{testkeys.TestRecipient1},
+					IdentitiesData: tt.identities,
+				},
+				VerifyDecryptable: true,
+			}
+
+			_, _, err := Save(tree, opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("nothing encrypted", func(t *testing.T) {
+		opts := Options{
+			Keys:              enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+			VerifyDecryptable: true,
+		}
+		if _, _, err := Save(map[string]any{"name": "plain"}, opts); err != nil {
+			t.Errorf("Expected no error without encrypted fields, got %v", err)
+		}
+	})
+
+	t.Run("pre-encrypted field readable, new one not", func(t *testing.T) {
+		readable, _, err := Save(map[string]any{"private_old": "abc"}, Options{
+			Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		var tree map[string]any
+		if err := toml.Unmarshal(readable, &tree); err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		tree["private_new"] = "def"
+
+		opts := Options{
+			Keys: enc.KeySources{
+				Recipients:     []string{testkeys.TestRecipient2},
+				IdentitiesData: []string{testkeys.TestIdentity1},
+			},
+			VerifyDecryptable: true,
+		}
+		for i := 0; i < 5; i++ { // Map order decides which field comes first
+			if _, _, err := Save(tree, opts); err == nil {
+				t.Fatal("Expected the new field, encrypted to the wrong recipient, to fail verification")
+			}
+		}
+	})
 }
 
 func TestCustomShouldEncrypt(t *testing.T) {
@@ -388,15 +908,77 @@ private_connection_string = "old_connection"
 	}
 }
 
-func TestSaveNoRecipients(t *testing.T) {
-	testData := map[string]any{
-		"private_password": "secret",
-	}
-
+func TestTransformWithMeta(t *testing.T) {
 	opts := Options{
 		Keys: enc.KeySources{
-			// No recipients provided
-		},
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	original, _, err := Save(map[string]any{
+		"private_token": "abc",
+		"database": map[string]any{
+			"host":             "localhost",
+			"private_password": "secret123",
+		},
+	}, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	// Uppercase every previously encrypted value, leaving plaintext alone
+	var seen []string
+	updated, _, err := TransformWithMeta(original, opts, func(tree map[string]any, fields []FieldMeta) error {
+		for _, field := range fields {
+			if !field.WasEncrypted || field.DecryptErr != nil {
+				continue
+			}
+			seen = append(seen, strings.Join(field.Path, "."))
+			value, _ := walk.GetValue(tree, field.Path)
+			if !walk.SetValue(tree, field.Path, strings.ToUpper(value.(string))) {
+				return fmt.Errorf("cannot set %v", field.Path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+
+	sort.Strings(seen)
+	if expected := []string{"database.private_password", "private_token"}; !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Expected metadata for %v, got %v", expected, seen)
+	}
+
+	result, err := Load(updated, opts)
+	if err != nil {
+		t.Fatalf("Failed to load transformed data: %v", err)
+	}
+	db := result.Tree["database"].(map[string]any)
+	if result.Tree["private_token"] != "ABC" || db["private_password"] != "SECRET123" {
+		t.Errorf("Expected encrypted values to be uppercased, got %v", result.Tree)
+	}
+	if db["host"] != "localhost" {
+		t.Errorf("Expected plaintext to be untouched, got %v", db["host"])
+	}
+
+	if _, _, err := TransformWithMeta(original, opts, func(map[string]any, []FieldMeta) error {
+		return errors.New("boom")
+	}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected the transformation error, got %v", err)
+	}
+}
+
+func TestSaveNoRecipients(t *testing.T) {
+	testData := map[string]any{
+		"private_password": "secret",
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			// No recipients provided
+		},
 	}
 
 	_, _, err := Save(testData, opts)
@@ -404,8 +986,8 @@ func TestSaveNoRecipients(t *testing.T) {
 		t.Fatal("Expected error when saving with no recipients")
 	}
 
-	if !strings.Contains(err.Error(), "no recipients") {
-		t.Errorf("Expected 'no recipients' error, got: %v", err)
+	if !errors.Is(err, enc.ErrNoRecipients) {
+		t.Errorf("Expected enc.ErrNoRecipients, got: %v", err)
 	}
 }
 
@@ -443,6 +1025,125 @@ func TestLoadMissingIdentities(t *testing.T) {
 	if !strings.Contains(passwordValue, "-----BEGIN AGE ENCRYPTED FILE-----") {
 		t.Error("Expected password to remain encrypted when no identities available")
 	}
+
+	// The failure should be recorded on the field
+	if len(result.Fields) != 1 || result.Fields[0].DecryptErr == nil {
+		t.Errorf("Expected DecryptErr to be set on the undecrypted field, got %+v", result.Fields)
+	}
+}
+
+func TestLoadOnDecryptError(t *testing.T) {
+	encryptedTOML, _, err := Save(map[string]any{
+		"private_password": "secret",
+		"db":               map[string]any{"private_token": "tok"},
+	}, Options{Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}}})
+	if err != nil {
+		t.Fatalf("Failed to save test data: %v", err)
+	}
+	wrongKey := enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity2}}
+
+	// Substitute a placeholder and continue
+	var seen []string
+	result, err := Load(encryptedTOML, Options{
+		Keys: wrongKey,
+		OnDecryptError: func(path []string, armored string, err error) (any, bool) {
+			if !strings.Contains(armored, "BEGIN AGE ENCRYPTED FILE") || err == nil {
+				t.Errorf("Unexpected callback arguments for %v: %q, %v", path, armored, err)
+			}
+			seen = append(seen, strings.Join(path, "."))
+			return "<redacted>", true
+		},
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	sort.Strings(seen)
+	if strings.Join(seen, ",") != "db.private_token,private_password" {
+		t.Errorf("Expected the callback for both fields, got %v", seen)
+	}
+	if result.Tree["private_password"] != "<redacted>" || result.Tree["db"].(map[string]any)["private_token"] != "<redacted>" {
+		t.Errorf("Expected placeholders in the tree, got %v", result.Tree)
+	}
+	for _, field := range result.Fields {
+		if field.DecryptErr == nil {
+			t.Errorf("Expected DecryptErr to still be recorded for %v", field.Path)
+		}
+	}
+
+	// Abort
+	_, err = Load(encryptedTOML, Options{
+		Keys: wrongKey,
+		OnDecryptError: func(path []string, armored string, err error) (any, bool) {
+			return nil, false
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+		t.Errorf("Expected Load to fail when the callback aborts, got %v", err)
+	}
+}
+
+func TestConcurrentLoadAndSave(t *testing.T) {
+	tree := func() map[string]any {
+		return map[string]any{
+			"private_password": "secret",
+			"database":         map[string]any{"host": "localhost", "private_token": "abc"},
+			"servers": []map[string]any{
+				{"name": "prod", "private_key": "k1"},
+			},
+		}
+	}
+	shared := tree()
+	saveOpts := Options{Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}}}
+
+	data, _, err := Save(shared, saveOpts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	original := append([]byte(nil), data...)
+
+	// Run with -race: Loads of one byte slice (sharing a cache) and Saves of
+	// one tree must not race, and must leave their inputs alone
+	loadOpts := Options{
+		Keys:         enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity1}},
+		DecryptCache: NewMemoryDecryptCache(),
+	}
+	const goroutines = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			result, err := Load(data, loadOpts)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if result.Tree["private_password"] != "secret" || len(result.Fields) != 3 {
+				errs <- fmt.Errorf("unexpected result: %v, %d fields", result.Tree, len(result.Fields))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, fields, err := Save(shared, saveOpts); err != nil {
+				errs <- err
+			} else if len(fields) != 3 {
+				errs <- fmt.Errorf("expected 3 fields, got %d", len(fields))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(data, original) {
+		t.Error("Expected Load not to modify its input")
+	}
+	if !reflect.DeepEqual(shared, tree()) {
+		t.Errorf("Expected Save not to modify its input, got %v", shared)
+	}
 }
 
 func TestIdempotentSave(t *testing.T) {
@@ -494,3 +1195,527 @@ func TestIdempotentSave(t *testing.T) {
 		t.Error("Expected idempotent save to produce the same decrypted result")
 	}
 }
+
+func TestSaveReusesUnchangedCiphertext(t *testing.T) {
+	testData := map[string]any{
+		"username":         "alice",
+		"private_password": "secret123",
+		"database": map[string]any{
+			"private_port": 5432,
+		},
+		"private_token": "token456",
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	firstSave, _, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed first save: %v", err)
+	}
+
+	var previous map[string]any
+	if err := toml.Unmarshal(firstSave, &previous); err != nil {
+		t.Fatalf("Failed to parse first save: %v", err)
+	}
+
+	// Change only one secret
+	testData["private_token"] = "token789"
+	opts.PreviousTree = previous
+
+	secondSave, _, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed second save: %v", err)
+	}
+
+	var current map[string]any
+	if err := toml.Unmarshal(secondSave, &current); err != nil {
+		t.Fatalf("Failed to parse second save: %v", err)
+	}
+
+	if current["private_password"] != previous["private_password"] {
+		t.Error("Expected unchanged private_password to reuse its armored block")
+	}
+
+	prevPort := previous["database"].(map[string]any)["private_port"]
+	currPort := current["database"].(map[string]any)["private_port"]
+	if currPort != prevPort {
+		t.Error("Expected unchanged non-string private_port to reuse its armored block")
+	}
+
+	if current["private_token"] == previous["private_token"] {
+		t.Error("Expected changed private_token to be re-encrypted")
+	}
+
+	result, err := Load(secondSave, opts)
+	if err != nil {
+		t.Fatalf("Failed to load second save: %v", err)
+	}
+
+	if result.Tree["private_token"] != "token789" {
+		t.Errorf("Expected private_token=token789, got %v", result.Tree["private_token"])
+	}
+}
+
+func TestSaveReencryptsForChangedRecipients(t *testing.T) {
+	tree := map[string]any{"private_token": "abc"}
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1, testkeys.TestRecipient2},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	firstSave, _, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed first save: %v", err)
+	}
+	var previous map[string]any
+	if err := toml.Unmarshal(firstSave, &previous); err != nil {
+		t.Fatalf("Failed to parse first save: %v", err)
+	}
+	opts.PreviousTree = previous
+
+	// Same recipients: the block is reused
+	again, _, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed re-save: %v", err)
+	}
+	if string(again) != string(firstSave) {
+		t.Error("Expected the unchanged field to keep its ciphertext for the same recipients")
+	}
+
+	// A removed recipient must not keep reading the unchanged field
+	opts.Keys.Recipients = []string{testkeys.TestRecipient1}
+	removed, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed save after removing a recipient: %v", err)
+	}
+	if string(removed) == string(firstSave) {
+		t.Fatal("Expected the field to be re-encrypted after removing a recipient")
+	}
+	identities, err := enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity2}}.LoadIdentities()
+	if err != nil {
+		t.Fatalf("Failed to load identity: %v", err)
+	}
+	if _, err := enc.Decrypt(fields[0].Armored, identities); err == nil {
+		t.Error("Expected the removed recipient to no longer decrypt the field")
+	}
+
+	// Swapping one X25519 recipient for another keeps the stanza count, but
+	// the identity in Keys shows the block is still for the old recipient
+	opts.Keys.Recipients = []string{testkeys.TestRecipient3, testkeys.TestRecipient2}
+	swapped, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed save after swapping a recipient: %v", err)
+	}
+	if string(swapped) == string(firstSave) {
+		t.Fatal("Expected the field to be re-encrypted after swapping a recipient")
+	}
+	identities, err = enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity1}}.LoadIdentities()
+	if err != nil {
+		t.Fatalf("Failed to load identity: %v", err)
+	}
+	if _, err := enc.Decrypt(fields[0].Armored, identities); err == nil {
+		t.Error("Expected the swapped-out recipient to no longer decrypt the field")
+	}
+}
+
+func TestSaveSortKeys(t *testing.T) {
+	testData := map[string]any{
+		"zeta":          "last",
+		"alpha":         "first",
+		"private_token": "token456",
+		"database": map[string]any{
+			"private_password": "secret123",
+			"host":             "localhost",
+		},
+		"cache": map[string]any{
+			"private_key": "key789",
+		},
+		"servers": []any{
+			map[string]any{"name": "prod", "private_api_key": "key123"},
+		},
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		SortKeys: true,
+	}
+
+	firstSave, fields, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed first save: %v", err)
+	}
+
+	var paths []string
+	for _, field := range fields {
+		paths = append(paths, strings.Join(field.Path, "."))
+	}
+	expectedPaths := []string{"cache.private_key", "database.private_password", "private_token", "servers.[0].private_api_key"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Expected fields %v, got %v", expectedPaths, paths)
+	}
+
+	// Plain values come first, then tables, each group in sorted order
+	var keyOrder []string
+	for _, line := range strings.Split(string(firstSave), "\n") {
+		line = strings.TrimSpace(line)
+		if key, _, ok := strings.Cut(line, " = "); ok && !strings.HasPrefix(line, "-") {
+			keyOrder = append(keyOrder, key)
+		} else if strings.HasPrefix(line, "[") {
+			keyOrder = append(keyOrder, line)
+		}
+	}
+	expectedOrder := []string{"alpha", "private_token", "zeta", "[cache]", "private_key", "[database]", "host", "private_password", "[[servers]]", "name", "private_api_key"}
+	if !reflect.DeepEqual(keyOrder, expectedOrder) {
+		t.Errorf("Expected key order %v, got %v", expectedOrder, keyOrder)
+	}
+
+	var previous map[string]any
+	if err := toml.Unmarshal(firstSave, &previous); err != nil {
+		t.Fatalf("Failed to parse first save: %v", err)
+	}
+	opts.PreviousTree = previous
+
+	for i := 0; i < 5; i++ {
+		again, _, err := Save(testData, opts)
+		if err != nil {
+			t.Fatalf("Failed re-save: %v", err)
+		}
+		if string(again) != string(firstSave) {
+			t.Fatalf("Expected re-saving an unchanged tree to reproduce the file, got:\n%s", again)
+		}
+	}
+}
+
+func TestSaveOnField(t *testing.T) {
+	tree := map[string]any{
+		"name":          "myapp",
+		"private_token": "abc",
+		"database": map[string]any{
+			"private_password": "secret123",
+		},
+		"private_limits": map[string]any{
+			"private_max": 100, // inside a whole-table blob: not counted separately
+		},
+	}
+
+	var calls []string
+	opts := Options{
+		Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}},
+		OnField: func(path []string, index, total int) {
+			calls = append(calls, fmt.Sprintf("%d/%d", index, total))
+		},
+	}
+
+	_, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	expected := []string{"1/3", "2/3", "3/3"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected progress %v, got %v", expected, calls)
+	}
+	if len(fields) != len(calls) {
+		t.Errorf("Expected one callback per field, got %d callbacks for %d fields", len(calls), len(fields))
+	}
+}
+
+func TestSaveWithFieldManifest(t *testing.T) {
+	testData := map[string]any{
+		"password":         "top_secret",
+		"private_password": "prefix_is_ignored",
+		"database": map[string]any{
+			"host":     "localhost",
+			"password": "db_secret",
+		},
+		"servers": []any{
+			map[string]any{"name": "prod", "api_key": "key123"},
+			map[string]any{"name": "staging", "api_key": "key456"},
+		},
+	}
+
+	manifest := `# Fields to encrypt
+password
+database.password
+
+servers[0].api_key
+servers.[1].api_key
+missing.field
+`
+
+	paths, err := ParseFieldManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+
+	if len(paths) != 5 {
+		t.Fatalf("Expected 5 manifest paths, got %d: %v", len(paths), paths)
+	}
+
+	missing := MissingPaths(testData, paths)
+	if !reflect.DeepEqual(missing, []string{"missing.field"}) {
+		t.Errorf("Expected missing.field to be reported missing, got %v", missing)
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+		EncryptPaths: paths,
+	}
+
+	tomlData, fields, err := Save(testData, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	encrypted := make(map[string]bool)
+	for _, field := range fields {
+		if field.WasEncrypted {
+			encrypted[strings.Join(field.Path, ".")] = true
+		}
+	}
+
+	expected := map[string]bool{
+		"password":            true,
+		"database.password":   true,
+		"servers.[0].api_key": true,
+		"servers.[1].api_key": true,
+	}
+
+	if !reflect.DeepEqual(encrypted, expected) {
+		t.Errorf("Expected encrypted fields %v, got %v", expected, encrypted)
+	}
+
+	if !strings.Contains(string(tomlData), "prefix_is_ignored") {
+		t.Error("Expected private_password to stay plaintext when a manifest is used")
+	}
+
+	result, err := Load(tomlData, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Tree, testData) {
+		t.Errorf("Round trip failed: expected %v, got %v", testData, result.Tree)
+	}
+}
+
+func TestArmorMentionIsPlaintext(t *testing.T) {
+	doc := "Encrypted values look like:\n-----BEGIN AGE ENCRYPTED FILE-----\n...\n-----END AGE ENCRYPTED FILE-----\n(see docs)"
+	tree := map[string]any{
+		"help":        doc,
+		"private_doc": doc,
+	}
+
+	opts := Options{
+		Keys: enc.KeySources{
+			Recipients:     []string{testkeys.TestRecipient1},
+			IdentitiesData: []string{testkeys.TestIdentity1},
+		},
+	}
+
+	data, fields, err := Save(tree, opts)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if len(fields) != 1 || fields[0].Armored == doc {
+		t.Fatalf("Expected private_doc to be encrypted rather than taken as ciphertext, got %+v", fields)
+	}
+
+	result, err := Load(data, opts)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if !reflect.DeepEqual(result.Tree, tree) {
+		t.Errorf("Expected the documentation text to round-trip, got %#v", result.Tree)
+	}
+	if summary := result.Summary(); summary.Encrypted != 1 || summary.Malformed != 0 {
+		t.Errorf("Expected one encrypted field and no malformed ones, got %+v", summary)
+	}
+}
+
+func TestLoadMalformedArmor(t *testing.T) {
+	keys := enc.KeySources{
+		Recipients:     []string{testkeys.TestRecipient1},
+		IdentitiesData: []string{testkeys.TestIdentity1},
+	}
+
+	recipients, err := keys.LoadRecipients()
+	if err != nil {
+		t.Fatalf("Failed to load recipients: %v", err)
+	}
+	encrypted, err := enc.Encrypt([]byte("secret"), recipients)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	truncated := encrypted[:strings.Index(encrypted, "-----END")]
+
+	data, err := tomlMarshal(map[string]any{
+		"private_token":     encrypted,
+		"private_truncated": truncated,
+		"note":              "plain",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	result, err := Load(data, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if result.Tree["private_truncated"] != truncated {
+		t.Error("Expected the malformed block to be left as-is")
+	}
+
+	var found bool
+	for _, field := range result.Fields {
+		if strings.Join(field.Path, ".") == "private_truncated" {
+			found = true
+			if !field.WasEncrypted || !errors.Is(field.DecryptErr, ErrMalformedArmor) {
+				t.Errorf("Expected an encrypted field with ErrMalformedArmor, got %+v", field)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected the malformed block to be reported in Fields")
+	}
+
+	expected := Summary{Encrypted: 2, Decrypted: 1, Malformed: 1}
+	if summary := result.Summary(); summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, summary)
+	}
+
+	// Without keys the intact block is undecryptable rather than malformed
+	result, err = Load(data, Options{})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	expected = Summary{Encrypted: 2, Undecryptable: 1, Malformed: 1}
+	if summary := result.Summary(); summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, summary)
+	}
+}
+
+func TestLoadRecordAllFields(t *testing.T) {
+	encryptedTOML, _, err := Save(map[string]any{
+		"name":             "app",
+		"private_password": "secret",
+		"db":               map[string]any{"port": int64(5432), "private_token": "tok"},
+		"hosts":            []any{"a", "b"},
+	}, Options{Keys: enc.KeySources{Recipients: []string{testkeys.TestRecipient1}}})
+	if err != nil {
+		t.Fatalf("Failed to save test data: %v", err)
+	}
+	keys := enc.KeySources{IdentitiesData: []string{testkeys.TestIdentity1}}
+
+	result, err := Load(encryptedTOML, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(result.Fields) != 2 {
+		t.Errorf("Expected only the 2 encrypted fields by default, got %d", len(result.Fields))
+	}
+
+	result, err = Load(encryptedTOML, Options{Keys: keys, RecordAllFields: true})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var got []string
+	for _, field := range result.Fields {
+		got = append(got, fmt.Sprintf("%s:%v:%s", strings.Join(field.Path, "."), field.WasEncrypted, field.Type))
+	}
+	sort.Strings(got)
+	expected := []string{
+		"db.port:false:int64",
+		"db.private_token:true:string",
+		"hosts.[0]:false:string",
+		"hosts.[1]:false:string",
+		"name:false:string",
+		"private_password:true:string",
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected fields %v, got %v", expected, got)
+	}
+	if summary := result.Summary(); summary.Encrypted != 2 {
+		t.Errorf("Expected Summary to count only encrypted fields, got %+v", summary)
+	}
+}
+
+func TestSaveSortRecipients(t *testing.T) {
+	tree := map[string]any{"private_password": "secret"}
+	usedRecipients := func(recipients []string, sorted bool) []string {
+		_, fields, err := Save(tree, Options{Keys: enc.KeySources{Recipients: recipients}, SortRecipients: sorted})
+		if err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		return fields[0].UsedRecipients
+	}
+
+	forward := []string{testkeys.TestRecipient1, testkeys.TestRecipient2}
+	backward := []string{testkeys.TestRecipient2, testkeys.TestRecipient1}
+
+	if a, b := usedRecipients(forward, false), usedRecipients(backward, false); a[0] == b[0] {
+		t.Errorf("Expected input order to be kept without SortRecipients, got %v and %v", a, b)
+	}
+	if a, b := usedRecipients(forward, true), usedRecipients(backward, true); strings.Join(a, ",") != strings.Join(b, ",") {
+		t.Errorf("Expected the same order with SortRecipients, got %v and %v", a, b)
+	}
+}
+
+func TestFieldMetaSizes(t *testing.T) {
+	keys := enc.KeySources{
+		Recipients:     []string{testkeys.TestRecipient1},
+		IdentitiesData: []string{testkeys.TestIdentity1},
+	}
+	tree := map[string]any{
+		"private_small": "x",
+		"private_large": strings.Repeat("secret", 100),
+	}
+
+	encrypted, saved, err := Save(tree, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	for _, field := range saved {
+		if field.ArmoredBytes != len(field.Armored) {
+			t.Errorf("%v: expected ArmoredBytes %d, got %d", field.Path, len(field.Armored), field.ArmoredBytes)
+		}
+		if want := len(tree[field.Path[0]].(string)); field.PlaintextBytes != want {
+			t.Errorf("%v: expected PlaintextBytes %d, got %d", field.Path, want, field.PlaintextBytes)
+		}
+	}
+
+	result, err := Load(encrypted, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, field := range result.Fields {
+		if field.ArmoredBytes != len(field.Armored) || field.PlaintextBytes != len(tree[field.Path[0]].(string)) {
+			t.Errorf("%v: unexpected sizes %d/%d", field.Path, field.ArmoredBytes, field.PlaintextBytes)
+		}
+	}
+
+	// Without keys the armor is still measured, but the plaintext isn't known
+	result, err = Load(encrypted, Options{})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, field := range result.Fields {
+		if field.ArmoredBytes == 0 || field.PlaintextBytes != 0 {
+			t.Errorf("%v: expected only ArmoredBytes without keys, got %d/%d", field.Path, field.ArmoredBytes, field.PlaintextBytes)
+		}
+	}
+}
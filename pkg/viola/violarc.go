@@ -0,0 +1,114 @@
+package viola
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// RCFileName is the name of the encryption policy file the CLI looks for in
+// the working directory, so a repository can keep its rules under version
+// control rather than in every user's flags
+const RCFileName = ".violarc"
+
+// RCRules is the encryption policy of a .violarc file, a TOML file with an
+// [encrypt] table:
+//
+//	[encrypt]
+//	prefixes = ["private_"]
+//	suffixes = ["_secret"]
+//	paths    = ["services.*.token", "**.password"]
+//	regexes  = ["(?i)^api_?key$"]
+//
+// A field matching any rule is encrypted.
+type RCRules struct {
+	// Prefixes and Suffixes match the start and end of a field's key
+	Prefixes []string `toml:"prefixes"`
+	Suffixes []string `toml:"suffixes"`
+
+	// Paths are dotted path globs (see EncryptByPathGlob)
+	Paths []string `toml:"paths"`
+
+	// Regexes are matched against a field's key (see EncryptByKeyRegex)
+	Regexes []string `toml:"regexes"`
+}
+
+// rcFile is the layout of a .violarc file
+type rcFile struct {
+	Encrypt RCRules `toml:"encrypt"`
+}
+
+// ParseRCRules parses the content of a .violarc file. Unknown keys are errors,
+// so a misspelled rule doesn't silently leave fields plaintext.
+func ParseRCRules(data []byte) (RCRules, error) {
+	var rc rcFile
+	meta, err := toml.Decode(string(data), &rc)
+	if err != nil {
+		return RCRules{}, fmt.Errorf("invalid %s: %w", RCFileName, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		sort.Strings(keys)
+		return RCRules{}, fmt.Errorf("unknown keys in %s: %s", RCFileName, strings.Join(keys, ", "))
+	}
+
+	if _, err := rc.Encrypt.ShouldEncrypt(); err != nil {
+		return RCRules{}, err
+	}
+	return rc.Encrypt, nil
+}
+
+// LoadRCRules reads the .violarc file in dir. found is false, with no error,
+// when there is none.
+func LoadRCRules(dir string) (rules RCRules, found bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, RCFileName))
+	if os.IsNotExist(err) {
+		return RCRules{}, false, nil
+	}
+	if err != nil {
+		return RCRules{}, false, err
+	}
+	rules, err = ParseRCRules(data)
+	return rules, err == nil, err
+}
+
+// ShouldEncrypt compiles the rules into a predicate for Options.ShouldEncrypt
+// matching fields that any rule matches
+func (r RCRules) ShouldEncrypt() (func(path []string, key string, value any) bool, error) {
+	var fns []func(path []string, key string, value any) bool
+	for _, prefix := range r.Prefixes {
+		if prefix == "" {
+			return nil, fmt.Errorf("empty prefix in %s", RCFileName)
+		}
+		fns = append(fns, EncryptByPrefix(prefix))
+	}
+	for _, suffix := range r.Suffixes {
+		if suffix == "" {
+			return nil, fmt.Errorf("empty suffix in %s", RCFileName)
+		}
+		fns = append(fns, EncryptBySuffix(suffix))
+	}
+	if len(r.Paths) > 0 {
+		fn, err := EncryptByPathGlob(r.Paths...)
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, fn)
+	}
+	for _, pattern := range r.Regexes {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in %s: %w", RCFileName, err)
+		}
+		fns = append(fns, EncryptByKeyRegex(re))
+	}
+	return EncryptAny(fns...), nil
+}
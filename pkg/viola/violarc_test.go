@@ -0,0 +1,78 @@
+package viola
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRCRules(t *testing.T) {
+	rules, err := ParseRCRules([]byte(`
+[encrypt]
+prefixes = ["private_"]
+suffixes = ["_secret"]
+paths = ["services.*.token"]
+regexes = ["(?i)^api_?key$"]
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	shouldEncrypt, err := rules.ShouldEncrypt()
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	tests := []struct {
+		path     []string
+		key      string
+		expected bool
+	}{
+		{nil, "private_key", true},
+		{[]string{"db"}, "password_secret", true},
+		{[]string{"services", "web"}, "token", true},
+		{[]string{"client"}, "API_KEY", true},
+		{[]string{"client"}, "host", false},
+		{nil, "token", false},
+	}
+	for _, tt := range tests {
+		if got := shouldEncrypt(tt.path, tt.key, "value"); got != tt.expected {
+			t.Errorf("%v.%s: expected %v, got %v", tt.path, tt.key, tt.expected, got)
+		}
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"unknown key":   "[encrypt]\nprefix = [\"private_\"]\n",
+			"bad regex":     "[encrypt]\nregexes = [\"(\"]\n",
+			"bad glob":      "[encrypt]\npaths = [\"a.[b\"]\n",
+			"empty prefix":  "[encrypt]\nprefixes = [\"\"]\n",
+			"invalid TOML":  "[encrypt\n",
+			"unknown table": "[decrypt]\nprefixes = [\"x\"]\n",
+		} {
+			if _, err := ParseRCRules([]byte(data)); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
+
+func TestLoadRCRules(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, found, err := LoadRCRules(dir); found || err != nil {
+		t.Errorf("Expected no rules and no error without a file, got %v, %v", found, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, RCFileName), []byte("[encrypt]\nsuffixes = [\"!\"]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", RCFileName, err)
+	}
+	rules, found, err := LoadRCRules(dir)
+	if err != nil || !found {
+		t.Fatalf("Expected rules, got %v, %v", found, err)
+	}
+	if strings.Join(rules.Suffixes, ",") != "!" {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+}